@@ -24,7 +24,38 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 
+// FeeBasis is the size fees are calculated on.
+type FeeBasis int32
+
+const (
+	// fees are based on the size of the uploaded file
+	FeeBasis_LOGICAL_BYTES FeeBasis = 0
+	// fees are based on the size of the stored, possibly compressed, blob
+	FeeBasis_PHYSICAL_BYTES FeeBasis = 1
+)
+
+var FeeBasis_name = map[int32]string{
+	0: "LOGICAL_BYTES",
+	1: "PHYSICAL_BYTES",
+}
+
+var FeeBasis_value = map[string]int32{
+	"LOGICAL_BYTES":  0,
+	"PHYSICAL_BYTES": 1,
+}
+
+func (x FeeBasis) String() string {
+	return proto.EnumName(FeeBasis_name, int32(x))
+}
+
+func (FeeBasis) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_1b40cafcd4234784, []int{0}
+}
+
 type GetInfoRequest struct {
+	// optional hex encoded random nonce of 8 to 64 bytes the server signs
+	// to prove its node identity
+	Nonce                string   `protobuf:"bytes,1,opt,name=nonce,proto3" json:"nonce,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -55,11 +86,23 @@ func (m *GetInfoRequest) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_GetInfoRequest proto.InternalMessageInfo
 
+func (m *GetInfoRequest) GetNonce() string {
+	if m != nil {
+		return m.Nonce
+	}
+	return ""
+}
+
 type GetInfoResponse struct {
-	FeeReport            *FeeReport `protobuf:"bytes,1,opt,name=fee_report,json=feeReport,proto3" json:"fee_report,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}   `json:"-"`
-	XXX_unrecognized     []byte     `json:"-"`
-	XXX_sizecache        int32      `json:"-"`
+	FeeReport *FeeReport `protobuf:"bytes,1,opt,name=fee_report,json=feeReport,proto3" json:"fee_report,omitempty"`
+	Limits    *Limits    `protobuf:"bytes,2,opt,name=limits,proto3" json:"limits,omitempty"`
+	Storage   *Storage   `protobuf:"bytes,3,opt,name=storage,proto3" json:"storage,omitempty"`
+	// set if the server uses tls
+	TlsIdentity          *TlsIdentity  `protobuf:"bytes,4,opt,name=tls_identity,json=tlsIdentity,proto3" json:"tls_identity,omitempty"`
+	NodeIdentity         *NodeIdentity `protobuf:"bytes,5,opt,name=node_identity,json=nodeIdentity,proto3" json:"node_identity,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
+	XXX_unrecognized     []byte        `json:"-"`
+	XXX_sizecache        int32         `json:"-"`
 }
 
 func (m *GetInfoResponse) Reset()         { *m = GetInfoResponse{} }
@@ -94,6 +137,448 @@ func (m *GetInfoResponse) GetFeeReport() *FeeReport {
 	return nil
 }
 
+func (m *GetInfoResponse) GetLimits() *Limits {
+	if m != nil {
+		return m.Limits
+	}
+	return nil
+}
+
+func (m *GetInfoResponse) GetStorage() *Storage {
+	if m != nil {
+		return m.Storage
+	}
+	return nil
+}
+
+func (m *GetInfoResponse) GetTlsIdentity() *TlsIdentity {
+	if m != nil {
+		return m.TlsIdentity
+	}
+	return nil
+}
+
+func (m *GetInfoResponse) GetNodeIdentity() *NodeIdentity {
+	if m != nil {
+		return m.NodeIdentity
+	}
+	return nil
+}
+
+// NodeIdentity identifies the lnd node operating the server.
+type NodeIdentity struct {
+	Pubkey string `protobuf:"bytes,1,opt,name=pubkey,proto3" json:"pubkey,omitempty"`
+	Alias  string `protobuf:"bytes,2,opt,name=alias,proto3" json:"alias,omitempty"`
+	// version of ln-fileserver
+	Version string `protobuf:"bytes,3,opt,name=version,proto3" json:"version,omitempty"`
+	// lnd signmessage signature of
+	// "lndprivatefileserver-info:<nonce>:<tls fingerprint>", set if a nonce
+	// was sent. The tls fingerprint is empty if the server uses no tls.
+	Signature            string   `protobuf:"bytes,4,opt,name=signature,proto3" json:"signature,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *NodeIdentity) Reset()         { *m = NodeIdentity{} }
+func (m *NodeIdentity) String() string { return proto.CompactTextString(m) }
+func (*NodeIdentity) ProtoMessage()    {}
+func (*NodeIdentity) Descriptor() ([]byte, []int) {
+	return fileDescriptor_1b40cafcd4234784, []int{2}
+}
+
+func (m *NodeIdentity) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_NodeIdentity.Unmarshal(m, b)
+}
+func (m *NodeIdentity) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_NodeIdentity.Marshal(b, m, deterministic)
+}
+func (m *NodeIdentity) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_NodeIdentity.Merge(m, src)
+}
+func (m *NodeIdentity) XXX_Size() int {
+	return xxx_messageInfo_NodeIdentity.Size(m)
+}
+func (m *NodeIdentity) XXX_DiscardUnknown() {
+	xxx_messageInfo_NodeIdentity.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_NodeIdentity proto.InternalMessageInfo
+
+func (m *NodeIdentity) GetPubkey() string {
+	if m != nil {
+		return m.Pubkey
+	}
+	return ""
+}
+
+func (m *NodeIdentity) GetAlias() string {
+	if m != nil {
+		return m.Alias
+	}
+	return ""
+}
+
+func (m *NodeIdentity) GetVersion() string {
+	if m != nil {
+		return m.Version
+	}
+	return ""
+}
+
+func (m *NodeIdentity) GetSignature() string {
+	if m != nil {
+		return m.Signature
+	}
+	return ""
+}
+
+// TlsIdentity proves that the tls certificate belongs to the node of the
+// server.
+type TlsIdentity struct {
+	// hex encoded sha256 hash of the DER encoded certificate
+	Fingerprint string `protobuf:"bytes,1,opt,name=fingerprint,proto3" json:"fingerprint,omitempty"`
+	// lnd signmessage signature of "lndprivatefileserver-tls:<fingerprint>"
+	Signature            string   `protobuf:"bytes,2,opt,name=signature,proto3" json:"signature,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TlsIdentity) Reset()         { *m = TlsIdentity{} }
+func (m *TlsIdentity) String() string { return proto.CompactTextString(m) }
+func (*TlsIdentity) ProtoMessage()    {}
+func (*TlsIdentity) Descriptor() ([]byte, []int) {
+	return fileDescriptor_1b40cafcd4234784, []int{3}
+}
+
+func (m *TlsIdentity) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TlsIdentity.Unmarshal(m, b)
+}
+func (m *TlsIdentity) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TlsIdentity.Marshal(b, m, deterministic)
+}
+func (m *TlsIdentity) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TlsIdentity.Merge(m, src)
+}
+func (m *TlsIdentity) XXX_Size() int {
+	return xxx_messageInfo_TlsIdentity.Size(m)
+}
+func (m *TlsIdentity) XXX_DiscardUnknown() {
+	xxx_messageInfo_TlsIdentity.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TlsIdentity proto.InternalMessageInfo
+
+func (m *TlsIdentity) GetFingerprint() string {
+	if m != nil {
+		return m.Fingerprint
+	}
+	return ""
+}
+
+func (m *TlsIdentity) GetSignature() string {
+	if m != nil {
+		return m.Signature
+	}
+	return ""
+}
+
+// Storage describes how files are stored by the server.
+type Storage struct {
+	// compression of stored files, empty if files are stored uncompressed
+	Compression          string   `protobuf:"bytes,1,opt,name=compression,proto3" json:"compression,omitempty"`
+	FeeBasis             FeeBasis `protobuf:"varint,2,opt,name=fee_basis,json=feeBasis,proto3,enum=api.FeeBasis" json:"fee_basis,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Storage) Reset()         { *m = Storage{} }
+func (m *Storage) String() string { return proto.CompactTextString(m) }
+func (*Storage) ProtoMessage()    {}
+func (*Storage) Descriptor() ([]byte, []int) {
+	return fileDescriptor_1b40cafcd4234784, []int{4}
+}
+
+func (m *Storage) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Storage.Unmarshal(m, b)
+}
+func (m *Storage) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Storage.Marshal(b, m, deterministic)
+}
+func (m *Storage) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Storage.Merge(m, src)
+}
+func (m *Storage) XXX_Size() int {
+	return xxx_messageInfo_Storage.Size(m)
+}
+func (m *Storage) XXX_DiscardUnknown() {
+	xxx_messageInfo_Storage.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Storage proto.InternalMessageInfo
+
+func (m *Storage) GetCompression() string {
+	if m != nil {
+		return m.Compression
+	}
+	return ""
+}
+
+func (m *Storage) GetFeeBasis() FeeBasis {
+	if m != nil {
+		return m.FeeBasis
+	}
+	return FeeBasis_LOGICAL_BYTES
+}
+
+// Limits are the storage limits of the server, 0 means unlimited.
+type Limits struct {
+	MaxBytesPerUser int64 `protobuf:"varint,1,opt,name=max_bytes_per_user,json=maxBytesPerUser,proto3" json:"max_bytes_per_user,omitempty"`
+	MaxFilesPerUser int64 `protobuf:"varint,2,opt,name=max_files_per_user,json=maxFilesPerUser,proto3" json:"max_files_per_user,omitempty"`
+	MaxFileSize     int64 `protobuf:"varint,3,opt,name=max_file_size,json=maxFileSize,proto3" json:"max_file_size,omitempty"`
+	// bytes that can still be stored before the disk reserve is reached,
+	// -1 if the server keeps no disk reserve
+	AvailableBytes       int64    `protobuf:"varint,4,opt,name=available_bytes,json=availableBytes,proto3" json:"available_bytes,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Limits) Reset()         { *m = Limits{} }
+func (m *Limits) String() string { return proto.CompactTextString(m) }
+func (*Limits) ProtoMessage()    {}
+func (*Limits) Descriptor() ([]byte, []int) {
+	return fileDescriptor_1b40cafcd4234784, []int{5}
+}
+
+func (m *Limits) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Limits.Unmarshal(m, b)
+}
+func (m *Limits) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Limits.Marshal(b, m, deterministic)
+}
+func (m *Limits) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Limits.Merge(m, src)
+}
+func (m *Limits) XXX_Size() int {
+	return xxx_messageInfo_Limits.Size(m)
+}
+func (m *Limits) XXX_DiscardUnknown() {
+	xxx_messageInfo_Limits.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Limits proto.InternalMessageInfo
+
+func (m *Limits) GetMaxBytesPerUser() int64 {
+	if m != nil {
+		return m.MaxBytesPerUser
+	}
+	return 0
+}
+
+func (m *Limits) GetMaxFilesPerUser() int64 {
+	if m != nil {
+		return m.MaxFilesPerUser
+	}
+	return 0
+}
+
+func (m *Limits) GetMaxFileSize() int64 {
+	if m != nil {
+		return m.MaxFileSize
+	}
+	return 0
+}
+
+func (m *Limits) GetAvailableBytes() int64 {
+	if m != nil {
+		return m.AvailableBytes
+	}
+	return 0
+}
+
+type GetChallengeRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetChallengeRequest) Reset()         { *m = GetChallengeRequest{} }
+func (m *GetChallengeRequest) String() string { return proto.CompactTextString(m) }
+func (*GetChallengeRequest) ProtoMessage()    {}
+func (*GetChallengeRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_1b40cafcd4234784, []int{6}
+}
+
+func (m *GetChallengeRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetChallengeRequest.Unmarshal(m, b)
+}
+func (m *GetChallengeRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetChallengeRequest.Marshal(b, m, deterministic)
+}
+func (m *GetChallengeRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetChallengeRequest.Merge(m, src)
+}
+func (m *GetChallengeRequest) XXX_Size() int {
+	return xxx_messageInfo_GetChallengeRequest.Size(m)
+}
+func (m *GetChallengeRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetChallengeRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetChallengeRequest proto.InternalMessageInfo
+
+type GetChallengeResponse struct {
+	Challenge            string   `protobuf:"bytes,1,opt,name=challenge,proto3" json:"challenge,omitempty"`
+	Expiry               int64    `protobuf:"varint,2,opt,name=expiry,proto3" json:"expiry,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetChallengeResponse) Reset()         { *m = GetChallengeResponse{} }
+func (m *GetChallengeResponse) String() string { return proto.CompactTextString(m) }
+func (*GetChallengeResponse) ProtoMessage()    {}
+func (*GetChallengeResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_1b40cafcd4234784, []int{7}
+}
+
+func (m *GetChallengeResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetChallengeResponse.Unmarshal(m, b)
+}
+func (m *GetChallengeResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetChallengeResponse.Marshal(b, m, deterministic)
+}
+func (m *GetChallengeResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetChallengeResponse.Merge(m, src)
+}
+func (m *GetChallengeResponse) XXX_Size() int {
+	return xxx_messageInfo_GetChallengeResponse.Size(m)
+}
+func (m *GetChallengeResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetChallengeResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetChallengeResponse proto.InternalMessageInfo
+
+func (m *GetChallengeResponse) GetChallenge() string {
+	if m != nil {
+		return m.Challenge
+	}
+	return ""
+}
+
+func (m *GetChallengeResponse) GetExpiry() int64 {
+	if m != nil {
+		return m.Expiry
+	}
+	return 0
+}
+
+type AuthenticateRequest struct {
+	Pubkey               string   `protobuf:"bytes,1,opt,name=pubkey,proto3" json:"pubkey,omitempty"`
+	Challenge            string   `protobuf:"bytes,2,opt,name=challenge,proto3" json:"challenge,omitempty"`
+	Sig                  string   `protobuf:"bytes,3,opt,name=sig,proto3" json:"sig,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *AuthenticateRequest) Reset()         { *m = AuthenticateRequest{} }
+func (m *AuthenticateRequest) String() string { return proto.CompactTextString(m) }
+func (*AuthenticateRequest) ProtoMessage()    {}
+func (*AuthenticateRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_1b40cafcd4234784, []int{8}
+}
+
+func (m *AuthenticateRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AuthenticateRequest.Unmarshal(m, b)
+}
+func (m *AuthenticateRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AuthenticateRequest.Marshal(b, m, deterministic)
+}
+func (m *AuthenticateRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AuthenticateRequest.Merge(m, src)
+}
+func (m *AuthenticateRequest) XXX_Size() int {
+	return xxx_messageInfo_AuthenticateRequest.Size(m)
+}
+func (m *AuthenticateRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_AuthenticateRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AuthenticateRequest proto.InternalMessageInfo
+
+func (m *AuthenticateRequest) GetPubkey() string {
+	if m != nil {
+		return m.Pubkey
+	}
+	return ""
+}
+
+func (m *AuthenticateRequest) GetChallenge() string {
+	if m != nil {
+		return m.Challenge
+	}
+	return ""
+}
+
+func (m *AuthenticateRequest) GetSig() string {
+	if m != nil {
+		return m.Sig
+	}
+	return ""
+}
+
+type AuthenticateResponse struct {
+	Token                string   `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	Expiry               int64    `protobuf:"varint,2,opt,name=expiry,proto3" json:"expiry,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *AuthenticateResponse) Reset()         { *m = AuthenticateResponse{} }
+func (m *AuthenticateResponse) String() string { return proto.CompactTextString(m) }
+func (*AuthenticateResponse) ProtoMessage()    {}
+func (*AuthenticateResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_1b40cafcd4234784, []int{9}
+}
+
+func (m *AuthenticateResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AuthenticateResponse.Unmarshal(m, b)
+}
+func (m *AuthenticateResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AuthenticateResponse.Marshal(b, m, deterministic)
+}
+func (m *AuthenticateResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AuthenticateResponse.Merge(m, src)
+}
+func (m *AuthenticateResponse) XXX_Size() int {
+	return xxx_messageInfo_AuthenticateResponse.Size(m)
+}
+func (m *AuthenticateResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_AuthenticateResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AuthenticateResponse proto.InternalMessageInfo
+
+func (m *AuthenticateResponse) GetToken() string {
+	if m != nil {
+		return m.Token
+	}
+	return ""
+}
+
+func (m *AuthenticateResponse) GetExpiry() int64 {
+	if m != nil {
+		return m.Expiry
+	}
+	return 0
+}
+
 type ListFilesRequest struct {
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
@@ -104,7 +589,7 @@ func (m *ListFilesRequest) Reset()         { *m = ListFilesRequest{} }
 func (m *ListFilesRequest) String() string { return proto.CompactTextString(m) }
 func (*ListFilesRequest) ProtoMessage()    {}
 func (*ListFilesRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_1b40cafcd4234784, []int{2}
+	return fileDescriptor_1b40cafcd4234784, []int{10}
 }
 
 func (m *ListFilesRequest) XXX_Unmarshal(b []byte) error {
@@ -136,7 +621,7 @@ func (m *ListFilesResponse) Reset()         { *m = ListFilesResponse{} }
 func (m *ListFilesResponse) String() string { return proto.CompactTextString(m) }
 func (*ListFilesResponse) ProtoMessage()    {}
 func (*ListFilesResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_1b40cafcd4234784, []int{3}
+	return fileDescriptor_1b40cafcd4234784, []int{11}
 }
 
 func (m *ListFilesResponse) XXX_Unmarshal(b []byte) error {
@@ -169,6 +654,7 @@ type UploadFileRequest struct {
 	//	*UploadFileRequest_Slot
 	//	*UploadFileRequest_Chunk
 	//	*UploadFileRequest_Finished
+	//	*UploadFileRequest_Resume
 	Event                isUploadFileRequest_Event `protobuf_oneof:"event"`
 	XXX_NoUnkeyedLiteral struct{}                  `json:"-"`
 	XXX_unrecognized     []byte                    `json:"-"`
@@ -179,7 +665,7 @@ func (m *UploadFileRequest) Reset()         { *m = UploadFileRequest{} }
 func (m *UploadFileRequest) String() string { return proto.CompactTextString(m) }
 func (*UploadFileRequest) ProtoMessage()    {}
 func (*UploadFileRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_1b40cafcd4234784, []int{4}
+	return fileDescriptor_1b40cafcd4234784, []int{12}
 }
 
 func (m *UploadFileRequest) XXX_Unmarshal(b []byte) error {
@@ -216,12 +702,18 @@ type UploadFileRequest_Finished struct {
 	Finished *Empty `protobuf:"bytes,3,opt,name=finished,proto3,oneof"`
 }
 
+type UploadFileRequest_Resume struct {
+	Resume *ResumeUpload `protobuf:"bytes,4,opt,name=resume,proto3,oneof"`
+}
+
 func (*UploadFileRequest_Slot) isUploadFileRequest_Event() {}
 
 func (*UploadFileRequest_Chunk) isUploadFileRequest_Event() {}
 
 func (*UploadFileRequest_Finished) isUploadFileRequest_Event() {}
 
+func (*UploadFileRequest_Resume) isUploadFileRequest_Event() {}
+
 func (m *UploadFileRequest) GetEvent() isUploadFileRequest_Event {
 	if m != nil {
 		return m.Event
@@ -250,12 +742,20 @@ func (m *UploadFileRequest) GetFinished() *Empty {
 	return nil
 }
 
+func (m *UploadFileRequest) GetResume() *ResumeUpload {
+	if x, ok := m.GetEvent().(*UploadFileRequest_Resume); ok {
+		return x.Resume
+	}
+	return nil
+}
+
 // XXX_OneofWrappers is for the internal use of the proto package.
 func (*UploadFileRequest) XXX_OneofWrappers() []interface{} {
 	return []interface{}{
 		(*UploadFileRequest_Slot)(nil),
 		(*UploadFileRequest_Chunk)(nil),
 		(*UploadFileRequest_Finished)(nil),
+		(*UploadFileRequest_Resume)(nil),
 	}
 }
 
@@ -263,6 +763,7 @@ type UploadFileResponse struct {
 	// Types that are valid to be assigned to Event:
 	//	*UploadFileResponse_Invoice
 	//	*UploadFileResponse_FinishedFile
+	//	*UploadFileResponse_Session
 	Event                isUploadFileResponse_Event `protobuf_oneof:"event"`
 	XXX_NoUnkeyedLiteral struct{}                   `json:"-"`
 	XXX_unrecognized     []byte                     `json:"-"`
@@ -273,7 +774,7 @@ func (m *UploadFileResponse) Reset()         { *m = UploadFileResponse{} }
 func (m *UploadFileResponse) String() string { return proto.CompactTextString(m) }
 func (*UploadFileResponse) ProtoMessage()    {}
 func (*UploadFileResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_1b40cafcd4234784, []int{5}
+	return fileDescriptor_1b40cafcd4234784, []int{13}
 }
 
 func (m *UploadFileResponse) XXX_Unmarshal(b []byte) error {
@@ -306,10 +807,16 @@ type UploadFileResponse_FinishedFile struct {
 	FinishedFile *FileSlot `protobuf:"bytes,2,opt,name=finished_file,json=finishedFile,proto3,oneof"`
 }
 
+type UploadFileResponse_Session struct {
+	Session *UploadSession `protobuf:"bytes,3,opt,name=session,proto3,oneof"`
+}
+
 func (*UploadFileResponse_Invoice) isUploadFileResponse_Event() {}
 
 func (*UploadFileResponse_FinishedFile) isUploadFileResponse_Event() {}
 
+func (*UploadFileResponse_Session) isUploadFileResponse_Event() {}
+
 func (m *UploadFileResponse) GetEvent() isUploadFileResponse_Event {
 	if m != nil {
 		return m.Event
@@ -331,16 +838,114 @@ func (m *UploadFileResponse) GetFinishedFile() *FileSlot {
 	return nil
 }
 
+func (m *UploadFileResponse) GetSession() *UploadSession {
+	if x, ok := m.GetEvent().(*UploadFileResponse_Session); ok {
+		return x.Session
+	}
+	return nil
+}
+
 // XXX_OneofWrappers is for the internal use of the proto package.
 func (*UploadFileResponse) XXX_OneofWrappers() []interface{} {
 	return []interface{}{
 		(*UploadFileResponse_Invoice)(nil),
 		(*UploadFileResponse_FinishedFile)(nil),
+		(*UploadFileResponse_Session)(nil),
 	}
 }
 
+type ResumeUpload struct {
+	UploadId             string   `protobuf:"bytes,1,opt,name=upload_id,json=uploadId,proto3" json:"upload_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ResumeUpload) Reset()         { *m = ResumeUpload{} }
+func (m *ResumeUpload) String() string { return proto.CompactTextString(m) }
+func (*ResumeUpload) ProtoMessage()    {}
+func (*ResumeUpload) Descriptor() ([]byte, []int) {
+	return fileDescriptor_1b40cafcd4234784, []int{14}
+}
+
+func (m *ResumeUpload) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ResumeUpload.Unmarshal(m, b)
+}
+func (m *ResumeUpload) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ResumeUpload.Marshal(b, m, deterministic)
+}
+func (m *ResumeUpload) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ResumeUpload.Merge(m, src)
+}
+func (m *ResumeUpload) XXX_Size() int {
+	return xxx_messageInfo_ResumeUpload.Size(m)
+}
+func (m *ResumeUpload) XXX_DiscardUnknown() {
+	xxx_messageInfo_ResumeUpload.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ResumeUpload proto.InternalMessageInfo
+
+func (m *ResumeUpload) GetUploadId() string {
+	if m != nil {
+		return m.UploadId
+	}
+	return ""
+}
+
+type UploadSession struct {
+	UploadId             string   `protobuf:"bytes,1,opt,name=upload_id,json=uploadId,proto3" json:"upload_id,omitempty"`
+	Offset               int64    `protobuf:"varint,2,opt,name=offset,proto3" json:"offset,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *UploadSession) Reset()         { *m = UploadSession{} }
+func (m *UploadSession) String() string { return proto.CompactTextString(m) }
+func (*UploadSession) ProtoMessage()    {}
+func (*UploadSession) Descriptor() ([]byte, []int) {
+	return fileDescriptor_1b40cafcd4234784, []int{15}
+}
+
+func (m *UploadSession) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_UploadSession.Unmarshal(m, b)
+}
+func (m *UploadSession) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_UploadSession.Marshal(b, m, deterministic)
+}
+func (m *UploadSession) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_UploadSession.Merge(m, src)
+}
+func (m *UploadSession) XXX_Size() int {
+	return xxx_messageInfo_UploadSession.Size(m)
+}
+func (m *UploadSession) XXX_DiscardUnknown() {
+	xxx_messageInfo_UploadSession.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_UploadSession proto.InternalMessageInfo
+
+func (m *UploadSession) GetUploadId() string {
+	if m != nil {
+		return m.UploadId
+	}
+	return ""
+}
+
+func (m *UploadSession) GetOffset() int64 {
+	if m != nil {
+		return m.Offset
+	}
+	return 0
+}
+
 type DownloadFileRequest struct {
-	FileId               string   `protobuf:"bytes,1,opt,name=file_id,json=fileId,proto3" json:"file_id,omitempty"`
+	FileId string `protobuf:"bytes,1,opt,name=file_id,json=fileId,proto3" json:"file_id,omitempty"`
+	// offset in bytes to start the download at
+	Offset int64 `protobuf:"varint,2,opt,name=offset,proto3" json:"offset,omitempty"`
+	// number of bytes to download, 0 downloads until the end of the file
+	Length               int64    `protobuf:"varint,3,opt,name=length,proto3" json:"length,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -350,7 +955,7 @@ func (m *DownloadFileRequest) Reset()         { *m = DownloadFileRequest{} }
 func (m *DownloadFileRequest) String() string { return proto.CompactTextString(m) }
 func (*DownloadFileRequest) ProtoMessage()    {}
 func (*DownloadFileRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_1b40cafcd4234784, []int{6}
+	return fileDescriptor_1b40cafcd4234784, []int{16}
 }
 
 func (m *DownloadFileRequest) XXX_Unmarshal(b []byte) error {
@@ -378,6 +983,20 @@ func (m *DownloadFileRequest) GetFileId() string {
 	return ""
 }
 
+func (m *DownloadFileRequest) GetOffset() int64 {
+	if m != nil {
+		return m.Offset
+	}
+	return 0
+}
+
+func (m *DownloadFileRequest) GetLength() int64 {
+	if m != nil {
+		return m.Length
+	}
+	return 0
+}
+
 type DownloadFileResponse struct {
 	// Types that are valid to be assigned to Event:
 	//	*DownloadFileResponse_FileInfo
@@ -394,7 +1013,7 @@ func (m *DownloadFileResponse) Reset()         { *m = DownloadFileResponse{} }
 func (m *DownloadFileResponse) String() string { return proto.CompactTextString(m) }
 func (*DownloadFileResponse) ProtoMessage()    {}
 func (*DownloadFileResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_1b40cafcd4234784, []int{7}
+	return fileDescriptor_1b40cafcd4234784, []int{17}
 }
 
 func (m *DownloadFileResponse) XXX_Unmarshal(b []byte) error {
@@ -439,53 +1058,439 @@ func (*DownloadFileResponse_FileInfo) isDownloadFileResponse_Event() {}
 
 func (*DownloadFileResponse_Invoice) isDownloadFileResponse_Event() {}
 
-func (*DownloadFileResponse_Chunk) isDownloadFileResponse_Event() {}
+func (*DownloadFileResponse_Chunk) isDownloadFileResponse_Event() {}
+
+func (*DownloadFileResponse_Finished) isDownloadFileResponse_Event() {}
+
+func (m *DownloadFileResponse) GetEvent() isDownloadFileResponse_Event {
+	if m != nil {
+		return m.Event
+	}
+	return nil
+}
+
+func (m *DownloadFileResponse) GetFileInfo() *FileSlot {
+	if x, ok := m.GetEvent().(*DownloadFileResponse_FileInfo); ok {
+		return x.FileInfo
+	}
+	return nil
+}
+
+func (m *DownloadFileResponse) GetInvoice() *InvoiceResponse {
+	if x, ok := m.GetEvent().(*DownloadFileResponse_Invoice); ok {
+		return x.Invoice
+	}
+	return nil
+}
+
+func (m *DownloadFileResponse) GetChunk() *FileChunk {
+	if x, ok := m.GetEvent().(*DownloadFileResponse_Chunk); ok {
+		return x.Chunk
+	}
+	return nil
+}
+
+func (m *DownloadFileResponse) GetFinished() *Empty {
+	if x, ok := m.GetEvent().(*DownloadFileResponse_Finished); ok {
+		return x.Finished
+	}
+	return nil
+}
+
+// XXX_OneofWrappers is for the internal use of the proto package.
+func (*DownloadFileResponse) XXX_OneofWrappers() []interface{} {
+	return []interface{}{
+		(*DownloadFileResponse_FileInfo)(nil),
+		(*DownloadFileResponse_Invoice)(nil),
+		(*DownloadFileResponse_Chunk)(nil),
+		(*DownloadFileResponse_Finished)(nil),
+	}
+}
+
+type DeleteFileRequest struct {
+	FileId               string   `protobuf:"bytes,1,opt,name=file_id,json=fileId,proto3" json:"file_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DeleteFileRequest) Reset()         { *m = DeleteFileRequest{} }
+func (m *DeleteFileRequest) String() string { return proto.CompactTextString(m) }
+func (*DeleteFileRequest) ProtoMessage()    {}
+func (*DeleteFileRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_1b40cafcd4234784, []int{18}
+}
+
+func (m *DeleteFileRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DeleteFileRequest.Unmarshal(m, b)
+}
+func (m *DeleteFileRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DeleteFileRequest.Marshal(b, m, deterministic)
+}
+func (m *DeleteFileRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DeleteFileRequest.Merge(m, src)
+}
+func (m *DeleteFileRequest) XXX_Size() int {
+	return xxx_messageInfo_DeleteFileRequest.Size(m)
+}
+func (m *DeleteFileRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_DeleteFileRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DeleteFileRequest proto.InternalMessageInfo
+
+func (m *DeleteFileRequest) GetFileId() string {
+	if m != nil {
+		return m.FileId
+	}
+	return ""
+}
+
+type DeleteFileResponse struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DeleteFileResponse) Reset()         { *m = DeleteFileResponse{} }
+func (m *DeleteFileResponse) String() string { return proto.CompactTextString(m) }
+func (*DeleteFileResponse) ProtoMessage()    {}
+func (*DeleteFileResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_1b40cafcd4234784, []int{19}
+}
+
+func (m *DeleteFileResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DeleteFileResponse.Unmarshal(m, b)
+}
+func (m *DeleteFileResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DeleteFileResponse.Marshal(b, m, deterministic)
+}
+func (m *DeleteFileResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DeleteFileResponse.Merge(m, src)
+}
+func (m *DeleteFileResponse) XXX_Size() int {
+	return xxx_messageInfo_DeleteFileResponse.Size(m)
+}
+func (m *DeleteFileResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_DeleteFileResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DeleteFileResponse proto.InternalMessageInfo
+
+type ExtendFileRequest struct {
+	FileId               string   `protobuf:"bytes,1,opt,name=file_id,json=fileId,proto3" json:"file_id,omitempty"`
+	DeletionDate         int64    `protobuf:"varint,2,opt,name=deletion_date,json=deletionDate,proto3" json:"deletion_date,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ExtendFileRequest) Reset()         { *m = ExtendFileRequest{} }
+func (m *ExtendFileRequest) String() string { return proto.CompactTextString(m) }
+func (*ExtendFileRequest) ProtoMessage()    {}
+func (*ExtendFileRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_1b40cafcd4234784, []int{20}
+}
+
+func (m *ExtendFileRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ExtendFileRequest.Unmarshal(m, b)
+}
+func (m *ExtendFileRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ExtendFileRequest.Marshal(b, m, deterministic)
+}
+func (m *ExtendFileRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ExtendFileRequest.Merge(m, src)
+}
+func (m *ExtendFileRequest) XXX_Size() int {
+	return xxx_messageInfo_ExtendFileRequest.Size(m)
+}
+func (m *ExtendFileRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ExtendFileRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ExtendFileRequest proto.InternalMessageInfo
+
+func (m *ExtendFileRequest) GetFileId() string {
+	if m != nil {
+		return m.FileId
+	}
+	return ""
+}
+
+func (m *ExtendFileRequest) GetDeletionDate() int64 {
+	if m != nil {
+		return m.DeletionDate
+	}
+	return 0
+}
+
+type ExtendFileResponse struct {
+	// Types that are valid to be assigned to Event:
+	//	*ExtendFileResponse_Invoice
+	//	*ExtendFileResponse_FileInfo
+	Event                isExtendFileResponse_Event `protobuf_oneof:"event"`
+	XXX_NoUnkeyedLiteral struct{}                   `json:"-"`
+	XXX_unrecognized     []byte                     `json:"-"`
+	XXX_sizecache        int32                      `json:"-"`
+}
+
+func (m *ExtendFileResponse) Reset()         { *m = ExtendFileResponse{} }
+func (m *ExtendFileResponse) String() string { return proto.CompactTextString(m) }
+func (*ExtendFileResponse) ProtoMessage()    {}
+func (*ExtendFileResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_1b40cafcd4234784, []int{21}
+}
+
+func (m *ExtendFileResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ExtendFileResponse.Unmarshal(m, b)
+}
+func (m *ExtendFileResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ExtendFileResponse.Marshal(b, m, deterministic)
+}
+func (m *ExtendFileResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ExtendFileResponse.Merge(m, src)
+}
+func (m *ExtendFileResponse) XXX_Size() int {
+	return xxx_messageInfo_ExtendFileResponse.Size(m)
+}
+func (m *ExtendFileResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ExtendFileResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ExtendFileResponse proto.InternalMessageInfo
+
+type isExtendFileResponse_Event interface {
+	isExtendFileResponse_Event()
+}
+
+type ExtendFileResponse_Invoice struct {
+	Invoice *InvoiceResponse `protobuf:"bytes,1,opt,name=invoice,proto3,oneof"`
+}
+
+type ExtendFileResponse_FileInfo struct {
+	FileInfo *FileSlot `protobuf:"bytes,2,opt,name=file_info,json=fileInfo,proto3,oneof"`
+}
+
+func (*ExtendFileResponse_Invoice) isExtendFileResponse_Event() {}
+
+func (*ExtendFileResponse_FileInfo) isExtendFileResponse_Event() {}
+
+func (m *ExtendFileResponse) GetEvent() isExtendFileResponse_Event {
+	if m != nil {
+		return m.Event
+	}
+	return nil
+}
+
+func (m *ExtendFileResponse) GetInvoice() *InvoiceResponse {
+	if x, ok := m.GetEvent().(*ExtendFileResponse_Invoice); ok {
+		return x.Invoice
+	}
+	return nil
+}
+
+func (m *ExtendFileResponse) GetFileInfo() *FileSlot {
+	if x, ok := m.GetEvent().(*ExtendFileResponse_FileInfo); ok {
+		return x.FileInfo
+	}
+	return nil
+}
+
+// XXX_OneofWrappers is for the internal use of the proto package.
+func (*ExtendFileResponse) XXX_OneofWrappers() []interface{} {
+	return []interface{}{
+		(*ExtendFileResponse_Invoice)(nil),
+		(*ExtendFileResponse_FileInfo)(nil),
+	}
+}
+
+type TopUpRequest struct {
+	AmtMsat              int64    `protobuf:"varint,1,opt,name=amt_msat,json=amtMsat,proto3" json:"amt_msat,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TopUpRequest) Reset()         { *m = TopUpRequest{} }
+func (m *TopUpRequest) String() string { return proto.CompactTextString(m) }
+func (*TopUpRequest) ProtoMessage()    {}
+func (*TopUpRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_1b40cafcd4234784, []int{22}
+}
+
+func (m *TopUpRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TopUpRequest.Unmarshal(m, b)
+}
+func (m *TopUpRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TopUpRequest.Marshal(b, m, deterministic)
+}
+func (m *TopUpRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TopUpRequest.Merge(m, src)
+}
+func (m *TopUpRequest) XXX_Size() int {
+	return xxx_messageInfo_TopUpRequest.Size(m)
+}
+func (m *TopUpRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_TopUpRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TopUpRequest proto.InternalMessageInfo
+
+func (m *TopUpRequest) GetAmtMsat() int64 {
+	if m != nil {
+		return m.AmtMsat
+	}
+	return 0
+}
+
+type TopUpResponse struct {
+	// Types that are valid to be assigned to Event:
+	//	*TopUpResponse_Invoice
+	//	*TopUpResponse_Balance
+	Event                isTopUpResponse_Event `protobuf_oneof:"event"`
+	XXX_NoUnkeyedLiteral struct{}              `json:"-"`
+	XXX_unrecognized     []byte                `json:"-"`
+	XXX_sizecache        int32                 `json:"-"`
+}
+
+func (m *TopUpResponse) Reset()         { *m = TopUpResponse{} }
+func (m *TopUpResponse) String() string { return proto.CompactTextString(m) }
+func (*TopUpResponse) ProtoMessage()    {}
+func (*TopUpResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_1b40cafcd4234784, []int{23}
+}
+
+func (m *TopUpResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TopUpResponse.Unmarshal(m, b)
+}
+func (m *TopUpResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TopUpResponse.Marshal(b, m, deterministic)
+}
+func (m *TopUpResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TopUpResponse.Merge(m, src)
+}
+func (m *TopUpResponse) XXX_Size() int {
+	return xxx_messageInfo_TopUpResponse.Size(m)
+}
+func (m *TopUpResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_TopUpResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TopUpResponse proto.InternalMessageInfo
+
+type isTopUpResponse_Event interface {
+	isTopUpResponse_Event()
+}
+
+type TopUpResponse_Invoice struct {
+	Invoice *InvoiceResponse `protobuf:"bytes,1,opt,name=invoice,proto3,oneof"`
+}
+
+type TopUpResponse_Balance struct {
+	Balance *GetBalanceResponse `protobuf:"bytes,2,opt,name=balance,proto3,oneof"`
+}
+
+func (*TopUpResponse_Invoice) isTopUpResponse_Event() {}
 
-func (*DownloadFileResponse_Finished) isDownloadFileResponse_Event() {}
+func (*TopUpResponse_Balance) isTopUpResponse_Event() {}
 
-func (m *DownloadFileResponse) GetEvent() isDownloadFileResponse_Event {
+func (m *TopUpResponse) GetEvent() isTopUpResponse_Event {
 	if m != nil {
 		return m.Event
 	}
 	return nil
 }
 
-func (m *DownloadFileResponse) GetFileInfo() *FileSlot {
-	if x, ok := m.GetEvent().(*DownloadFileResponse_FileInfo); ok {
-		return x.FileInfo
+func (m *TopUpResponse) GetInvoice() *InvoiceResponse {
+	if x, ok := m.GetEvent().(*TopUpResponse_Invoice); ok {
+		return x.Invoice
 	}
 	return nil
 }
 
-func (m *DownloadFileResponse) GetInvoice() *InvoiceResponse {
-	if x, ok := m.GetEvent().(*DownloadFileResponse_Invoice); ok {
-		return x.Invoice
+func (m *TopUpResponse) GetBalance() *GetBalanceResponse {
+	if x, ok := m.GetEvent().(*TopUpResponse_Balance); ok {
+		return x.Balance
 	}
 	return nil
 }
 
-func (m *DownloadFileResponse) GetChunk() *FileChunk {
-	if x, ok := m.GetEvent().(*DownloadFileResponse_Chunk); ok {
-		return x.Chunk
+// XXX_OneofWrappers is for the internal use of the proto package.
+func (*TopUpResponse) XXX_OneofWrappers() []interface{} {
+	return []interface{}{
+		(*TopUpResponse_Invoice)(nil),
+		(*TopUpResponse_Balance)(nil),
 	}
-	return nil
 }
 
-func (m *DownloadFileResponse) GetFinished() *Empty {
-	if x, ok := m.GetEvent().(*DownloadFileResponse_Finished); ok {
-		return x.Finished
-	}
-	return nil
+type GetBalanceRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
-// XXX_OneofWrappers is for the internal use of the proto package.
-func (*DownloadFileResponse) XXX_OneofWrappers() []interface{} {
-	return []interface{}{
-		(*DownloadFileResponse_FileInfo)(nil),
-		(*DownloadFileResponse_Invoice)(nil),
-		(*DownloadFileResponse_Chunk)(nil),
-		(*DownloadFileResponse_Finished)(nil),
+func (m *GetBalanceRequest) Reset()         { *m = GetBalanceRequest{} }
+func (m *GetBalanceRequest) String() string { return proto.CompactTextString(m) }
+func (*GetBalanceRequest) ProtoMessage()    {}
+func (*GetBalanceRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_1b40cafcd4234784, []int{24}
+}
+
+func (m *GetBalanceRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetBalanceRequest.Unmarshal(m, b)
+}
+func (m *GetBalanceRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetBalanceRequest.Marshal(b, m, deterministic)
+}
+func (m *GetBalanceRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetBalanceRequest.Merge(m, src)
+}
+func (m *GetBalanceRequest) XXX_Size() int {
+	return xxx_messageInfo_GetBalanceRequest.Size(m)
+}
+func (m *GetBalanceRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetBalanceRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetBalanceRequest proto.InternalMessageInfo
+
+type GetBalanceResponse struct {
+	BalanceMsat          int64    `protobuf:"varint,1,opt,name=balance_msat,json=balanceMsat,proto3" json:"balance_msat,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetBalanceResponse) Reset()         { *m = GetBalanceResponse{} }
+func (m *GetBalanceResponse) String() string { return proto.CompactTextString(m) }
+func (*GetBalanceResponse) ProtoMessage()    {}
+func (*GetBalanceResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_1b40cafcd4234784, []int{25}
+}
+
+func (m *GetBalanceResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetBalanceResponse.Unmarshal(m, b)
+}
+func (m *GetBalanceResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetBalanceResponse.Marshal(b, m, deterministic)
+}
+func (m *GetBalanceResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetBalanceResponse.Merge(m, src)
+}
+func (m *GetBalanceResponse) XXX_Size() int {
+	return xxx_messageInfo_GetBalanceResponse.Size(m)
+}
+func (m *GetBalanceResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetBalanceResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetBalanceResponse proto.InternalMessageInfo
+
+func (m *GetBalanceResponse) GetBalanceMsat() int64 {
+	if m != nil {
+		return m.BalanceMsat
 	}
+	return 0
 }
 
 type FeeReport struct {
@@ -501,7 +1506,7 @@ func (m *FeeReport) Reset()         { *m = FeeReport{} }
 func (m *FeeReport) String() string { return proto.CompactTextString(m) }
 func (*FeeReport) ProtoMessage()    {}
 func (*FeeReport) Descriptor() ([]byte, []int) {
-	return fileDescriptor_1b40cafcd4234784, []int{8}
+	return fileDescriptor_1b40cafcd4234784, []int{26}
 }
 
 func (m *FeeReport) XXX_Unmarshal(b []byte) error {
@@ -544,13 +1549,15 @@ func (m *FeeReport) GetMsatPerDownloadedKB() int64 {
 }
 
 type FileSlot struct {
-	FileId               string   `protobuf:"bytes,1,opt,name=file_id,json=fileId,proto3" json:"file_id,omitempty"`
-	Filename             string   `protobuf:"bytes,2,opt,name=filename,proto3" json:"filename,omitempty"`
-	Description          string   `protobuf:"bytes,3,opt,name=description,proto3" json:"description,omitempty"`
-	ShaChecksum          string   `protobuf:"bytes,4,opt,name=sha_checksum,json=shaChecksum,proto3" json:"sha_checksum,omitempty"`
-	Bytes                int64    `protobuf:"varint,5,opt,name=bytes,proto3" json:"bytes,omitempty"`
-	CreationDate         int64    `protobuf:"varint,6,opt,name=creation_date,json=creationDate,proto3" json:"creation_date,omitempty"`
-	DeletionDate         int64    `protobuf:"varint,7,opt,name=deletion_date,json=deletionDate,proto3" json:"deletion_date,omitempty"`
+	FileId       string `protobuf:"bytes,1,opt,name=file_id,json=fileId,proto3" json:"file_id,omitempty"`
+	Filename     string `protobuf:"bytes,2,opt,name=filename,proto3" json:"filename,omitempty"`
+	Description  string `protobuf:"bytes,3,opt,name=description,proto3" json:"description,omitempty"`
+	ShaChecksum  string `protobuf:"bytes,4,opt,name=sha_checksum,json=shaChecksum,proto3" json:"sha_checksum,omitempty"`
+	Bytes        int64  `protobuf:"varint,5,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	CreationDate int64  `protobuf:"varint,6,opt,name=creation_date,json=creationDate,proto3" json:"creation_date,omitempty"`
+	DeletionDate int64  `protobuf:"varint,7,opt,name=deletion_date,json=deletionDate,proto3" json:"deletion_date,omitempty"`
+	// size of the stored blob, smaller than bytes if it is compressed
+	PhysicalBytes        int64    `protobuf:"varint,8,opt,name=physical_bytes,json=physicalBytes,proto3" json:"physical_bytes,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -560,7 +1567,7 @@ func (m *FileSlot) Reset()         { *m = FileSlot{} }
 func (m *FileSlot) String() string { return proto.CompactTextString(m) }
 func (*FileSlot) ProtoMessage()    {}
 func (*FileSlot) Descriptor() ([]byte, []int) {
-	return fileDescriptor_1b40cafcd4234784, []int{9}
+	return fileDescriptor_1b40cafcd4234784, []int{27}
 }
 
 func (m *FileSlot) XXX_Unmarshal(b []byte) error {
@@ -630,10 +1637,23 @@ func (m *FileSlot) GetDeletionDate() int64 {
 	return 0
 }
 
+func (m *FileSlot) GetPhysicalBytes() int64 {
+	if m != nil {
+		return m.PhysicalBytes
+	}
+	return 0
+}
+
 type NewFileSlot struct {
-	DeletionDate         int64    `protobuf:"varint,1,opt,name=deletion_date,json=deletionDate,proto3" json:"deletion_date,omitempty"`
-	Filename             string   `protobuf:"bytes,2,opt,name=filename,proto3" json:"filename,omitempty"`
-	Description          string   `protobuf:"bytes,3,opt,name=description,proto3" json:"description,omitempty"`
+	DeletionDate int64  `protobuf:"varint,1,opt,name=deletion_date,json=deletionDate,proto3" json:"deletion_date,omitempty"`
+	Filename     string `protobuf:"bytes,2,opt,name=filename,proto3" json:"filename,omitempty"`
+	Description  string `protobuf:"bytes,3,opt,name=description,proto3" json:"description,omitempty"`
+	// if set, the whole upload is paid with a single invoice and exactly
+	// this many bytes have to be uploaded
+	Bytes int64 `protobuf:"varint,4,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	// optional hex encoded sha256 checksum of the file, checked after
+	// an upload with declared bytes
+	ShaChecksum          string   `protobuf:"bytes,5,opt,name=sha_checksum,json=shaChecksum,proto3" json:"sha_checksum,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -643,7 +1663,7 @@ func (m *NewFileSlot) Reset()         { *m = NewFileSlot{} }
 func (m *NewFileSlot) String() string { return proto.CompactTextString(m) }
 func (*NewFileSlot) ProtoMessage()    {}
 func (*NewFileSlot) Descriptor() ([]byte, []int) {
-	return fileDescriptor_1b40cafcd4234784, []int{10}
+	return fileDescriptor_1b40cafcd4234784, []int{28}
 }
 
 func (m *NewFileSlot) XXX_Unmarshal(b []byte) error {
@@ -685,6 +1705,20 @@ func (m *NewFileSlot) GetDescription() string {
 	return ""
 }
 
+func (m *NewFileSlot) GetBytes() int64 {
+	if m != nil {
+		return m.Bytes
+	}
+	return 0
+}
+
+func (m *NewFileSlot) GetShaChecksum() string {
+	if m != nil {
+		return m.ShaChecksum
+	}
+	return ""
+}
+
 type FileChunk struct {
 	Content              []byte   `protobuf:"bytes,1,opt,name=content,proto3" json:"content,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
@@ -696,7 +1730,7 @@ func (m *FileChunk) Reset()         { *m = FileChunk{} }
 func (m *FileChunk) String() string { return proto.CompactTextString(m) }
 func (*FileChunk) ProtoMessage()    {}
 func (*FileChunk) Descriptor() ([]byte, []int) {
-	return fileDescriptor_1b40cafcd4234784, []int{11}
+	return fileDescriptor_1b40cafcd4234784, []int{29}
 }
 
 func (m *FileChunk) XXX_Unmarshal(b []byte) error {
@@ -725,7 +1759,9 @@ func (m *FileChunk) GetContent() []byte {
 }
 
 type InvoiceResponse struct {
-	Invoice              string   `protobuf:"bytes,1,opt,name=invoice,proto3" json:"invoice,omitempty"`
+	Invoice string `protobuf:"bytes,1,opt,name=invoice,proto3" json:"invoice,omitempty"`
+	// true if the amount was debited from the prepaid balance
+	Prepaid              bool     `protobuf:"varint,2,opt,name=prepaid,proto3" json:"prepaid,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -735,7 +1771,7 @@ func (m *InvoiceResponse) Reset()         { *m = InvoiceResponse{} }
 func (m *InvoiceResponse) String() string { return proto.CompactTextString(m) }
 func (*InvoiceResponse) ProtoMessage()    {}
 func (*InvoiceResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_1b40cafcd4234784, []int{12}
+	return fileDescriptor_1b40cafcd4234784, []int{30}
 }
 
 func (m *InvoiceResponse) XXX_Unmarshal(b []byte) error {
@@ -763,6 +1799,13 @@ func (m *InvoiceResponse) GetInvoice() string {
 	return ""
 }
 
+func (m *InvoiceResponse) GetPrepaid() bool {
+	if m != nil {
+		return m.Prepaid
+	}
+	return false
+}
+
 type Empty struct {
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
@@ -773,7 +1816,7 @@ func (m *Empty) Reset()         { *m = Empty{} }
 func (m *Empty) String() string { return proto.CompactTextString(m) }
 func (*Empty) ProtoMessage()    {}
 func (*Empty) Descriptor() ([]byte, []int) {
-	return fileDescriptor_1b40cafcd4234784, []int{13}
+	return fileDescriptor_1b40cafcd4234784, []int{31}
 }
 
 func (m *Empty) XXX_Unmarshal(b []byte) error {
@@ -795,14 +1838,33 @@ func (m *Empty) XXX_DiscardUnknown() {
 var xxx_messageInfo_Empty proto.InternalMessageInfo
 
 func init() {
+	proto.RegisterEnum("api.FeeBasis", FeeBasis_name, FeeBasis_value)
 	proto.RegisterType((*GetInfoRequest)(nil), "api.GetInfoRequest")
 	proto.RegisterType((*GetInfoResponse)(nil), "api.GetInfoResponse")
+	proto.RegisterType((*NodeIdentity)(nil), "api.NodeIdentity")
+	proto.RegisterType((*TlsIdentity)(nil), "api.TlsIdentity")
+	proto.RegisterType((*Storage)(nil), "api.Storage")
+	proto.RegisterType((*Limits)(nil), "api.Limits")
+	proto.RegisterType((*GetChallengeRequest)(nil), "api.GetChallengeRequest")
+	proto.RegisterType((*GetChallengeResponse)(nil), "api.GetChallengeResponse")
+	proto.RegisterType((*AuthenticateRequest)(nil), "api.AuthenticateRequest")
+	proto.RegisterType((*AuthenticateResponse)(nil), "api.AuthenticateResponse")
 	proto.RegisterType((*ListFilesRequest)(nil), "api.ListFilesRequest")
 	proto.RegisterType((*ListFilesResponse)(nil), "api.ListFilesResponse")
 	proto.RegisterType((*UploadFileRequest)(nil), "api.UploadFileRequest")
 	proto.RegisterType((*UploadFileResponse)(nil), "api.UploadFileResponse")
+	proto.RegisterType((*ResumeUpload)(nil), "api.ResumeUpload")
+	proto.RegisterType((*UploadSession)(nil), "api.UploadSession")
 	proto.RegisterType((*DownloadFileRequest)(nil), "api.DownloadFileRequest")
 	proto.RegisterType((*DownloadFileResponse)(nil), "api.DownloadFileResponse")
+	proto.RegisterType((*DeleteFileRequest)(nil), "api.DeleteFileRequest")
+	proto.RegisterType((*DeleteFileResponse)(nil), "api.DeleteFileResponse")
+	proto.RegisterType((*ExtendFileRequest)(nil), "api.ExtendFileRequest")
+	proto.RegisterType((*ExtendFileResponse)(nil), "api.ExtendFileResponse")
+	proto.RegisterType((*TopUpRequest)(nil), "api.TopUpRequest")
+	proto.RegisterType((*TopUpResponse)(nil), "api.TopUpResponse")
+	proto.RegisterType((*GetBalanceRequest)(nil), "api.GetBalanceRequest")
+	proto.RegisterType((*GetBalanceResponse)(nil), "api.GetBalanceResponse")
 	proto.RegisterType((*FeeReport)(nil), "api.FeeReport")
 	proto.RegisterType((*FileSlot)(nil), "api.FileSlot")
 	proto.RegisterType((*NewFileSlot)(nil), "api.NewFileSlot")
@@ -814,54 +1876,101 @@ func init() {
 func init() { proto.RegisterFile("api/api.proto", fileDescriptor_1b40cafcd4234784) }
 
 var fileDescriptor_1b40cafcd4234784 = []byte{
-	// 739 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x55, 0xcd, 0x4e, 0x1b, 0x49,
-	0x10, 0xf6, 0x60, 0x8c, 0x99, 0xb2, 0x0d, 0xa6, 0x31, 0xcb, 0xac, 0x4f, 0xec, 0xb0, 0xb0, 0x96,
-	0x76, 0xb1, 0x59, 0x96, 0xc3, 0x6a, 0x4f, 0x1b, 0xf3, 0x13, 0x23, 0xa2, 0x08, 0x75, 0x94, 0x4b,
-	0x2e, 0xa3, 0xf1, 0x4c, 0x39, 0x6e, 0x79, 0x3c, 0x3d, 0x99, 0x6e, 0x1b, 0xf1, 0x00, 0xb9, 0xe6,
-	0x18, 0xe5, 0xb5, 0xf2, 0x0e, 0x79, 0x90, 0xa8, 0x7b, 0x7e, 0x18, 0xdb, 0x44, 0x42, 0xca, 0xcd,
-	0xfd, 0xd5, 0xf7, 0x95, 0xbf, 0xaa, 0xae, 0xae, 0x81, 0x86, 0x1b, 0xb1, 0x9e, 0x1b, 0xb1, 0x6e,
-	0x14, 0x73, 0xc9, 0x49, 0xd9, 0x8d, 0x98, 0xdd, 0x84, 0xad, 0x97, 0x28, 0x6f, 0xc2, 0x11, 0xa7,
-	0xf8, 0x61, 0x86, 0x42, 0xda, 0xff, 0xc3, 0x76, 0x8e, 0x88, 0x88, 0x87, 0x02, 0xc9, 0x09, 0xc0,
-	0x08, 0xd1, 0x89, 0x31, 0xe2, 0xb1, 0xb4, 0x8c, 0x03, 0xa3, 0x53, 0x3b, 0xdb, 0xea, 0xaa, 0x4c,
-	0xd7, 0x88, 0x54, 0xa3, 0xd4, 0x1c, 0x65, 0x3f, 0x6d, 0x02, 0xcd, 0x57, 0x4c, 0xc8, 0x6b, 0x16,
-	0xa0, 0xc8, 0xb2, 0xfe, 0x0b, 0x3b, 0x05, 0x2c, 0xcd, 0x7b, 0x08, 0x95, 0x91, 0x02, 0x2c, 0xe3,
-	0xa0, 0xdc, 0xa9, 0x9d, 0x35, 0x92, 0x94, 0x2c, 0xc0, 0x37, 0x01, 0x97, 0x34, 0x89, 0xd9, 0x9f,
-	0x0d, 0xd8, 0x79, 0x1b, 0x05, 0xdc, 0xf5, 0x55, 0x24, 0xcd, 0x47, 0x8e, 0x61, 0x5d, 0x04, 0x3c,
-	0x33, 0xd3, 0xd4, 0xca, 0xd7, 0x78, 0x9f, 0x89, 0x07, 0x25, 0xaa, 0xe3, 0xe4, 0x18, 0x2a, 0xde,
-	0x78, 0x16, 0x4e, 0xac, 0xb5, 0xa2, 0x6b, 0x16, 0xe0, 0x85, 0x42, 0x07, 0x25, 0x9a, 0x84, 0x49,
-	0x07, 0x36, 0x47, 0x2c, 0x64, 0x62, 0x8c, 0xbe, 0x55, 0xd6, 0x54, 0xd0, 0xd4, 0xab, 0x69, 0x24,
-	0x1f, 0x06, 0x25, 0x9a, 0x47, 0xfb, 0x55, 0xa8, 0xe0, 0x1c, 0x43, 0x69, 0x7f, 0x34, 0x80, 0x14,
-	0x8d, 0xa5, 0x45, 0x9d, 0x42, 0x95, 0x85, 0x73, 0xce, 0x3c, 0x4c, 0xcd, 0xb5, 0x74, 0xa2, 0x9b,
-	0x04, 0xcb, 0x68, 0x83, 0x12, 0xcd, 0x68, 0xe4, 0x1c, 0x1a, 0x59, 0x76, 0x47, 0xd5, 0x9c, 0x7a,
-	0x5d, 0x6c, 0xc7, 0xa0, 0x44, 0xeb, 0x19, 0x4b, 0x61, 0x8f, 0x3e, 0xba, 0xb0, 0x7b, 0xc9, 0xef,
-	0xc3, 0xe5, 0x0e, 0xed, 0x43, 0x55, 0x25, 0x73, 0x98, 0xaf, 0x7d, 0x98, 0x74, 0x43, 0x1d, 0x6f,
-	0x7c, 0xfb, 0xab, 0x01, 0xad, 0x45, 0x41, 0xea, 0xfc, 0x2f, 0x30, 0x13, 0x45, 0x38, 0xe2, 0xa9,
-	0xf7, 0x15, 0x0f, 0x9b, 0x3a, 0x49, 0x38, 0xe2, 0xc5, 0x3a, 0xd7, 0x9e, 0x57, 0x67, 0x7e, 0x17,
-	0xe5, 0xe7, 0xdf, 0xc5, 0xfa, 0xf3, 0xee, 0xe2, 0x8b, 0x01, 0x66, 0x3e, 0x8b, 0xe4, 0x77, 0xd8,
-	0x9a, 0x0a, 0x57, 0x3a, 0x43, 0x57, 0xa0, 0xe3, 0x71, 0x91, 0x8c, 0x49, 0x99, 0xd6, 0x15, 0xda,
-	0x77, 0x05, 0x5e, 0x70, 0x21, 0x49, 0x0f, 0xf6, 0x34, 0x2b, 0xc2, 0xd8, 0x19, 0xf3, 0x59, 0xac,
-	0x7f, 0x4c, 0x9c, 0xa1, 0x2e, 0xa7, 0x4c, 0x9b, 0x2a, 0x78, 0x87, 0xf1, 0x80, 0xcf, 0xe2, 0x3b,
-	0x8c, 0x6f, 0xfb, 0xe4, 0x1c, 0xf6, 0x73, 0x81, 0x9f, 0x36, 0x10, 0x7d, 0x2d, 0x29, 0x6b, 0xc9,
-	0x6e, 0x2a, 0xb9, 0xcc, 0x83, 0xb7, 0x7d, 0xfb, 0x9b, 0x01, 0x9b, 0x59, 0x03, 0x7f, 0x78, 0x29,
-	0xa4, 0x0d, 0xba, 0xb3, 0xa1, 0x3b, 0x4d, 0xda, 0x69, 0xd2, 0xfc, 0x4c, 0x0e, 0xa0, 0xe6, 0xa3,
-	0xf0, 0x62, 0x16, 0x49, 0xc6, 0x43, 0xfd, 0x5f, 0x26, 0x2d, 0x42, 0xe4, 0x37, 0xa8, 0x8b, 0xb1,
-	0xeb, 0x78, 0x63, 0xf4, 0x26, 0x62, 0x36, 0xd5, 0x5d, 0x33, 0x69, 0x4d, 0x8c, 0xdd, 0x8b, 0x14,
-	0x22, 0x2d, 0xa8, 0x0c, 0x1f, 0x24, 0x0a, 0xab, 0xa2, 0xad, 0x26, 0x07, 0x72, 0x08, 0x0d, 0x2f,
-	0x46, 0x57, 0x25, 0x71, 0x7c, 0x57, 0xa2, 0xb5, 0x91, 0x34, 0x2a, 0x03, 0x2f, 0x5d, 0xa9, 0x9e,
-	0x69, 0xc3, 0xc7, 0x00, 0x1f, 0x49, 0xd5, 0x84, 0x94, 0x81, 0x8a, 0x64, 0x47, 0x50, 0x2b, 0xbc,
-	0xbf, 0x55, 0x8d, 0xb1, 0xaa, 0xf9, 0xb9, 0xa2, 0xed, 0x23, 0x30, 0xf3, 0xe1, 0x21, 0x16, 0x54,
-	0x3d, 0x1e, 0x4a, 0x0c, 0x93, 0xbb, 0xae, 0xd3, 0xec, 0x68, 0xff, 0x09, 0xdb, 0x4b, 0x33, 0xa9,
-	0xc8, 0xc5, 0x27, 0x6a, 0xe6, 0x23, 0x6a, 0x57, 0xa1, 0xa2, 0xa7, 0xec, 0xec, 0xd3, 0x1a, 0x34,
-	0xef, 0x62, 0x36, 0x77, 0x25, 0xea, 0x9a, 0x24, 0x8f, 0xd5, 0x43, 0xad, 0xa6, 0xab, 0x91, 0xec,
-	0xea, 0x89, 0x5c, 0x5c, 0x9d, 0xed, 0xd6, 0x22, 0x98, 0xfe, 0xdb, 0x7f, 0x60, 0xe6, 0xab, 0x8f,
-	0xec, 0x69, 0xca, 0xf2, 0x7a, 0x6c, 0xff, 0xb2, 0x0c, 0xa7, 0xda, 0x17, 0x00, 0x8f, 0x2b, 0x86,
-	0x24, 0xac, 0x95, 0x65, 0xd8, 0xde, 0x5f, 0xc1, 0x13, 0x79, 0xc7, 0x38, 0x35, 0xc8, 0x15, 0xd4,
-	0x8b, 0xaf, 0x9d, 0x58, 0x9a, 0xfc, 0xc4, 0xc6, 0x68, 0xff, 0xfa, 0x44, 0x24, 0x49, 0x74, 0x6a,
-	0xf4, 0xff, 0x78, 0x77, 0xf4, 0x9e, 0xc9, 0xf1, 0x6c, 0xd8, 0xf5, 0xf8, 0xb4, 0x27, 0xa2, 0x99,
-	0x0c, 0xff, 0xf6, 0x26, 0xbd, 0x20, 0x3c, 0xd1, 0x6b, 0x1a, 0xe3, 0x39, 0xc6, 0xea, 0xe3, 0x32,
-	0xdc, 0xd0, 0x5f, 0x97, 0x7f, 0xbe, 0x07, 0x00, 0x00, 0xff, 0xff, 0x8d, 0x5f, 0xc6, 0x9f, 0x6e,
-	0x06, 0x00, 0x00,
+	// 1497 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x57, 0xcd, 0x6e, 0xdb, 0xc6,
+	0x16, 0x36, 0x25, 0xcb, 0x92, 0x8e, 0x24, 0xff, 0x8c, 0x95, 0x58, 0xd6, 0xcd, 0x22, 0x97, 0xb9,
+	0x71, 0x7c, 0xf3, 0x63, 0x3b, 0x4e, 0x70, 0x6f, 0x51, 0xa0, 0x28, 0x22, 0xdb, 0xb1, 0x8c, 0x38,
+	0xa9, 0x4b, 0x27, 0x28, 0x52, 0xa0, 0x15, 0x46, 0xd4, 0xc8, 0x1a, 0x98, 0x22, 0x59, 0xce, 0xc8,
+	0xb1, 0x03, 0x14, 0x5d, 0x17, 0x7d, 0x81, 0xbe, 0x42, 0x57, 0x5d, 0xf5, 0x09, 0xfa, 0x04, 0x7d,
+	0x9d, 0xae, 0x8a, 0xf9, 0x23, 0x47, 0x96, 0x9c, 0x1a, 0xe9, 0x8e, 0xf3, 0xcd, 0x77, 0xce, 0x9c,
+	0xbf, 0x99, 0x73, 0x08, 0x35, 0x1c, 0xd3, 0x4d, 0x1c, 0xd3, 0x8d, 0x38, 0x89, 0x78, 0x84, 0xf2,
+	0x38, 0xa6, 0xee, 0x1a, 0xcc, 0xef, 0x13, 0x7e, 0x10, 0xf6, 0x23, 0x8f, 0x7c, 0x37, 0x22, 0x8c,
+	0xa3, 0x3a, 0x14, 0xc2, 0x28, 0xf4, 0x49, 0xc3, 0xb9, 0xed, 0xac, 0x97, 0x3d, 0xb5, 0x70, 0xff,
+	0x74, 0x60, 0x21, 0x25, 0xb2, 0x38, 0x0a, 0x19, 0x41, 0x8f, 0x00, 0xfa, 0x84, 0x74, 0x12, 0x12,
+	0x47, 0x09, 0x97, 0xf4, 0xca, 0xf6, 0xfc, 0x86, 0x38, 0xe0, 0x39, 0x21, 0x9e, 0x44, 0xbd, 0x72,
+	0xdf, 0x7c, 0xa2, 0x3b, 0x30, 0x17, 0xd0, 0x21, 0xe5, 0xac, 0x91, 0x93, 0xd4, 0x8a, 0xa4, 0x1e,
+	0x4a, 0xc8, 0xd3, 0x5b, 0x68, 0x0d, 0x8a, 0x8c, 0x47, 0x09, 0x3e, 0x21, 0x8d, 0xbc, 0x64, 0x55,
+	0x25, 0xeb, 0x58, 0x61, 0x9e, 0xd9, 0x44, 0x4f, 0xa0, 0xca, 0x03, 0xd6, 0xa1, 0x3d, 0x12, 0x72,
+	0xca, 0x2f, 0x1a, 0xb3, 0x92, 0xbc, 0x28, 0xc9, 0xaf, 0x03, 0x76, 0xa0, 0x71, 0xaf, 0xc2, 0xb3,
+	0x05, 0xfa, 0x1f, 0xd4, 0xc2, 0xa8, 0x47, 0x32, 0xa9, 0x82, 0x94, 0x5a, 0x92, 0x52, 0xaf, 0xa2,
+	0x1e, 0x49, 0xc5, 0xaa, 0xa1, 0xb5, 0x72, 0x39, 0x54, 0xed, 0x5d, 0x74, 0x13, 0xe6, 0xe2, 0x51,
+	0xf7, 0x94, 0x5c, 0xe8, 0x18, 0xe9, 0x95, 0x08, 0x1d, 0x0e, 0x28, 0x56, 0x0e, 0x96, 0x3d, 0xb5,
+	0x40, 0x0d, 0x28, 0x9e, 0x91, 0x84, 0xd1, 0x28, 0x94, 0x2e, 0x95, 0x3d, 0xb3, 0x44, 0xb7, 0xa0,
+	0xcc, 0xe8, 0x49, 0x88, 0xf9, 0x28, 0x21, 0xd2, 0x83, 0xb2, 0x97, 0x01, 0xee, 0x4b, 0xa8, 0x58,
+	0x9e, 0xa0, 0xdb, 0x50, 0xe9, 0xd3, 0xf0, 0x84, 0x24, 0x71, 0x42, 0x43, 0xae, 0x4f, 0xb6, 0xa1,
+	0x71, 0x75, 0xb9, 0xcb, 0xea, 0xbe, 0x82, 0xa2, 0x8e, 0xa2, 0x50, 0xe5, 0x47, 0xc3, 0x38, 0x21,
+	0x4c, 0x5a, 0xa5, 0x55, 0x59, 0x10, 0xba, 0x0f, 0x22, 0x71, 0x9d, 0x2e, 0x66, 0x54, 0x79, 0x33,
+	0xbf, 0x5d, 0x33, 0x99, 0x6d, 0x09, 0xd0, 0x2b, 0xf5, 0xf5, 0x97, 0xfb, 0xab, 0x03, 0x73, 0x2a,
+	0x8b, 0xe8, 0x01, 0xa0, 0x21, 0x3e, 0xef, 0x74, 0x2f, 0x38, 0x61, 0x9d, 0x98, 0x24, 0x9d, 0x11,
+	0x23, 0x89, 0xd4, 0x9f, 0xf7, 0x16, 0x86, 0xf8, 0xbc, 0x25, 0x36, 0x8e, 0x48, 0xf2, 0x86, 0x91,
+	0xc4, 0x90, 0xfb, 0x34, 0xb0, 0xc9, 0xb9, 0x94, 0xfc, 0x9c, 0x06, 0x19, 0xd9, 0x85, 0x9a, 0x21,
+	0x77, 0x18, 0x7d, 0xaf, 0xaa, 0x23, 0xef, 0x55, 0x34, 0xef, 0x98, 0xbe, 0x27, 0xe8, 0x1e, 0x2c,
+	0xe0, 0x33, 0x4c, 0x03, 0xdc, 0x0d, 0x88, 0xb2, 0x41, 0x06, 0x35, 0xef, 0xcd, 0xa7, 0xb0, 0x34,
+	0xc0, 0xbd, 0x01, 0xcb, 0xfb, 0x84, 0xef, 0x0c, 0x70, 0x10, 0x90, 0xf0, 0x84, 0xe8, 0xca, 0x77,
+	0x0f, 0xa1, 0x3e, 0x0e, 0xeb, 0x3a, 0xbf, 0x05, 0x65, 0xdf, 0x80, 0x3a, 0x58, 0x19, 0x20, 0x8a,
+	0x81, 0x9c, 0xc7, 0x34, 0xb9, 0xd0, 0xa6, 0xeb, 0x95, 0xfb, 0x0d, 0x2c, 0x3f, 0x1b, 0xf1, 0x81,
+	0xc8, 0x9e, 0x8f, 0xb9, 0x39, 0xe4, 0xca, 0xda, 0x19, 0x3b, 0x24, 0x77, 0xf9, 0x90, 0x45, 0xc8,
+	0x33, 0x7a, 0xa2, 0xeb, 0x47, 0x7c, 0xba, 0xbb, 0x50, 0x1f, 0x57, 0xaf, 0x8d, 0xad, 0x43, 0x81,
+	0x47, 0xa7, 0xc4, 0x64, 0x55, 0x2d, 0xae, 0x34, 0x12, 0xc1, 0xe2, 0x21, 0x65, 0x5c, 0x86, 0xda,
+	0x84, 0xe1, 0x13, 0x58, 0xb2, 0x30, 0xad, 0xf6, 0x0e, 0x14, 0x64, 0xa2, 0x1a, 0xce, 0xed, 0xfc,
+	0x7a, 0xc5, 0x14, 0x83, 0x88, 0x7c, 0x10, 0x71, 0x4f, 0xed, 0xb9, 0xbf, 0x3b, 0xb0, 0xf4, 0x26,
+	0x0e, 0x22, 0xdc, 0x13, 0x3b, 0xc6, 0xe3, 0x35, 0x98, 0x65, 0x41, 0x64, 0x1e, 0x08, 0x75, 0x45,
+	0x5f, 0x91, 0x77, 0x46, 0xb8, 0x3d, 0xe3, 0xc9, 0x7d, 0xb4, 0x06, 0x05, 0x7f, 0x30, 0x0a, 0x4f,
+	0x1b, 0x39, 0xfb, 0x25, 0xa1, 0x01, 0xd9, 0x11, 0x68, 0x7b, 0xc6, 0x53, 0xdb, 0x68, 0x1d, 0x4a,
+	0x7d, 0x1a, 0x52, 0x36, 0x20, 0x3d, 0xfd, 0x46, 0x80, 0xa4, 0xee, 0x0d, 0x63, 0x7e, 0xd1, 0x9e,
+	0xf1, 0xd2, 0x5d, 0xf4, 0x00, 0xe6, 0x12, 0xc2, 0x46, 0x43, 0xd2, 0x98, 0xb5, 0x2e, 0xba, 0x27,
+	0x21, 0x65, 0x67, 0x7b, 0xc6, 0xd3, 0x94, 0x56, 0x11, 0x0a, 0xe4, 0x8c, 0x84, 0xdc, 0xfd, 0xcd,
+	0x01, 0x64, 0x7b, 0xa1, 0x23, 0xb0, 0x05, 0x45, 0x1a, 0x9e, 0x45, 0x54, 0xbf, 0x8c, 0x95, 0xed,
+	0xba, 0xd4, 0x76, 0xa0, 0x30, 0x43, 0x6b, 0xcf, 0x78, 0x86, 0x86, 0x9e, 0x42, 0xcd, 0x98, 0x22,
+	0x0b, 0x57, 0x3b, 0x36, 0x1e, 0xbb, 0xf6, 0x8c, 0x57, 0x35, 0x2c, 0x81, 0xa1, 0x0d, 0x28, 0x32,
+	0x7d, 0x31, 0x95, 0x77, 0x48, 0xf2, 0x95, 0x45, 0xc7, 0x6a, 0x47, 0x9c, 0xa2, 0x49, 0x99, 0xdd,
+	0x0f, 0xa0, 0x6a, 0xbb, 0x86, 0xfe, 0x05, 0xe5, 0x91, 0xfc, 0xea, 0xd0, 0x9e, 0xae, 0x86, 0x92,
+	0x02, 0x0e, 0x7a, 0xee, 0x2e, 0xd4, 0xc6, 0x34, 0x7e, 0x90, 0x2d, 0xca, 0x27, 0xea, 0xf7, 0x19,
+	0xe1, 0xa6, 0x7c, 0xd4, 0xca, 0xfd, 0x16, 0x96, 0x77, 0xa3, 0x77, 0xe1, 0xe5, 0x8c, 0xaf, 0x40,
+	0x51, 0x5e, 0xd4, 0x54, 0xd3, 0x9c, 0x58, 0x5e, 0xad, 0x47, 0xe0, 0xa2, 0xce, 0xf9, 0x40, 0x5f,
+	0x6b, 0xbd, 0x72, 0xff, 0x70, 0xa0, 0x3e, 0x7e, 0x80, 0x4e, 0xc6, 0x43, 0x28, 0xab, 0x13, 0xc2,
+	0x7e, 0xd4, 0x70, 0xa6, 0x87, 0xb5, 0x24, 0x0f, 0x0d, 0xfb, 0x91, 0x9d, 0xba, 0xdc, 0xf5, 0x52,
+	0x97, 0xd6, 0x62, 0xfe, 0xfa, 0xb5, 0x38, 0xfb, 0xa1, 0x5a, 0xcc, 0xd2, 0xf4, 0x10, 0x96, 0x76,
+	0x49, 0x40, 0x38, 0xb9, 0x4e, 0xc4, 0xdc, 0x3a, 0x20, 0x9b, 0xad, 0x2c, 0x75, 0xbf, 0x84, 0xa5,
+	0xbd, 0x73, 0x4e, 0xc2, 0xeb, 0x45, 0xfd, 0x0e, 0xd4, 0x7a, 0x42, 0x07, 0x8d, 0xc2, 0x4e, 0x0f,
+	0x73, 0xa2, 0x83, 0x5f, 0x35, 0xe0, 0x2e, 0xe6, 0xc4, 0xfd, 0x1e, 0x90, 0xad, 0xf2, 0xa3, 0x8b,
+	0x7e, 0x2c, 0x33, 0xb9, 0xbf, 0xc9, 0x4c, 0x16, 0x95, 0xff, 0x42, 0xf5, 0x75, 0x14, 0xbf, 0x89,
+	0x8d, 0x33, 0xab, 0x50, 0xc2, 0x43, 0xde, 0x19, 0x32, 0xcc, 0x75, 0xff, 0x28, 0xe2, 0x21, 0x7f,
+	0xc9, 0x30, 0x77, 0x7f, 0x80, 0x9a, 0xa6, 0x7e, 0xb4, 0x91, 0x4f, 0xa0, 0xd8, 0xc5, 0x01, 0x0e,
+	0xd3, 0x82, 0x58, 0x91, 0x12, 0xfb, 0x84, 0xb7, 0x14, 0x6c, 0x0b, 0x69, 0x66, 0x66, 0xeb, 0x32,
+	0x2c, 0xd9, 0x4c, 0xf5, 0x6a, 0xfe, 0x1f, 0xd0, 0xa4, 0x38, 0xfa, 0x37, 0x54, 0xb5, 0xb8, 0xed,
+	0x4a, 0x45, 0x63, 0xd2, 0x9d, 0x9f, 0x1d, 0x28, 0xa7, 0xf3, 0x12, 0xfa, 0x0f, 0xcc, 0x0b, 0xa2,
+	0xe8, 0xbc, 0xa4, 0xe3, 0x47, 0xcc, 0x88, 0x54, 0x05, 0xda, 0xc2, 0x8c, 0xec, 0x44, 0x8c, 0xa3,
+	0x4d, 0xb8, 0x21, 0x59, 0xa2, 0x6b, 0x0e, 0xa2, 0x51, 0x22, 0x3f, 0x4e, 0x3b, 0x5d, 0x9d, 0xd9,
+	0x45, 0xb1, 0x79, 0x44, 0x92, 0x76, 0x34, 0x4a, 0x8e, 0x48, 0xf2, 0xa2, 0x85, 0x9e, 0xc2, 0x4a,
+	0x2a, 0xd0, 0xd3, 0x17, 0x8a, 0xf4, 0xa4, 0x88, 0xba, 0x71, 0xcb, 0x5a, 0x64, 0x37, 0xdd, 0x7c,
+	0xd1, 0x72, 0x7f, 0xca, 0x41, 0xc9, 0xa4, 0xed, 0xea, 0xf2, 0x6a, 0x82, 0xcc, 0x67, 0x88, 0x87,
+	0xa6, 0x71, 0xa5, 0x6b, 0x31, 0x69, 0xf4, 0x08, 0xf3, 0x13, 0x1a, 0xf3, 0x6c, 0xfe, 0xb1, 0x21,
+	0x11, 0x21, 0x36, 0xc0, 0x1d, 0x7f, 0x40, 0xfc, 0x53, 0x36, 0x1a, 0xea, 0x31, 0xa8, 0xc2, 0x06,
+	0x78, 0x47, 0x43, 0xa2, 0xa5, 0xa9, 0x6e, 0x5e, 0x90, 0xa6, 0xaa, 0x85, 0xa8, 0x6a, 0x3f, 0x21,
+	0x38, 0xab, 0xea, 0x39, 0x15, 0x28, 0x03, 0x8a, 0xaa, 0x9e, 0x2c, 0xfd, 0xe2, 0x64, 0xe9, 0xa3,
+	0xbb, 0x30, 0x1f, 0x0f, 0x2e, 0x18, 0xf5, 0x71, 0xa0, 0xc7, 0x86, 0x92, 0x64, 0xd5, 0x0c, 0xaa,
+	0xa6, 0x86, 0x5f, 0x1c, 0xa8, 0x58, 0x7d, 0x6b, 0x52, 0xb7, 0x33, 0x45, 0xf7, 0x3f, 0x0b, 0x4e,
+	0xea, 0xf9, 0xac, 0xed, 0xf9, 0xe5, 0x90, 0x15, 0x26, 0x42, 0xe6, 0xde, 0x85, 0x72, 0xfa, 0x5a,
+	0x89, 0x01, 0xd4, 0x8f, 0x42, 0x4e, 0xf4, 0xd4, 0x58, 0xf5, 0xcc, 0xd2, 0xdd, 0x83, 0x85, 0x4b,
+	0xb7, 0x44, 0x90, 0xed, 0xcb, 0x54, 0xce, 0x2e, 0x4d, 0x03, 0x8a, 0x71, 0x42, 0x62, 0x4c, 0x7b,
+	0xd2, 0x93, 0x92, 0x67, 0x96, 0x6e, 0x11, 0x0a, 0xf2, 0xc1, 0xbb, 0xff, 0x18, 0x4a, 0x66, 0x40,
+	0x44, 0x4b, 0x50, 0x3b, 0xfc, 0x62, 0xff, 0x60, 0xe7, 0xd9, 0x61, 0xa7, 0xf5, 0xf6, 0xf5, 0xde,
+	0xf1, 0xe2, 0x0c, 0x42, 0x30, 0x7f, 0xd4, 0x7e, 0x7b, 0x6c, 0x61, 0xce, 0xf6, 0x8f, 0x05, 0x58,
+	0x3c, 0x4a, 0xe8, 0x19, 0x56, 0x4f, 0x9c, 0x18, 0x51, 0x45, 0xe7, 0x2c, 0xea, 0x9f, 0x0d, 0xb4,
+	0x6c, 0x6e, 0xa6, 0xf5, 0x8f, 0xd2, 0xac, 0x8f, 0x83, 0xda, 0xf4, 0x1d, 0xa8, 0xda, 0xf3, 0x1b,
+	0x6a, 0x18, 0xd6, 0xe5, 0x49, 0xaf, 0xb9, 0x3a, 0x65, 0x27, 0x53, 0x62, 0xcf, 0x55, 0x5a, 0xc9,
+	0x94, 0x49, 0xae, 0xb9, 0x3a, 0x65, 0x47, 0x2b, 0xf9, 0x14, 0xca, 0xe9, 0x08, 0x85, 0x6e, 0xe8,
+	0xff, 0x9c, 0xf1, 0x31, 0xab, 0x79, 0xf3, 0x32, 0xac, 0x65, 0x9f, 0x01, 0x64, 0xd3, 0x07, 0xba,
+	0x69, 0x35, 0x7f, 0xeb, 0xb1, 0x6f, 0xae, 0x4c, 0xe0, 0x4a, 0x7c, 0xdd, 0xd9, 0x72, 0xd0, 0x1e,
+	0x54, 0xed, 0xae, 0xa9, 0x7d, 0x98, 0xd2, 0xa9, 0x9b, 0xab, 0x53, 0x76, 0x94, 0xa2, 0x2d, 0x07,
+	0x7d, 0x06, 0x90, 0xf5, 0x1e, 0x6d, 0xc9, 0x44, 0xeb, 0x6a, 0xae, 0x4c, 0xe0, 0xda, 0x91, 0xcf,
+	0x01, 0xb2, 0x8e, 0xa2, 0xc5, 0x27, 0xba, 0x56, 0x73, 0x65, 0x02, 0x4f, 0xcf, 0xdf, 0x82, 0x82,
+	0x7c, 0xe8, 0x91, 0x9a, 0xdb, 0xec, 0xfe, 0xd0, 0x44, 0x36, 0x64, 0x5b, 0x9c, 0x3d, 0xc2, 0xfa,
+	0xc8, 0x89, 0xa7, 0xba, 0x79, 0xd5, 0x63, 0xdf, 0xba, 0xf7, 0xf5, 0xdd, 0x13, 0xca, 0x07, 0xa3,
+	0xee, 0x86, 0x1f, 0x0d, 0x37, 0x59, 0x3c, 0xe2, 0xe1, 0x63, 0xff, 0x74, 0x33, 0x08, 0x1f, 0xc9,
+	0xf9, 0x96, 0x24, 0x67, 0x24, 0x11, 0x3f, 0xd0, 0xdd, 0x39, 0xf9, 0x07, 0xfd, 0xe4, 0xaf, 0x01,
+	0x00, 0x95, 0xf1, 0x4a, 0xa0, 0x52, 0x0f, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -877,9 +1986,15 @@ const _ = grpc.SupportPackageIsVersion6
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
 type PrivateFileStoreClient interface {
 	GetInfo(ctx context.Context, in *GetInfoRequest, opts ...grpc.CallOption) (*GetInfoResponse, error)
+	GetChallenge(ctx context.Context, in *GetChallengeRequest, opts ...grpc.CallOption) (*GetChallengeResponse, error)
+	Authenticate(ctx context.Context, in *AuthenticateRequest, opts ...grpc.CallOption) (*AuthenticateResponse, error)
 	ListFiles(ctx context.Context, in *ListFilesRequest, opts ...grpc.CallOption) (*ListFilesResponse, error)
 	UploadFile(ctx context.Context, opts ...grpc.CallOption) (PrivateFileStore_UploadFileClient, error)
 	DownloadFile(ctx context.Context, in *DownloadFileRequest, opts ...grpc.CallOption) (PrivateFileStore_DownloadFileClient, error)
+	DeleteFile(ctx context.Context, in *DeleteFileRequest, opts ...grpc.CallOption) (*DeleteFileResponse, error)
+	ExtendFile(ctx context.Context, in *ExtendFileRequest, opts ...grpc.CallOption) (PrivateFileStore_ExtendFileClient, error)
+	TopUp(ctx context.Context, in *TopUpRequest, opts ...grpc.CallOption) (PrivateFileStore_TopUpClient, error)
+	GetBalance(ctx context.Context, in *GetBalanceRequest, opts ...grpc.CallOption) (*GetBalanceResponse, error)
 }
 
 type privateFileStoreClient struct {
@@ -899,6 +2014,24 @@ func (c *privateFileStoreClient) GetInfo(ctx context.Context, in *GetInfoRequest
 	return out, nil
 }
 
+func (c *privateFileStoreClient) GetChallenge(ctx context.Context, in *GetChallengeRequest, opts ...grpc.CallOption) (*GetChallengeResponse, error) {
+	out := new(GetChallengeResponse)
+	err := c.cc.Invoke(ctx, "/api.PrivateFileStore/GetChallenge", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *privateFileStoreClient) Authenticate(ctx context.Context, in *AuthenticateRequest, opts ...grpc.CallOption) (*AuthenticateResponse, error) {
+	out := new(AuthenticateResponse)
+	err := c.cc.Invoke(ctx, "/api.PrivateFileStore/Authenticate", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *privateFileStoreClient) ListFiles(ctx context.Context, in *ListFilesRequest, opts ...grpc.CallOption) (*ListFilesResponse, error) {
 	out := new(ListFilesResponse)
 	err := c.cc.Invoke(ctx, "/api.PrivateFileStore/ListFiles", in, out, opts...)
@@ -971,12 +2104,100 @@ func (x *privateFileStoreDownloadFileClient) Recv() (*DownloadFileResponse, erro
 	return m, nil
 }
 
+func (c *privateFileStoreClient) DeleteFile(ctx context.Context, in *DeleteFileRequest, opts ...grpc.CallOption) (*DeleteFileResponse, error) {
+	out := new(DeleteFileResponse)
+	err := c.cc.Invoke(ctx, "/api.PrivateFileStore/DeleteFile", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *privateFileStoreClient) ExtendFile(ctx context.Context, in *ExtendFileRequest, opts ...grpc.CallOption) (PrivateFileStore_ExtendFileClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_PrivateFileStore_serviceDesc.Streams[2], "/api.PrivateFileStore/ExtendFile", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &privateFileStoreExtendFileClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type PrivateFileStore_ExtendFileClient interface {
+	Recv() (*ExtendFileResponse, error)
+	grpc.ClientStream
+}
+
+type privateFileStoreExtendFileClient struct {
+	grpc.ClientStream
+}
+
+func (x *privateFileStoreExtendFileClient) Recv() (*ExtendFileResponse, error) {
+	m := new(ExtendFileResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *privateFileStoreClient) TopUp(ctx context.Context, in *TopUpRequest, opts ...grpc.CallOption) (PrivateFileStore_TopUpClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_PrivateFileStore_serviceDesc.Streams[3], "/api.PrivateFileStore/TopUp", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &privateFileStoreTopUpClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type PrivateFileStore_TopUpClient interface {
+	Recv() (*TopUpResponse, error)
+	grpc.ClientStream
+}
+
+type privateFileStoreTopUpClient struct {
+	grpc.ClientStream
+}
+
+func (x *privateFileStoreTopUpClient) Recv() (*TopUpResponse, error) {
+	m := new(TopUpResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *privateFileStoreClient) GetBalance(ctx context.Context, in *GetBalanceRequest, opts ...grpc.CallOption) (*GetBalanceResponse, error) {
+	out := new(GetBalanceResponse)
+	err := c.cc.Invoke(ctx, "/api.PrivateFileStore/GetBalance", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // PrivateFileStoreServer is the server API for PrivateFileStore service.
 type PrivateFileStoreServer interface {
 	GetInfo(context.Context, *GetInfoRequest) (*GetInfoResponse, error)
+	GetChallenge(context.Context, *GetChallengeRequest) (*GetChallengeResponse, error)
+	Authenticate(context.Context, *AuthenticateRequest) (*AuthenticateResponse, error)
 	ListFiles(context.Context, *ListFilesRequest) (*ListFilesResponse, error)
 	UploadFile(PrivateFileStore_UploadFileServer) error
 	DownloadFile(*DownloadFileRequest, PrivateFileStore_DownloadFileServer) error
+	DeleteFile(context.Context, *DeleteFileRequest) (*DeleteFileResponse, error)
+	ExtendFile(*ExtendFileRequest, PrivateFileStore_ExtendFileServer) error
+	TopUp(*TopUpRequest, PrivateFileStore_TopUpServer) error
+	GetBalance(context.Context, *GetBalanceRequest) (*GetBalanceResponse, error)
 }
 
 // UnimplementedPrivateFileStoreServer can be embedded to have forward compatible implementations.
@@ -986,6 +2207,12 @@ type UnimplementedPrivateFileStoreServer struct {
 func (*UnimplementedPrivateFileStoreServer) GetInfo(ctx context.Context, req *GetInfoRequest) (*GetInfoResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetInfo not implemented")
 }
+func (*UnimplementedPrivateFileStoreServer) GetChallenge(ctx context.Context, req *GetChallengeRequest) (*GetChallengeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetChallenge not implemented")
+}
+func (*UnimplementedPrivateFileStoreServer) Authenticate(ctx context.Context, req *AuthenticateRequest) (*AuthenticateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Authenticate not implemented")
+}
 func (*UnimplementedPrivateFileStoreServer) ListFiles(ctx context.Context, req *ListFilesRequest) (*ListFilesResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ListFiles not implemented")
 }
@@ -995,6 +2222,18 @@ func (*UnimplementedPrivateFileStoreServer) UploadFile(srv PrivateFileStore_Uplo
 func (*UnimplementedPrivateFileStoreServer) DownloadFile(req *DownloadFileRequest, srv PrivateFileStore_DownloadFileServer) error {
 	return status.Errorf(codes.Unimplemented, "method DownloadFile not implemented")
 }
+func (*UnimplementedPrivateFileStoreServer) DeleteFile(ctx context.Context, req *DeleteFileRequest) (*DeleteFileResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteFile not implemented")
+}
+func (*UnimplementedPrivateFileStoreServer) ExtendFile(req *ExtendFileRequest, srv PrivateFileStore_ExtendFileServer) error {
+	return status.Errorf(codes.Unimplemented, "method ExtendFile not implemented")
+}
+func (*UnimplementedPrivateFileStoreServer) TopUp(req *TopUpRequest, srv PrivateFileStore_TopUpServer) error {
+	return status.Errorf(codes.Unimplemented, "method TopUp not implemented")
+}
+func (*UnimplementedPrivateFileStoreServer) GetBalance(ctx context.Context, req *GetBalanceRequest) (*GetBalanceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBalance not implemented")
+}
 
 func RegisterPrivateFileStoreServer(s *grpc.Server, srv PrivateFileStoreServer) {
 	s.RegisterService(&_PrivateFileStore_serviceDesc, srv)
@@ -1018,6 +2257,42 @@ func _PrivateFileStore_GetInfo_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _PrivateFileStore_GetChallenge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetChallengeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PrivateFileStoreServer).GetChallenge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.PrivateFileStore/GetChallenge",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PrivateFileStoreServer).GetChallenge(ctx, req.(*GetChallengeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PrivateFileStore_Authenticate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AuthenticateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PrivateFileStoreServer).Authenticate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.PrivateFileStore/Authenticate",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PrivateFileStoreServer).Authenticate(ctx, req.(*AuthenticateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _PrivateFileStore_ListFiles_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(ListFilesRequest)
 	if err := dec(in); err != nil {
@@ -1083,6 +2358,84 @@ func (x *privateFileStoreDownloadFileServer) Send(m *DownloadFileResponse) error
 	return x.ServerStream.SendMsg(m)
 }
 
+func _PrivateFileStore_DeleteFile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteFileRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PrivateFileStoreServer).DeleteFile(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.PrivateFileStore/DeleteFile",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PrivateFileStoreServer).DeleteFile(ctx, req.(*DeleteFileRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PrivateFileStore_ExtendFile_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExtendFileRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PrivateFileStoreServer).ExtendFile(m, &privateFileStoreExtendFileServer{stream})
+}
+
+type PrivateFileStore_ExtendFileServer interface {
+	Send(*ExtendFileResponse) error
+	grpc.ServerStream
+}
+
+type privateFileStoreExtendFileServer struct {
+	grpc.ServerStream
+}
+
+func (x *privateFileStoreExtendFileServer) Send(m *ExtendFileResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _PrivateFileStore_TopUp_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(TopUpRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PrivateFileStoreServer).TopUp(m, &privateFileStoreTopUpServer{stream})
+}
+
+type PrivateFileStore_TopUpServer interface {
+	Send(*TopUpResponse) error
+	grpc.ServerStream
+}
+
+type privateFileStoreTopUpServer struct {
+	grpc.ServerStream
+}
+
+func (x *privateFileStoreTopUpServer) Send(m *TopUpResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _PrivateFileStore_GetBalance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBalanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PrivateFileStoreServer).GetBalance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.PrivateFileStore/GetBalance",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PrivateFileStoreServer).GetBalance(ctx, req.(*GetBalanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _PrivateFileStore_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "api.PrivateFileStore",
 	HandlerType: (*PrivateFileStoreServer)(nil),
@@ -1091,10 +2444,26 @@ var _PrivateFileStore_serviceDesc = grpc.ServiceDesc{
 			MethodName: "GetInfo",
 			Handler:    _PrivateFileStore_GetInfo_Handler,
 		},
+		{
+			MethodName: "GetChallenge",
+			Handler:    _PrivateFileStore_GetChallenge_Handler,
+		},
+		{
+			MethodName: "Authenticate",
+			Handler:    _PrivateFileStore_Authenticate_Handler,
+		},
 		{
 			MethodName: "ListFiles",
 			Handler:    _PrivateFileStore_ListFiles_Handler,
 		},
+		{
+			MethodName: "DeleteFile",
+			Handler:    _PrivateFileStore_DeleteFile_Handler,
+		},
+		{
+			MethodName: "GetBalance",
+			Handler:    _PrivateFileStore_GetBalance_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -1108,6 +2477,16 @@ var _PrivateFileStore_serviceDesc = grpc.ServiceDesc{
 			Handler:       _PrivateFileStore_DownloadFile_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "ExtendFile",
+			Handler:       _PrivateFileStore_ExtendFile_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "TopUp",
+			Handler:       _PrivateFileStore_TopUp_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "api/api.proto",
 }
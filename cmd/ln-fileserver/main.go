@@ -18,7 +18,9 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
+	"time"
 )
 
 func init() {
@@ -28,6 +30,32 @@ func init() {
 	pflag.Int64("msat_base_fee", 1000, "msat base fee on upload request")
 	pflag.Int64("msat_per_kb_per_hour", 1, "msats per kilobyte per hour stored")
 	pflag.Int64("msat_per_kb_downloaded",1, "msats per kb downloaded")
+	pflag.Duration("reaper_interval", 10*time.Minute, "interval in which expired files are deleted")
+	pflag.Duration("reaper_grace_period", 0, "time after the deletion date until expired files are deleted")
+	pflag.Bool("hold_invoices", false, "use hold invoices that are only settled after a chunk was stored or sent")
+	pflag.Int64("max_bytes_per_user", 0, "maximum bytes stored per user, 0 is unlimited")
+	pflag.Int64("max_files_per_user", 0, "maximum files stored per user, 0 is unlimited")
+	pflag.Int64("max_file_size", 0, "maximum size of a single file in bytes, 0 is unlimited")
+	pflag.Int64("min_free_disk_bytes", 0, "disk space in bytes of the data dir that is always kept free")
+	pflag.Bool("verify_downloads", false, "verify the checksum of files before they are downloaded as a whole, ranged and resumed downloads are not verified")
+	pflag.String("metadata_backend", "yml", "storage of the file metadata, either yml or bolt")
+	pflag.String("blob_backend", "local", "storage of the files, either local or s3")
+	pflag.String("s3_endpoint", "", "endpoint of the s3 compatible object store")
+	pflag.String("s3_access_key", "", "access key of the object store")
+	pflag.String("s3_secret_key", "", "secret key of the object store")
+	pflag.String("s3_region", "", "region of the bucket")
+	pflag.String("s3_bucket", "ln-fileserver", "bucket the files are stored in")
+	pflag.String("s3_prefix", "", "prefix of all stored objects")
+	pflag.Bool("s3_insecure", false, "connect to the object store without tls")
+	pflag.Bool("dedup", false, "store identical files only once, must stay enabled once used")
+	pflag.Bool("compress", false, "compress files before they are stored")
+	pflag.String("encryption_key_file", "", "file holding the hex encoded 32 byte master key, enables encryption of finished files and user configs, unfinished uploads stay unencrypted")
+	pflag.String("encryption_key", "", "hex encoded 32 byte master key, better set with the environment variable LNFS_ENCRYPTION_KEY")
+	pflag.String("tls_cert", "", "path of the tls certificate, defaults to tls.cert in the data directory")
+	pflag.String("tls_key", "", "path of the tls key, defaults to tls.key in the data directory")
+	pflag.StringSlice("tls_extra_domain", nil, "additional domain of the autogenerated tls certificate")
+	pflag.Bool("no_tls", false, "serve grpc without tls")
+	pflag.String("fee_basis", "logical", "size storage and download fees are based on, either logical (uploaded bytes) or physical (stored bytes)")
 	pflag.Parse()
 
 	// Bind environmental variables to flags. Will be overwritten by flags
@@ -36,6 +64,11 @@ func init() {
 	}
 	viper.SetEnvPrefix("ln-fs")
 	viper.AutomaticEnv()
+	// the automatic variables contain a hyphen that shells can't export,
+	// so the master keys are read from LNFS_ variables
+	if err := viper.BindEnv("encryption_key", "LNFS_ENCRYPTION_KEY"); err != nil {
+		log.Panicf("could not bind env: %v", err)
+	}
 
 	if ok := viper.IsSet("lndconnect"); !ok {
 		log.Panicf("--lndconnect is not set, must be provided to connect to lnd node")
@@ -52,18 +85,106 @@ func main() {
 		msatBase int64 = viper.GetInt64("msat_base_fee")
 		msatKbHour int64 = viper.GetInt64("msat_per_kb_per_hour")
 		msatDownloaded int64 = viper.GetInt64("msat_per_kb_downloaded")
+		reaperInterval = viper.GetDuration("reaper_interval")
+		reaperGrace    = viper.GetDuration("reaper_grace_period")
+		holdInvoices   = viper.GetBool("hold_invoices")
+		metaBackend    = viper.GetString("metadata_backend")
+		verifyDownload = viper.GetBool("verify_downloads")
+		blobBackend    = viper.GetString("blob_backend")
+		dedup          = viper.GetBool("dedup")
+		compress       = viper.GetBool("compress")
+		feeBasis       = viper.GetString("fee_basis")
+		tlsCert        = viper.GetString("tls_cert")
+		tlsKey         = viper.GetString("tls_key")
+		noTLS          = viper.GetBool("no_tls")
+		limits         = filestore.Limits{
+			MaxBytesPerUser: viper.GetInt64("max_bytes_per_user"),
+			MaxFilesPerUser: viper.GetInt64("max_files_per_user"),
+			MaxFileSize:     viper.GetInt64("max_file_size"),
+			MinFreeBytes:    viper.GetInt64("min_free_disk_bytes"),
+		}
 	)
 
 	// Global context
-	_, closeFunc := context.WithCancel(context.Background())
+	ctx, closeFunc := context.WithCancel(context.Background())
 	defer closeFunc()
 
+	// master key for encryption at rest
+	masterKey, err := filestore.LoadOrParseMasterKey(viper.GetString("encryption_key_file"), viper.GetString("encryption_key"))
+	if err != nil {
+		log.Panicf("\t [Main] unable to load master key %v", err)
+	}
+
 	// file store
-	configStore := filestore.NewYmlUserConfigStore(dataDir)
+	var configStore filestore.UserConfigStore
+	switch metaBackend {
+	case "yml":
+		ymlStore := filestore.NewYmlUserConfigStore(dataDir)
+		ymlStore.SetMasterKey(masterKey)
+		configStore = ymlStore
+	case "bolt":
+		if err := os.MkdirAll(dataDir, 0755); err != nil {
+			log.Panicf("\t [Main] unable to create maindir %v", err)
+		}
+		boltStore, err := filestore.NewBoltUserConfigStore(filepath.Join(dataDir, filestore.BoltDbName))
+		if err != nil {
+			log.Panicf("\t [Main] unable to open metadata db %v", err)
+		}
+		defer boltStore.Close()
+		boltStore.SetMasterKey(masterKey)
+		configStore = boltStore
+	default:
+		log.Panicf("\t [Main] unknown metadata backend %s", metaBackend)
+	}
 	fileService, err := filestore.NewService(configStore, dataDir)
 	if err != nil {
 		log.Panicf("\t [Main] unable to create maindir %v", err)
 	}
+	fileService.SetLimits(limits)
+	switch blobBackend {
+	case "local":
+	case "s3":
+		blobStore, err := filestore.NewS3BlobStore(filestore.S3Config{
+			Endpoint:  viper.GetString("s3_endpoint"),
+			AccessKey: viper.GetString("s3_access_key"),
+			SecretKey: viper.GetString("s3_secret_key"),
+			Region:    viper.GetString("s3_region"),
+			Bucket:    viper.GetString("s3_bucket"),
+			Prefix:    viper.GetString("s3_prefix"),
+			Insecure:  viper.GetBool("s3_insecure"),
+		})
+		if err != nil {
+			log.Panicf("\t [Main] unable to connect to object store %v", err)
+		}
+		fileService.SetBlobStore(blobStore)
+	default:
+		log.Panicf("\t [Main] unknown blob backend %s", blobBackend)
+	}
+	if dedup {
+		if err := fileService.EnableDedup(ctx); err != nil {
+			log.Panicf("\t [Main] unable to count file references %v", err)
+		}
+	}
+
+	if compress {
+		fileService.EnableCompression()
+	}
+	if masterKey != nil {
+		fileService.EnableEncryption(masterKey)
+	}
+
+	// Delete expired files
+	reaper := filestore.NewReaper(fileService, reaperInterval, reaperGrace)
+	reaperDone := make(chan struct{})
+	go func() {
+		defer close(reaperDone)
+		log.Println("\t [MAIN] > starting reaper")
+		reaper.Run(ctx)
+	}()
+	defer func() {
+		closeFunc()
+		<-reaperDone
+	}()
 
 	// Connect to lnd node and create utils
 	log.Println("\t [MAIN] > connecting to lnd")
@@ -74,12 +195,13 @@ func main() {
 	defer lnConn.Close()
 	invoicesClient := invoicesrpc.NewInvoicesClient(lnConn)
 	lndUtils := lndutils.New(lndClient)
-	_, err = lndClient.GetInfo(context.Background(), &lnrpc.GetInfoRequest{})
+	lndInfo, err := lndClient.GetInfo(context.Background(), &lnrpc.GetInfoRequest{})
 	if err != nil {
 		log.Panicf("\t [LND] > can not get info: %v", err)
 	}
 
 	lndService := lnd.NewService(lndClient, invoicesClient)
+
 	// Start up grpc services
 	lis, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", grpcPort))
 	if err != nil {
@@ -87,22 +209,72 @@ func main() {
 	}
 	defer lis.Close()
 
-	grpcSrv := grpc.NewServer(
+	serverOpts := []grpc.ServerOption{
 		grpc.UnaryInterceptor(
 			grpc_middleware.ChainUnaryServer(
 				lndUtils.UnaryServerPublicMethodsInterceptor(
 					"/api.PrivateFileStore/GetInfo",
+					"/api.PrivateFileStore/GetChallenge",
+					"/api.PrivateFileStore/Authenticate",
 				),
 				lndUtils.UnaryServerAuthenticationInterceptor,
 			)), grpc.StreamInterceptor(
 			grpc_middleware.ChainStreamServer(
 				lndUtils.StreamServerAuthenticationInterceptor,
-			)))
-	fileserver := server.NewFileServer(fileService, lndService, &api.FeeReport{
+			)),
+	}
+
+	// Load or generate the tls certificate and sign its fingerprint
+	var tlsFingerprint, tlsSignature string
+	if !noTLS {
+		if tlsCert == "" {
+			tlsCert = filepath.Join(dataDir, "tls.cert")
+		}
+		if tlsKey == "" {
+			tlsKey = filepath.Join(dataDir, "tls.key")
+		}
+		if err := os.MkdirAll(dataDir, 0755); err != nil {
+			log.Panicf("\t [Main] unable to create maindir %v", err)
+		}
+		creds, fingerprint, err := lndutils.LoadServerCredentials(tlsCert, tlsKey, viper.GetStringSlice("tls_extra_domain"))
+		if err != nil {
+			log.Panicf("\t [MAIN] > unable to load tls certificate: %v", err)
+		}
+		sig, err := lndClient.SignMessage(context.Background(), &lnrpc.SignMessageRequest{Msg: []byte(lndutils.TLSFingerprintMsg(fingerprint))})
+		if err != nil {
+			log.Panicf("\t [LND] > unable to sign tls fingerprint: %v", err)
+		}
+		serverOpts = append(serverOpts, grpc.Creds(creds))
+		tlsFingerprint, tlsSignature = fingerprint, sig.Signature
+		log.Printf("\t [MAIN] > tls certificate %s, fingerprint %s", tlsCert, fingerprint)
+	}
+
+	grpcSrv := grpc.NewServer(serverOpts...)
+	fileserver := server.NewFileServer(fileService, lndService, lndUtils, &api.FeeReport{
 		MsatBaseCost:        msatBase,
 		MsatPerDownloadedKB: msatDownloaded,
 		MsatPerHourPerKB:    msatKbHour,
 	})
+	if holdInvoices {
+		if err := fileserver.EnableHoldInvoices(); err != nil {
+			log.Panicf("\t [MAIN] > unable to enable hold invoices: %v", err)
+		}
+	}
+	if verifyDownload {
+		fileserver.EnableDownloadVerification()
+	}
+	if !noTLS {
+		fileserver.SetTLSIdentity(tlsFingerprint, tlsSignature)
+	}
+	fileserver.SetNodeIdentity(lndClient, lndInfo.IdentityPubkey, lndInfo.Alias)
+	switch feeBasis {
+	case "logical":
+		fileserver.SetFeeBasis(api.FeeBasis_LOGICAL_BYTES)
+	case "physical":
+		fileserver.SetFeeBasis(api.FeeBasis_PHYSICAL_BYTES)
+	default:
+		log.Panicf("\t [MAIN] > unknown fee basis %s", feeBasis)
+	}
 	api.RegisterPrivateFileStoreServer(grpcSrv, fileserver)
 	go func() {
 		log.Println("\t [MAIN] > serving grpc")
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/sputn1ck/ln-fileserver/filestore"
+	"log"
+	"path/filepath"
+)
+
+func init() {
+	pflag.String("data_dir", "", "location of data directory")
+	pflag.String("db", "", "path of the bolt database, defaults to the data directory")
+	pflag.String("encryption_key_file", "", "file holding the hex encoded master key if the configs are encrypted")
+	pflag.String("encryption_key", "", "hex encoded master key if the configs are encrypted, better set with the environment variable LNFS_ENCRYPTION_KEY")
+	pflag.Parse()
+
+	// Bind environmental variables to flags. Will be overwritten by flags
+	if err := viper.BindPFlags(pflag.CommandLine); err != nil {
+		log.Panicf("could not bind pflags: %v", err)
+	}
+	viper.SetEnvPrefix("ln-fs")
+	viper.AutomaticEnv()
+	// the automatic variables contain a hyphen that shells can't export,
+	// so the master keys are read from LNFS_ variables
+	if err := viper.BindEnv("encryption_key", "LNFS_ENCRYPTION_KEY"); err != nil {
+		log.Panicf("could not bind env: %v", err)
+	}
+
+	if ok := viper.IsSet("data_dir"); !ok {
+		log.Panicf("--data_dir is not set, must be provided to migrate files")
+	}
+}
+
+// ln-fs-migrate imports the config.yml files of all users into the bolt
+// metadata database.
+func main() {
+	var (
+		dataDir string = viper.GetString("data_dir")
+		dbPath  string = viper.GetString("db")
+	)
+	if dbPath == "" {
+		dbPath = filepath.Join(dataDir, filestore.BoltDbName)
+	}
+
+	masterKey, err := filestore.LoadOrParseMasterKey(viper.GetString("encryption_key_file"), viper.GetString("encryption_key"))
+	if err != nil {
+		log.Panicf("\t [MIGRATE] > unable to load master key: %v", err)
+	}
+
+	ymlStore := filestore.NewYmlUserConfigStore(dataDir)
+	ymlStore.SetMasterKey(masterKey)
+	boltStore, err := filestore.NewBoltUserConfigStore(dbPath)
+	if err != nil {
+		log.Panicf("\t [MIGRATE] > unable to open metadata db: %v", err)
+	}
+	defer boltStore.Close()
+	boltStore.SetMasterKey(masterKey)
+
+	migrated, err := filestore.MigrateUserConfigs(context.Background(), ymlStore, boltStore)
+	if err != nil {
+		log.Panicf("\t [MIGRATE] > migrated %v users before failing: %v", migrated, err)
+	}
+	log.Printf("\t [MIGRATE] > migrated %v users to %s", migrated, dbPath)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/sputn1ck/ln-fileserver/filestore"
+	"log"
+	"path/filepath"
+)
+
+func init() {
+	pflag.String("data_dir", "", "location of data directory")
+	pflag.String("metadata_backend", "yml", "storage of the file metadata, either yml or bolt")
+	pflag.String("old_key_file", "", "file holding the current hex encoded master key")
+	pflag.String("old_key", "", "current hex encoded master key, better set with the environment variable LNFS_OLD_KEY")
+	pflag.String("new_key_file", "", "file holding the new hex encoded master key")
+	pflag.String("new_key", "", "new hex encoded master key, better set with the environment variable LNFS_NEW_KEY")
+	pflag.Parse()
+
+	// Bind environmental variables to flags. Will be overwritten by flags
+	if err := viper.BindPFlags(pflag.CommandLine); err != nil {
+		log.Panicf("could not bind pflags: %v", err)
+	}
+	viper.SetEnvPrefix("ln-fs")
+	viper.AutomaticEnv()
+	// the automatic variables contain a hyphen that shells can't export,
+	// so the master keys are read from LNFS_ variables
+	if err := viper.BindEnv("old_key", "LNFS_OLD_KEY"); err != nil {
+		log.Panicf("could not bind env: %v", err)
+	}
+	if err := viper.BindEnv("new_key", "LNFS_NEW_KEY"); err != nil {
+		log.Panicf("could not bind env: %v", err)
+	}
+
+	if ok := viper.IsSet("data_dir"); !ok {
+		log.Panicf("--data_dir is not set, must be provided to rotate the master key")
+	}
+}
+
+// ln-fs-rotate-key re-wraps the data keys of all files and user configs with
+// a new master key. The server must not run during the rotation.
+func main() {
+	var (
+		dataDir     string = viper.GetString("data_dir")
+		metaBackend string = viper.GetString("metadata_backend")
+	)
+	oldKey, err := filestore.LoadOrParseMasterKey(viper.GetString("old_key_file"), viper.GetString("old_key"))
+	if err != nil {
+		log.Panicf("\t [ROTATE] > unable to load old master key: %v", err)
+	}
+	newKey, err := filestore.LoadOrParseMasterKey(viper.GetString("new_key_file"), viper.GetString("new_key"))
+	if err != nil {
+		log.Panicf("\t [ROTATE] > unable to load new master key: %v", err)
+	}
+
+	var configStore filestore.UserConfigStore
+	switch metaBackend {
+	case "yml":
+		configStore = filestore.NewYmlUserConfigStore(dataDir)
+	case "bolt":
+		boltStore, err := filestore.NewBoltUserConfigStore(filepath.Join(dataDir, filestore.BoltDbName))
+		if err != nil {
+			log.Panicf("\t [ROTATE] > unable to open metadata db: %v", err)
+		}
+		defer boltStore.Close()
+		configStore = boltStore
+	default:
+		log.Panicf("\t [ROTATE] > unknown metadata backend %s", metaBackend)
+	}
+
+	rotated, err := filestore.RotateMasterKey(context.Background(), configStore, oldKey, newKey)
+	if err != nil {
+		log.Panicf("\t [ROTATE] > rotated keys of %v users before failing: %v", rotated, err)
+	}
+	log.Printf("\t [ROTATE] > rotated keys of %v users", rotated)
+}
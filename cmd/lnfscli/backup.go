@@ -0,0 +1,326 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/sputn1ck/ln-fileserver/api"
+	"github.com/urfave/cli"
+	"golang.org/x/net/context"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// backupFilePrefix and backupFileSuffix form the filename of channel
+	// backups: channel-backup-<unix timestamp>.backup
+	backupFilePrefix = "channel-backup-"
+	backupFileSuffix = ".backup"
+	// backupDescPrefix is followed by the sha256 checksum of the plaintext
+	// backup in the description of a channel backup.
+	backupDescPrefix = "multi channel backup sha256:"
+)
+
+var backupDaemonCommand = cli.Command{
+	Name:  "backupd",
+	Usage: "uploads the channel backup of the node whenever it changes",
+	Flags: []cli.Flag{
+		cli.IntFlag{
+			Name:  "keep",
+			Usage: "number of backup versions to keep",
+			Value: 3,
+		},
+		cli.Int64Flag{
+			Name:  "store_duration",
+			Usage: "duration of storage in seconds of a backup",
+			Value: 30 * 24 * 60 * 60,
+		},
+		cli.Int64Flag{
+			Name:  "renew_before",
+			Usage: "backups are extended by store_duration if they expire within this many seconds",
+			Value: 7 * 24 * 60 * 60,
+		},
+		cli.DurationFlag{
+			Name:  "renew_interval",
+			Usage: "interval in which the expiry of backups is checked",
+			Value: time.Hour,
+		},
+		cli.BoolFlag{
+			Name:  "encrypt",
+			Usage: "if set the backups are encrypted with a key derived from the node",
+		},
+		cli.IntFlag{
+			Name:  "chunk_size",
+			Usage: "bytesize of chunks that gets uploaded (default 1mb)",
+			Value: 1024 * 1024,
+		},
+		cli.IntFlag{
+			Name:  "retries",
+			Usage: "number of times an interrupted upload is resumed",
+			Value: 3,
+		},
+	},
+	Action: backupDaemon,
+}
+
+// backupd keeps the latest channel backups of the node on the fileserver.
+type backupd struct {
+	lnfs          api.PrivateFileStoreClient
+	lnd           lnrpc.LightningClient
+	key           []byte
+	keep          int
+	storeDuration int64
+	renewBefore   int64
+	chunkSize     int
+	retries       int
+}
+
+func backupDaemon(ctx *cli.Context) error {
+	ctxb, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lnfs, lnd, cleanUp := getClients(ctx)
+	defer cleanUp()
+
+	if ctx.Int("keep") < 1 {
+		return fmt.Errorf("at least one backup has to be kept")
+	}
+	if err := verifyServerIdentity(ctx, lnfs, lnd); err != nil {
+		return fmt.Errorf("refusing to upload backups: %v", err)
+	}
+	b := &backupd{
+		lnfs:          lnfs,
+		lnd:           lnd,
+		keep:          ctx.Int("keep"),
+		storeDuration: ctx.Int64("store_duration"),
+		renewBefore:   ctx.Int64("renew_before"),
+		chunkSize:     ctx.Int("chunk_size"),
+		retries:       ctx.Int("retries"),
+	}
+	if ctx.Bool("encrypt") {
+		key, err := deriveEncryptionKey(ctxb, lnd)
+		if err != nil {
+			return err
+		}
+		b.key = key
+	}
+
+	// upload the current backup if it is not stored yet
+	current, err := lnd.ExportAllChannelBackups(ctxb, &lnrpc.ChanBackupExportRequest{})
+	if err != nil {
+		return err
+	}
+	if err := b.sync(ctxb, current.MultiChanBackup); err != nil {
+		return err
+	}
+
+	stream, err := lnd.SubscribeChannelBackups(ctxb, &lnrpc.ChannelBackupSubscription{})
+	if err != nil {
+		return err
+	}
+	snapshots := make(chan *lnrpc.ChanBackupSnapshot)
+	streamErr := make(chan error, 1)
+	go func() {
+		for {
+			snapshot, err := stream.Recv()
+			if err != nil {
+				streamErr <- err
+				return
+			}
+			select {
+			case snapshots <- snapshot:
+			case <-ctxb.Done():
+				return
+			}
+		}
+	}()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	ticker := time.NewTicker(ctx.Duration("renew_interval"))
+	defer ticker.Stop()
+	log.Printf("[BACKUPD] > watching channel backups")
+	for {
+		select {
+		case snapshot := <-snapshots:
+			if err := b.sync(ctxb, snapshot.MultiChanBackup); err != nil {
+				log.Printf("[BACKUPD] > unable to store backup: %v", err)
+			}
+		case <-ticker.C:
+			if err := b.renew(ctxb); err != nil {
+				log.Printf("[BACKUPD] > unable to renew backups: %v", err)
+			}
+		case err := <-streamErr:
+			return fmt.Errorf("channel backup subscription failed: %v", err)
+		case <-sigs:
+			log.Printf("[BACKUPD] > exiting")
+			return nil
+		}
+	}
+}
+
+// sync uploads the backup unless it is the newest stored backup, removes
+// old versions and renews the backups that are kept.
+func (b *backupd) sync(ctx context.Context, backup *lnrpc.MultiChanBackup) error {
+	if backup == nil || len(backup.MultiChanBackup) == 0 {
+		return nil
+	}
+	checksum := sha256.Sum256(backup.MultiChanBackup)
+	sha := hex.EncodeToString(checksum[:])
+	backups, err := listBackups(ctx, b.lnfs, b.lnd, b.key)
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 || backupChecksum(backups[0]) != sha {
+		uploaded, err := b.upload(ctx, backup.MultiChanBackup, sha)
+		if err != nil {
+			return err
+		}
+		backups = append([]*api.FileSlot{uploaded}, backups...)
+	}
+	for _, old := range backups[min(len(backups), b.keep):] {
+		_, err := b.lnfs.DeleteFile(ctx, &api.DeleteFileRequest{FileId: old.FileId})
+		if err != nil {
+			return err
+		}
+		log.Printf("[BACKUPD] > deleted old backup %s (%s)", old.FileId, old.Filename)
+	}
+	return b.renew(ctx)
+}
+
+// upload stores the backup on the fileserver.
+func (b *backupd) upload(ctx context.Context, backup []byte, sha string) (*api.FileSlot, error) {
+	filename := fmt.Sprintf("%s%d%s", backupFilePrefix, time.Now().UTC().Unix(), backupFileSuffix)
+	description := backupDescPrefix + sha
+	file, err := ioutil.TempFile("", "lnfscli-*.backup")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	if _, err := file.Write(backup); err != nil {
+		return nil, err
+	}
+	upload := file
+	if b.key != nil {
+		filename, err = sealString(b.key, filename)
+		if err != nil {
+			return nil, err
+		}
+		description, err = sealString(b.key, description)
+		if err != nil {
+			return nil, err
+		}
+		upload, err = encryptFile(b.key, file)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(upload.Name())
+		defer upload.Close()
+	}
+	size, uploadSha, err := hashFile(upload)
+	if err != nil {
+		return nil, err
+	}
+	slot := &api.NewFileSlot{
+		DeletionDate: time.Now().UTC().Unix() + b.storeDuration,
+		Filename:     filename,
+		Description:  description,
+		Bytes:        size,
+		ShaChecksum:  uploadSha,
+	}
+	uploaded, paid, err := uploadWithRetries(ctx, b.lnfs, b.lnd, upload, slot, b.chunkSize, b.retries)
+	if err != nil {
+		return nil, err
+	}
+	if b.key != nil {
+		if err := decryptFileSlot(b.key, uploaded); err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("[BACKUPD] > stored backup %s (%s), paid %v mSats", uploaded.FileId, uploaded.Filename, paid)
+	return uploaded, nil
+}
+
+// renew extends the kept backups that expire soon.
+func (b *backupd) renew(ctx context.Context) error {
+	backups, err := listBackups(ctx, b.lnfs, b.lnd, b.key)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC().Unix()
+	for _, backup := range backups[:min(len(backups), b.keep)] {
+		if backup.DeletionDate > now+b.renewBefore {
+			continue
+		}
+		stream, err := b.lnfs.ExtendFile(ctx, &api.ExtendFileRequest{
+			FileId:       backup.FileId,
+			DeletionDate: now + b.storeDuration,
+		})
+		if err != nil {
+			return err
+		}
+		extended, paid, err := extendStream(ctx, b.lnd, stream)
+		if err != nil {
+			return err
+		}
+		log.Printf("[BACKUPD] > extended backup %s until %v, paid %v mSats", extended.FileId, time.Unix(extended.DeletionDate, 0).UTC(), paid)
+	}
+	return nil
+}
+
+// listBackups returns the channel backups on the fileserver, newest first.
+// Encrypted backups are only found if the key is set or can be derived.
+func listBackups(ctx context.Context, lnfs api.PrivateFileStoreClient, lnd lnrpc.LightningClient, key []byte) ([]*api.FileSlot, error) {
+	files, err := lnfs.ListFiles(ctx, &api.ListFilesRequest{})
+	if err != nil {
+		return nil, err
+	}
+	var backups []*api.FileSlot
+	for _, file := range files.Files {
+		if isEncrypted(file.Filename) {
+			if key == nil {
+				key, err = deriveEncryptionKey(ctx, lnd)
+				if err != nil {
+					return nil, err
+				}
+			}
+			// files encrypted with another key are ignored
+			if err := decryptFileSlot(key, file); err != nil {
+				continue
+			}
+		}
+		if isBackupFilename(file.Filename) {
+			backups = append(backups, file)
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreationDate > backups[j].CreationDate
+	})
+	return backups, nil
+}
+
+// isBackupFilename returns true if the filename follows the channel backup
+// naming convention.
+func isBackupFilename(filename string) bool {
+	return strings.HasPrefix(filename, backupFilePrefix) && strings.HasSuffix(filename, backupFileSuffix)
+}
+
+// backupChecksum returns the sha256 checksum of the plaintext backup stored
+// in the description.
+func backupChecksum(backup *api.FileSlot) string {
+	return strings.TrimPrefix(backup.Description, backupDescPrefix)
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
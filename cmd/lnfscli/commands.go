@@ -2,6 +2,8 @@ package main
 
 import (
 	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/proto"
@@ -10,6 +12,8 @@ import (
 	"github.com/sputn1ck/ln-fileserver/utils"
 	"github.com/urfave/cli"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"io"
 	"os"
 	"path/filepath"
@@ -41,13 +45,19 @@ var getInfoCommand = cli.Command{
 
 func getInfo(ctx *cli.Context) error {
 	ctxb := context.Background()
-	lnfsClient, _, cleanUp := getClients(ctx)
+	lnfsClient, lnd, cleanUp := getClients(ctx)
 	defer cleanUp()
 	res, err := lnfsClient.GetInfo(ctxb, &api.GetInfoRequest{})
 	if err != nil {
 		return err
 	}
 	printRespJSON(res)
+	if ctx.GlobalIsSet("server_pubkey") {
+		if err := verifyServerIdentity(ctx, lnfsClient, lnd); err != nil {
+			return err
+		}
+		fmt.Printf("\n Verified that the fileserver is operated by %s", ctx.GlobalString("server_pubkey"))
+	}
 	return nil
 }
 
@@ -59,12 +69,28 @@ var listFilesCommnad = cli.Command{
 
 func listFiles(ctx *cli.Context) error {
 	ctxb := context.Background()
-	lnfsClient, _, cleanUp := getClients(ctx)
+	lnfsClient, lnd, cleanUp := getClients(ctx)
 	defer cleanUp()
 	res, err := lnfsClient.ListFiles(ctxb, &api.ListFilesRequest{})
 	if err != nil {
 		return err
 	}
+	// show the names of encrypted files
+	var key []byte
+	for _, file := range res.Files {
+		if !isEncrypted(file.Filename) && !isEncrypted(file.Description) {
+			continue
+		}
+		if key == nil {
+			key, err = deriveEncryptionKey(ctxb, lnd)
+			if err != nil {
+				return err
+			}
+		}
+		if err = decryptFileSlot(key, file); err != nil {
+			return err
+		}
+	}
 	printRespJSON(res)
 	return nil
 }
@@ -146,6 +172,19 @@ var uploadFileCommand = cli.Command{
 			Name:  "force",
 			Usage: "if set doesnt wait for fee confirmation",
 		},
+		cli.IntFlag{
+			Name:  "retries",
+			Usage: "number of times an interrupted upload is resumed",
+			Value: 3,
+		},
+		cli.BoolFlag{
+			Name:  "pay_per_chunk",
+			Usage: "if set every chunk is paid separately instead of paying the whole upload up front",
+		},
+		cli.BoolFlag{
+			Name:  "encrypt",
+			Usage: "if set the file, filename and description are encrypted with a key derived from the node",
+		},
 	},
 	Action: uploadFile,
 }
@@ -155,12 +194,40 @@ func uploadFile(ctx *cli.Context) error {
 	ctxb := context.Background()
 	lnfs, lnd, cleanUp := getClients(ctx)
 	defer cleanUp()
-	totalMsats := int64(0)
+	if err := verifyServerIdentity(ctx, lnfs, lnd); err != nil {
+		return fmt.Errorf("refusing to upload: %v", err)
+	}
 	// open file
 	file, err := os.Open(ctx.String("file"))
 	if err != nil {
 		return fmt.Errorf("Error opening file %v", err)
 	}
+	defer file.Close()
+	filename := filepath.Base(file.Name())
+	description := ctx.String("description")
+	if ctx.Bool("encrypt") {
+		key, err := deriveEncryptionKey(ctxb, lnd)
+		if err != nil {
+			return err
+		}
+		filename, err = sealString(key, filename)
+		if err != nil {
+			return err
+		}
+		if description != "" {
+			description, err = sealString(key, description)
+			if err != nil {
+				return err
+			}
+		}
+		// the encrypted copy is uploaded instead of the file
+		file, err = encryptFile(key, file)
+		if err != nil {
+			return fmt.Errorf("Error encrypting file %v", err)
+		}
+		defer os.Remove(file.Name())
+		defer file.Close()
+	}
 	if !ctx.Bool("force") {
 		getinfo, err := lnfs.GetInfo(ctxb, &api.GetInfoRequest{})
 		if err != nil {
@@ -170,43 +237,144 @@ func uploadFile(ctx *cli.Context) error {
 		if err != nil {
 			return err
 		}
-		fmt.Printf(fmt.Sprintf("\n Uploading file: %v, Estimated fee: %v", file.Name(), fee))
+		if err = checkLimits(file, getinfo.Limits); err != nil {
+			return err
+		}
+		fmt.Printf(fmt.Sprintf("\n Uploading file: %v, Estimated fee: %v", ctx.String("file"), fee))
 		do := promptForConfirmation("\n Confirm upload (yes/no): ")
 		if !do {
 			return fmt.Errorf("aborted upload")
 		}
 	}
-	stream, err := lnfs.UploadFile(ctxb)
+	slot := &api.NewFileSlot{
+		DeletionDate: time.Now().UTC().Unix() + ctx.Int64("store_duration"),
+		Filename:     filename,
+		Description:  description,
+	}
+	if !ctx.Bool("pay_per_chunk") {
+		// declare size and checksum to pay the upload with a single invoice
+		slot.Bytes, slot.ShaChecksum, err = hashFile(file)
+		if err != nil {
+			return err
+		}
+	}
+	finished, totalMsats, err := uploadWithRetries(ctxb, lnfs, lnd, file, slot, ctx.Int("chunk_size"), ctx.Int("retries"))
 	if err != nil {
-		return fmt.Errorf("Error opening stream %v", err)
+		return err
 	}
-	// create chunk buffer with 1mb
-	buf := make([]byte, ctx.Int("chunk_size"))
+	printRespJSON(finished)
+	fmt.Printf("\n Paid a total of %v mSats", totalMsats)
+	return nil
+}
 
-	// send opening request
-	err = stream.Send(&api.UploadFileRequest{Event: &api.UploadFileRequest_Slot{Slot: &api.NewFileSlot{
-		DeletionDate: time.Now().UTC().Unix() + ctx.Int64("store_duration"),
-		Filename:     filepath.Base(file.Name()),
-		Description:  ctx.String("description"),
-	}}})
+// uploadWithRetries uploads the file and resumes the upload up to retries
+// times if the stream breaks. Errors the server or lnd return are final and
+// returned immediately. It returns the uploaded file and the amount of msats
+// paid.
+func uploadWithRetries(ctxb context.Context, lnfs api.PrivateFileStoreClient, lnd lnrpc.LightningClient, file *os.File, slot *api.NewFileSlot, chunkSize int, retries int) (*api.FileSlot, int64, error) {
+	totalMsats := int64(0)
+	uploadID := ""
+	for attempt := 0; ; attempt++ {
+		finished, id, paid, err := uploadStream(ctxb, lnfs, lnd, file, slot, uploadID, chunkSize)
+		totalMsats += paid
+		uploadID = id
+		if err == nil {
+			return finished, totalMsats, nil
+		}
+		if _, ok := err.(retryableErr); !ok || uploadID == "" || attempt >= retries {
+			return nil, totalMsats, err
+		}
+		fmt.Printf("\n Upload interrupted: %v, resuming upload %s (attempt %v/%v)", err, uploadID, attempt+1, retries)
+		time.Sleep(time.Duration(attempt+1) * time.Second)
+	}
+}
+
+// checkLimits returns an error if the file exceeds the server limits.
+func checkLimits(file *os.File, limits *api.Limits) error {
+	if limits == nil {
+		return nil
+	}
+	info, err := file.Stat()
 	if err != nil {
-		return fmt.Errorf("Error sending opening req %v", err)
+		return err
 	}
-	res, err := stream.Recv()
+	if limits.MaxFileSize > 0 && info.Size() > limits.MaxFileSize {
+		return fmt.Errorf("file size %v exceeds the server limit of %v bytes", info.Size(), limits.MaxFileSize)
+	}
+	if limits.AvailableBytes >= 0 && info.Size() > limits.AvailableBytes {
+		return fmt.Errorf("file size %v exceeds the available disk space of %v bytes", info.Size(), limits.AvailableBytes)
+	}
+	return nil
+}
+
+// hashFile returns the size and hex encoded sha256 checksum of the file.
+func hashFile(file *os.File) (int64, string, error) {
+	_, err := file.Seek(0, io.SeekStart)
+	if err != nil {
+		return 0, "", err
+	}
+	hasher := sha256.New()
+	n, err := io.Copy(hasher, file)
 	if err != nil {
-		return fmt.Errorf("Error receiving %v", err)
+		return 0, "", err
 	}
-	invoice := res.GetInvoice()
-	// pay invoice
-	if invoice.Invoice != "free" {
-		payment, err := lnd.SendPaymentSync(ctxb, &lnrpc.SendRequest{PaymentRequest: invoice.Invoice})
+	return n, hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// uploadStream uploads the file in a single stream. If uploadID is set, the
+// pending upload is resumed at the offset reported by the server. It returns
+// the id of the upload, so it can be resumed if the stream breaks, as well
+// as the amount of msats paid. If the slot declares the size of the file,
+// the upload is paid up front and chunks are sent without waiting for
+// invoices.
+func uploadStream(ctxb context.Context, lnfs api.PrivateFileStoreClient, lnd lnrpc.LightningClient, file *os.File, slot *api.NewFileSlot, uploadID string, chunkSize int) (*api.FileSlot, string, int64, error) {
+	totalMsats := int64(0)
+	ctxb, cancel := context.WithCancel(ctxb)
+	defer cancel()
+	stream, err := lnfs.UploadFile(ctxb)
+	if err != nil {
+		return nil, uploadID, totalMsats, streamErr("Error opening stream", err)
+	}
+	// create chunk buffer with 1mb
+	buf := make([]byte, chunkSize)
+
+	if uploadID == "" {
+		// send opening request
+		err = stream.Send(&api.UploadFileRequest{Event: &api.UploadFileRequest_Slot{Slot: slot}})
 		if err != nil {
-			return err
+			return nil, uploadID, totalMsats, streamErr("Error sending opening req", sendErr(stream, err))
 		}
-		if payment.PaymentError != "" {
-			return fmt.Errorf("Payment failed %s", payment.PaymentError)
+	} else {
+		err = stream.Send(&api.UploadFileRequest{Event: &api.UploadFileRequest_Resume{Resume: &api.ResumeUpload{UploadId: uploadID}}})
+		if err != nil {
+			return nil, uploadID, totalMsats, streamErr("Error sending resume req", sendErr(stream, err))
 		}
-		totalMsats += payment.PaymentRoute.TotalAmtMsat
+	}
+	// the server may send invoices for the slot and the storage of the file
+	// before the session starts
+	var session *api.UploadSession
+	for session == nil {
+		res, err := stream.Recv()
+		if err != nil {
+			return nil, uploadID, totalMsats, streamErr("Error receiving", err)
+		}
+		if invoice := res.GetInvoice(); invoice != nil {
+			paid, err := payInvoice(ctxb, lnd, invoice)
+			totalMsats += paid
+			if err != nil {
+				return nil, uploadID, totalMsats, err
+			}
+			continue
+		}
+		session = res.GetSession()
+		if session == nil {
+			return nil, uploadID, totalMsats, fmt.Errorf("upload session expected")
+		}
+	}
+	uploadID = session.UploadId
+	_, err = file.Seek(session.Offset, io.SeekStart)
+	if err != nil {
+		return nil, uploadID, totalMsats, err
 	}
 	writing := true
 	for writing {
@@ -219,39 +387,84 @@ func uploadFile(ctx *cli.Context) error {
 			Content: buf[:n],
 		}}})
 		if err != nil {
-			return fmt.Errorf("\n [FS] > Error sending chunk req %v", err)
+			return nil, uploadID, totalMsats, streamErr("\n [FS] > Error sending chunk req", sendErr(stream, err))
+		}
+		if slot.Bytes > 0 {
+			continue
 		}
 		res, err := stream.Recv()
 		if err != nil {
-			return fmt.Errorf("\n [FS] > Error receiving %v", err)
+			return nil, uploadID, totalMsats, streamErr("\n [FS] > Error receiving", err)
 		}
-		invoice = res.GetInvoice()
+		invoice := res.GetInvoice()
 
 		// pay invoice
-		// pay invoice
-		if invoice.Invoice != "free" {
-			payment, err := lnd.SendPaymentSync(ctxb, &lnrpc.SendRequest{PaymentRequest: invoice.Invoice})
-			if err != nil {
-				return err
-			}
-			if payment.PaymentError != "" {
-				return fmt.Errorf("Payment failed %s", payment.PaymentError)
-			}
-			totalMsats += payment.PaymentRoute.TotalAmtMsat
+		paid, err := payInvoice(ctxb, lnd, invoice)
+		totalMsats += paid
+		if err != nil {
+			return nil, uploadID, totalMsats, err
 		}
 	}
 	err = stream.Send(&api.UploadFileRequest{Event: &api.UploadFileRequest_Finished{Finished: &api.Empty{}}})
 	if err != nil {
-		return fmt.Errorf("\n[FS] > Error sending finished event %v", err)
+		return nil, uploadID, totalMsats, streamErr("\n[FS] > Error sending finished event", sendErr(stream, err))
 	}
-	res, err = stream.Recv()
+	res, err := stream.Recv()
 	if err != nil {
-		return fmt.Errorf("\n[FS] > Error receiving finished %v", err)
+		return nil, uploadID, totalMsats, streamErr("\n[FS] > Error receiving finished", err)
 	}
-	finished := res.GetFinishedFile()
-	printRespJSON(finished)
-	fmt.Printf("\n Paid a total of %v mSats", totalMsats)
-	return nil
+	return res.GetFinishedFile(), uploadID, totalMsats, nil
+}
+
+// retryableErr marks errors after which an upload can be resumed.
+type retryableErr struct {
+	err error
+}
+
+func (e retryableErr) Error() string {
+	return e.err.Error()
+}
+
+// streamErr prefixes the error of the upload stream with msg. Errors of the
+// transport are retryable, status codes returned by the server are not. The
+// server returns DeadlineExceeded for expired invoices and removes the
+// upload, so it is not retried either. Aborted is retried, as the server
+// may still hold the upload for the broken stream.
+func streamErr(msg string, err error) error {
+	wrapped := fmt.Errorf("%s %v", msg, err)
+	switch status.Code(err) {
+	case codes.Unavailable, codes.Canceled, codes.Aborted:
+		return retryableErr{err: wrapped}
+	}
+	return wrapped
+}
+
+// sendErr returns the status of the stream if a send failed because the
+// stream was closed, Send itself only returns io.EOF in that case.
+func sendErr(stream api.PrivateFileStore_UploadFileClient, err error) error {
+	if err != io.EOF {
+		return err
+	}
+	if _, recvErr := stream.Recv(); recvErr != nil {
+		return recvErr
+	}
+	return err
+}
+
+// payInvoice pays the invoice unless it is free or was paid from the prepaid
+// balance and returns the amount paid.
+func payInvoice(ctx context.Context, lnd lnrpc.LightningClient, invoice *api.InvoiceResponse) (int64, error) {
+	if invoice.Invoice == "free" || invoice.Prepaid {
+		return 0, nil
+	}
+	payment, err := lnd.SendPaymentSync(ctx, &lnrpc.SendRequest{PaymentRequest: invoice.Invoice})
+	if err != nil {
+		return 0, err
+	}
+	if payment.PaymentError != "" {
+		return 0, fmt.Errorf("Payment failed %s", payment.PaymentError)
+	}
+	return payment.PaymentRoute.TotalAmtMsat, nil
 }
 
 var downloadFileCommand = cli.Command{
@@ -269,6 +482,14 @@ var downloadFileCommand = cli.Command{
 			Usage: "where to download to",
 			Value: ".",
 		},
+		cli.Int64Flag{
+			Name:  "offset",
+			Usage: "byte offset to start the download at (default: size of a partial local file)",
+		},
+		cli.Int64Flag{
+			Name:  "length",
+			Usage: "number of bytes to download (default: until the end of the file)",
+		},
 		cli.BoolFlag{
 			Name:  "force",
 			Usage: "if set doesnt wait for fee confirmation",
@@ -282,84 +503,375 @@ func downloadFile(ctx *cli.Context) error {
 	lnfs, lnd, cleanUp := getClients(ctx)
 	defer cleanUp()
 
-	totalMsats := int64(0)
-	// open file
-	stream, err := lnfs.DownloadFile(ctxb, &api.DownloadFileRequest{FileId: ctx.String("id")})
+	fileInfo, err := getFileInfo(ctxb, lnfs, ctx.String("id"))
 	if err != nil {
 		return err
 	}
-	res, err := stream.Recv()
-	if err != nil {
-		return err
+	// encrypted files are downloaded next to the destination and decrypted
+	// once the download is finished
+	var key []byte
+	encrypted := isEncrypted(fileInfo.Filename)
+	if encrypted {
+		key, err = deriveEncryptionKey(ctxb, lnd)
+		if err != nil {
+			return err
+		}
+		if err = decryptFileSlot(key, fileInfo); err != nil {
+			return err
+		}
+		if ctx.IsSet("offset") || ctx.IsSet("length") {
+			return fmt.Errorf("encrypted files can only be downloaded as a whole")
+		}
 	}
-	fileInfo := res.GetFileInfo()
-	if fileInfo == nil {
-		return fmt.Errorf("fileinfo expected")
+	target := filepath.Join(ctx.String("dir"), filepath.Base(fileInfo.Filename))
+	path := target
+	if encrypted {
+		path = target + ".lnfs-enc"
+	}
+	offset := ctx.Int64("offset")
+	length := ctx.Int64("length")
+	// continue a partial download
+	if !ctx.IsSet("offset") && !ctx.IsSet("length") {
+		fi, err := os.Stat(path)
+		if err == nil && fi.Size() == fileInfo.Bytes && !encrypted {
+			fmt.Printf("\n File %v is already downloaded", path)
+			return nil
+		}
+		if err == nil && fi.Size() < fileInfo.Bytes {
+			offset = fi.Size()
+			fmt.Printf("\n Found partial file %v, continuing at byte %v", path, offset)
+		}
+	}
+	if offset > fileInfo.Bytes {
+		return fmt.Errorf("offset %v is larger than file size %v", offset, fileInfo.Bytes)
+	}
+	toDownload := fileInfo.Bytes - offset
+	if length > 0 && length < toDownload {
+		toDownload = length
 	}
 	if (!ctx.Bool("force")) {
 		getinfo, err := lnfs.GetInfo(ctxb, &api.GetInfoRequest{})
 		if err != nil {
 			return err
 		}
-		totalFee := utils.GetTotalDownloadFee(fileInfo.Bytes, getinfo.FeeReport)
-		fmt.Printf(fmt.Sprintf("\n Download file: %v, Estimated fee: %v", fileInfo.Filename, totalFee))
+		totalFee := utils.GetTotalDownloadFee(toDownload, getinfo.FeeReport)
+		fmt.Printf(fmt.Sprintf("\n Download file: %v, bytes: %v, Estimated fee: %v", fileInfo.Filename, toDownload, totalFee))
 		do := promptForConfirmation("\n Confirm download (yes/no): ")
 		if !do {
 			return fmt.Errorf("aborted download")
 		}
 	}
-	file, err := os.Create(filepath.Join(ctx.String("dir"), fileInfo.Filename))
+	// open file
+	stream, err := lnfs.DownloadFile(ctxb, &api.DownloadFileRequest{
+		FileId: ctx.String("id"),
+		Offset: offset,
+		Length: length,
+	})
+	if err != nil {
+		return err
+	}
+	res, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if res.GetFileInfo() == nil {
+		return fmt.Errorf("fileinfo expected")
+	}
+	// the local file mirrors the remote file, so ranges are written at
+	// their offset
+	flags := os.O_RDWR | os.O_CREATE
+	if offset == 0 && length == 0 {
+		flags |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(path, flags, 0644)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
+	// the checksum is verified if the whole file is downloaded or a partial
+	// download is continued
+	verify := !ctx.IsSet("offset") && !ctx.IsSet("length")
+	hasher := sha256.New()
+	if verify && offset > 0 {
+		_, err = io.Copy(hasher, io.NewSectionReader(file, 0, offset))
+		if err != nil {
+			return err
+		}
+	}
+	_, err = file.Seek(offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	var writer io.Writer = file
+	if verify {
+		writer = io.MultiWriter(file, hasher)
+	}
+	totalMsats, err := downloadStream(ctxb, lnd, stream, writer)
+	if err != nil {
+		return err
+	}
+	if verify {
+		checksum := hex.EncodeToString(hasher.Sum(nil))
+		if !strings.EqualFold(checksum, res.GetFileInfo().ShaChecksum) {
+			file.Close()
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			return fmt.Errorf("checksum mismatch, expected %s got %s, removed %s", res.GetFileInfo().ShaChecksum, checksum, path)
+		}
+		fmt.Printf("\n Verified checksum %s", checksum)
+	}
+	if encrypted {
+		if err = decryptFile(key, path, target); err != nil {
+			return err
+		}
+		if err = os.Remove(path); err != nil {
+			return err
+		}
+		fmt.Printf("\n Decrypted file to %v", target)
+	}
+
+	fmt.Printf("\n Paid a total of %v mSats", totalMsats)
+	return nil
+}
+
+// downloadStream writes the chunks of the download to w and pays the
+// invoices. The file info has to be received already. It returns the
+// amount of msats paid.
+func downloadStream(ctxb context.Context, lnd lnrpc.LightningClient, stream api.PrivateFileStore_DownloadFileClient, w io.Writer) (int64, error) {
+	totalMsats := int64(0)
 Loop:
 	for {
 		select {
 		case <-ctxb.Done():
-			return nil
+			return totalMsats, ctxb.Err()
 		default:
-			res, err = stream.Recv()
+			res, err := stream.Recv()
 			if err == io.EOF {
-				return nil
+				return totalMsats, nil
 			}
 			if err != nil {
-				return err
+				return totalMsats, err
 			}
 
 			switch res.Event.(type) {
 			case *api.DownloadFileResponse_Finished:
 				break Loop
 			case *api.DownloadFileResponse_Chunk:
-				_, err := file.Write(res.GetChunk().Content)
+				_, err := w.Write(res.GetChunk().Content)
 				if err != nil {
-					return err
+					return totalMsats, err
 				}
 			case *api.DownloadFileResponse_Invoice:
-				invoice := res.GetInvoice().Invoice
-				if invoice == "free" {
-					continue
-				}
-				payment, err := lnd.SendPaymentSync(ctxb, &lnrpc.SendRequest{PaymentRequest: invoice})
+				paid, err := payInvoice(ctxb, lnd, res.GetInvoice())
+				totalMsats += paid
 				if err != nil {
-					return err
+					return totalMsats, err
 				}
-				if payment.PaymentError != "" {
-					return fmt.Errorf("Payment failed %s", payment.PaymentError)
-				}
-				totalMsats += payment.PaymentRoute.TotalAmtMsat
 			}
 		}
 	}
-	err = stream.CloseSend()
+	return totalMsats, stream.CloseSend()
+}
+
+var deleteFileCommand = cli.Command{
+	Name:      "delete",
+	Usage:     "deletes a file from the ln-fileserver",
+	ArgsUsage: "id",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:     "id",
+			Usage:    "id of the file to delete",
+			Required: true,
+		},
+	},
+	Action: deleteFile,
+}
+
+func deleteFile(ctx *cli.Context) error {
+	ctxb := context.Background()
+	lnfs, _, cleanUp := getClients(ctx)
+	defer cleanUp()
+	res, err := lnfs.DeleteFile(ctxb, &api.DeleteFileRequest{FileId: ctx.String("id")})
 	if err != nil {
 		return err
 	}
+	printRespJSON(res)
+	return nil
+}
 
+var extendFileCommand = cli.Command{
+	Name:      "extend",
+	Usage:     "extends the storage time of a file",
+	ArgsUsage: "id",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:     "id",
+			Usage:    "id of the file to extend",
+			Required: true,
+		},
+		cli.Int64Flag{
+			Name:     "store_duration",
+			Usage:    "duration of storage in seconds from now on",
+			Required: true,
+		},
+		cli.BoolFlag{
+			Name:  "force",
+			Usage: "if set doesnt wait for fee confirmation",
+		},
+	},
+	Action: extendFile,
+}
+
+func extendFile(ctx *cli.Context) error {
+	ctxb := context.Background()
+	lnfs, lnd, cleanUp := getClients(ctx)
+	defer cleanUp()
+	deletionDate := time.Now().UTC().Unix() + ctx.Int64("store_duration")
+	if !ctx.Bool("force") {
+		fileInfo, err := getFileInfo(ctxb, lnfs, ctx.String("id"))
+		if err != nil {
+			return err
+		}
+		getinfo, err := lnfs.GetInfo(ctxb, &api.GetInfoRequest{})
+		if err != nil {
+			return err
+		}
+		// the server extends expired files from now on and bills the
+		// stored size with the physical fee basis
+		extendFrom := fileInfo.DeletionDate
+		if now := time.Now().UTC().Unix(); extendFrom < now {
+			extendFrom = now
+		}
+		billedBytes := fileInfo.Bytes
+		if getinfo.GetStorage().GetFeeBasis() == api.FeeBasis_PHYSICAL_BYTES && fileInfo.PhysicalBytes > 0 {
+			billedBytes = fileInfo.PhysicalBytes
+		}
+		fee := utils.GetTotalUploadFee(billedBytes, deletionDate-extendFrom, getinfo.FeeReport)
+		fmt.Printf("\n Extending file: %v, Estimated fee: %v", fileInfo.Filename, fee)
+		do := promptForConfirmation("\n Confirm extension (yes/no): ")
+		if !do {
+			return fmt.Errorf("aborted extension")
+		}
+	}
+	stream, err := lnfs.ExtendFile(ctxb, &api.ExtendFileRequest{
+		FileId:       ctx.String("id"),
+		DeletionDate: deletionDate,
+	})
+	if err != nil {
+		return err
+	}
+	fileInfo, totalMsats, err := extendStream(ctxb, lnd, stream)
+	if err != nil {
+		return err
+	}
+	printRespJSON(fileInfo)
 	fmt.Printf("\n Paid a total of %v mSats", totalMsats)
 	return nil
 }
 
+// extendStream pays the invoices of the extension and returns the extended
+// file as well as the amount of msats paid.
+func extendStream(ctxb context.Context, lnd lnrpc.LightningClient, stream api.PrivateFileStore_ExtendFileClient) (*api.FileSlot, int64, error) {
+	totalMsats := int64(0)
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			return nil, totalMsats, fmt.Errorf("stream closed before file was extended")
+		}
+		if err != nil {
+			return nil, totalMsats, err
+		}
+		switch res.Event.(type) {
+		case *api.ExtendFileResponse_Invoice:
+			paid, err := payInvoice(ctxb, lnd, res.GetInvoice())
+			totalMsats += paid
+			if err != nil {
+				return nil, totalMsats, err
+			}
+		case *api.ExtendFileResponse_FileInfo:
+			return res.GetFileInfo(), totalMsats, nil
+		}
+	}
+}
+
+var topUpCommand = cli.Command{
+	Name:  "topup",
+	Usage: "tops up the prepaid balance used to pay for uploads and downloads",
+	Flags: []cli.Flag{
+		cli.Int64Flag{
+			Name:     "amt_msat",
+			Usage:    "amount in msat to add to the balance",
+			Required: true,
+		},
+	},
+	Action: topUp,
+}
+
+func topUp(ctx *cli.Context) error {
+	ctxb := context.Background()
+	lnfs, lnd, cleanUp := getClients(ctx)
+	defer cleanUp()
+	stream, err := lnfs.TopUp(ctxb, &api.TopUpRequest{AmtMsat: ctx.Int64("amt_msat")})
+	if err != nil {
+		return err
+	}
+	totalMsats := int64(0)
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			return fmt.Errorf("stream closed before balance was credited")
+		}
+		if err != nil {
+			return err
+		}
+		switch res.Event.(type) {
+		case *api.TopUpResponse_Invoice:
+			paid, err := payInvoice(ctxb, lnd, res.GetInvoice())
+			totalMsats += paid
+			if err != nil {
+				return err
+			}
+		case *api.TopUpResponse_Balance:
+			printRespJSON(res.GetBalance())
+			fmt.Printf("\n Paid a total of %v mSats", totalMsats)
+			return nil
+		}
+	}
+}
+
+var getBalanceCommand = cli.Command{
+	Name:   "balance",
+	Usage:  "returns the prepaid balance",
+	Action: getBalance,
+}
+
+func getBalance(ctx *cli.Context) error {
+	ctxb := context.Background()
+	lnfs, _, cleanUp := getClients(ctx)
+	defer cleanUp()
+	res, err := lnfs.GetBalance(ctxb, &api.GetBalanceRequest{})
+	if err != nil {
+		return err
+	}
+	printRespJSON(res)
+	return nil
+}
+
+// getFileInfo returns the file slot with the given id.
+func getFileInfo(ctx context.Context, lnfs api.PrivateFileStoreClient, id string) (*api.FileSlot, error) {
+	files, err := lnfs.ListFiles(ctx, &api.ListFilesRequest{})
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files.Files {
+		if file.FileId == id {
+			return file, nil
+		}
+	}
+	return nil, fmt.Errorf("file %s not found", id)
+}
+
 func promptForConfirmation(msg string) bool {
 	reader := bufio.NewReader(os.Stdin)
 
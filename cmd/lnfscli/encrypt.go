@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/sputn1ck/ln-fileserver/api"
+	"golang.org/x/net/context"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	// encryptionLabel is signed by the node to derive the encryption key.
+	// lnd signatures are deterministic, so the same seed always results in
+	// the same key.
+	encryptionLabel = "lnfscli:file-encryption-key:v1"
+	// encryptedPrefix marks encrypted filenames and descriptions.
+	encryptedPrefix = "lnfs-enc:"
+	// encryptedChunkSize is the size of the plaintext chunks that are
+	// sealed separately.
+	encryptedChunkSize = 64 * 1024
+)
+
+var (
+	encryptedMagic = []byte("LNFSENC1")
+
+	errNotEncrypted = fmt.Errorf("file is not encrypted by lnfscli")
+)
+
+// deriveEncryptionKey derives the symmetric file key from the node key by
+// signing a fixed label.
+func deriveEncryptionKey(ctx context.Context, lnd lnrpc.LightningClient) ([]byte, error) {
+	sig, err := lnd.SignMessage(ctx, &lnrpc.SignMessageRequest{Msg: []byte(encryptionLabel)})
+	if err != nil {
+		return nil, fmt.Errorf("unable to derive encryption key: %v", err)
+	}
+	key := sha256.Sum256([]byte(sig.Signature))
+	return key[:], nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// isEncrypted returns true if the metadata value was sealed by sealString.
+func isEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// sealString encrypts a metadata value like a filename or description.
+func sealString(key []byte, value string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), nil)
+	return encryptedPrefix + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// openString decrypts a metadata value sealed by sealString.
+func openString(key []byte, value string) (string, error) {
+	if !isEncrypted(value) {
+		return value, nil
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("encrypted value too short")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("unable to decrypt value: %v", err)
+	}
+	return string(plain), nil
+}
+
+// decryptFileSlot replaces the encrypted filename and description of the
+// slot with their plaintext.
+func decryptFileSlot(key []byte, slot *api.FileSlot) error {
+	filename, err := openString(key, slot.Filename)
+	if err != nil {
+		return err
+	}
+	description, err := openString(key, slot.Description)
+	if err != nil {
+		return err
+	}
+	slot.Filename = filename
+	slot.Description = description
+	return nil
+}
+
+// chunkNonce returns the nonce of the i-th chunk. The last chunk is marked,
+// so a truncated file can not be decrypted.
+func chunkNonce(prefix []byte, i uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[7:11], i)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// encryptStream encrypts src into dst. The output starts with a header of
+// the magic bytes and a random nonce prefix, followed by the sealed chunks.
+func encryptStream(key []byte, src io.Reader, dst io.Writer) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, len(encryptedMagic)+7)
+	copy(header, encryptedMagic)
+	if _, err := rand.Read(header[len(encryptedMagic):]); err != nil {
+		return err
+	}
+	if _, err := dst.Write(header); err != nil {
+		return err
+	}
+	prefix := header[len(encryptedMagic):]
+	reader := bufio.NewReaderSize(src, encryptedChunkSize)
+	buf := make([]byte, encryptedChunkSize)
+	for i := uint32(0); ; i++ {
+		n, err := io.ReadFull(reader, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		last := err != nil
+		if !last {
+			// a full chunk is the last one if nothing follows
+			if _, err := reader.Peek(1); err == io.EOF {
+				last = true
+			} else if err != nil {
+				return err
+			}
+		}
+		sealed := aead.Seal(nil, chunkNonce(prefix, i, last), buf[:n], header)
+		if _, err := dst.Write(sealed); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// decryptStream decrypts src, which was encrypted by encryptStream, into
+// dst.
+func decryptStream(key []byte, src io.Reader, dst io.Writer) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, len(encryptedMagic)+7)
+	if _, err := io.ReadFull(src, header); err != nil {
+		return errNotEncrypted
+	}
+	if string(header[:len(encryptedMagic)]) != string(encryptedMagic) {
+		return errNotEncrypted
+	}
+	prefix := header[len(encryptedMagic):]
+	reader := bufio.NewReaderSize(src, encryptedChunkSize+aead.Overhead())
+	buf := make([]byte, encryptedChunkSize+aead.Overhead())
+	for i := uint32(0); ; i++ {
+		n, err := io.ReadFull(reader, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		last := err != nil
+		if !last {
+			if _, err := reader.Peek(1); err == io.EOF {
+				last = true
+			} else if err != nil {
+				return err
+			}
+		}
+		plain, err := aead.Open(nil, chunkNonce(prefix, i, last), buf[:n], header)
+		if err != nil {
+			return fmt.Errorf("unable to decrypt chunk %v: %v", i, err)
+		}
+		if _, err := dst.Write(plain); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// encryptFile encrypts the file into a temporary file, which has to be
+// removed by the caller.
+func encryptFile(key []byte, file *os.File) (*os.File, error) {
+	_, err := file.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := ioutil.TempFile("", "lnfscli-*.enc")
+	if err != nil {
+		return nil, err
+	}
+	if err := encryptStream(key, file, encrypted); err != nil {
+		encrypted.Close()
+		os.Remove(encrypted.Name())
+		return nil, err
+	}
+	_, err = encrypted.Seek(0, io.SeekStart)
+	if err != nil {
+		encrypted.Close()
+		os.Remove(encrypted.Name())
+		return nil, err
+	}
+	return encrypted, nil
+}
+
+// decryptFile decrypts the file at src into a new file at dst.
+func decryptFile(key []byte, src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if err := decryptStream(key, in, out); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
@@ -2,14 +2,22 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"github.com/lightningnetwork/lnd/lnrpc"
 	"github.com/sputn1ck/ln-fileserver/api"
 	"github.com/sputn1ck/ln-fileserver/lndutils"
 	"github.com/urfave/cli"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"log"
 	"os"
+	"strings"
+	"sync"
+	"time"
 )
 
 func main() {
@@ -27,6 +35,30 @@ func main() {
 			Usage: "target fileserver host",
 			Value: "localhost:9090",
 		},
+		cli.StringFlag{
+			Name:  "tls_cert",
+			Usage: "path of the tls certificate of the fileserver, only this certificate is trusted",
+		},
+		cli.StringFlag{
+			Name:  "tls_fingerprint",
+			Usage: "hex encoded sha256 fingerprint of the tls certificate of the fileserver, only this certificate is accepted",
+		},
+		cli.StringFlag{
+			Name:  "tls_node_pubkey",
+			Usage: "accept the tls certificate of the fileserver if its fingerprint is signed by this node pubkey",
+		},
+		cli.BoolFlag{
+			Name:  "tls_system_roots",
+			Usage: "verify the tls certificate of the fileserver against the system roots, for certificates signed by a public ca",
+		},
+		cli.BoolFlag{
+			Name:  "no_tls",
+			Usage: "connect to the fileserver without tls",
+		},
+		cli.StringFlag{
+			Name:  "server_pubkey",
+			Usage: "node pubkey of the fileserver operator, uploads are refused if the fileserver can not prove its identity",
+		},
 	}
 	app.Commands = []cli.Command{
 		getInfoCommand,
@@ -34,6 +66,12 @@ func main() {
 		uploadFileCommand,
 		downloadFileCommand,
 		estimateUploadFeeCommand,
+		deleteFileCommand,
+		extendFileCommand,
+		topUpCommand,
+		getBalanceCommand,
+		backupDaemonCommand,
+		restoreCommand,
 	}
 	if err := app.Run(os.Args); err != nil {
 		log.Fatal(err)
@@ -79,22 +117,143 @@ func getLnfsClient(ctx *cli.Context, client lnrpc.LightningClient) (api.PrivateF
 
 func getLnfsConn(ctx *cli.Context, client lnrpc.LightningClient) *grpc.ClientConn {
 	target := ctx.GlobalString("target")
-	msg := lndutils.AuthMsg
+	sess := &session{}
 	opts := []grpc.DialOption{
-		grpc.WithUnaryInterceptor(UnaryAuthenticationInterceptor(client, &msg)),
-		grpc.WithStreamInterceptor(StreamAuthenticationIntercetpor(client, &msg)),
-		grpc.WithInsecure(),
+		grpc.WithUnaryInterceptor(UnaryAuthenticationInterceptor(client, sess)),
+		grpc.WithStreamInterceptor(StreamAuthenticationIntercetpor(client, sess)),
+	}
+	var pinned *lndutils.PinnedCertificate
+	switch {
+	case ctx.GlobalBool("no_tls"):
+		opts = append(opts, grpc.WithInsecure())
+	case ctx.GlobalString("tls_cert") != "":
+		creds, err := credentials.NewClientTLSFromFile(ctx.GlobalString("tls_cert"), "")
+		if err != nil {
+			log.Panicf("\n[LNFS] > unable to load tls certificate: %v", err)
+		}
+		opts = append(opts, grpc.WithTransportCredentials(creds))
+	case ctx.GlobalString("tls_fingerprint") != "" || ctx.GlobalString("tls_node_pubkey") != "":
+		pinned = lndutils.NewPinnedCertificate(ctx.GlobalString("tls_fingerprint"))
+		opts = append(opts, grpc.WithTransportCredentials(pinned.Credentials()))
+	case ctx.GlobalBool("tls_system_roots"):
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewClientTLSFromCert(nil, "")))
+	default:
+		// the fileserver generates a self-signed certificate by default,
+		// which can't be verified against the system roots
+		log.Panicf("\n[LNFS] > unable to verify the fileserver: set --tls_cert, --tls_fingerprint or --tls_node_pubkey to trust its certificate, --tls_system_roots if it is signed by a public ca or --no_tls")
 	}
 	lnfsConn, err := grpc.DialContext(context.Background(), target, opts...)
 	if err != nil {
 		log.Panicf("\n[LNFS] > can not connect: %v", err)
 	}
+	if nodePubkey := ctx.GlobalString("tls_node_pubkey"); nodePubkey != "" && pinned != nil {
+		if err := verifyTLSIdentity(context.Background(), api.NewPrivateFileStoreClient(lnfsConn), client, pinned, nodePubkey); err != nil {
+			lnfsConn.Close()
+			log.Panicf("\n[LNFS] > unable to verify tls certificate: %v", err)
+		}
+	}
 	return lnfsConn
 }
 
-func UnaryAuthenticationInterceptor(lnd lnrpc.LightningClient, msg *string) grpc.UnaryClientInterceptor {
+// verifyTLSIdentity checks that the fingerprint of the pinned certificate is
+// signed by the node pubkey. It is called before any authenticated request
+// is sent.
+func verifyTLSIdentity(ctx context.Context, lnfs api.PrivateFileStoreClient, lnd lnrpc.LightningClient, pinned *lndutils.PinnedCertificate, nodePubkey string) error {
+	info, err := lnfs.GetInfo(ctx, &api.GetInfoRequest{})
+	if err != nil {
+		return err
+	}
+	identity := info.TlsIdentity
+	if identity == nil {
+		return fmt.Errorf("fileserver does not publish a tls identity")
+	}
+	if !strings.EqualFold(identity.Fingerprint, pinned.Fingerprint()) {
+		return fmt.Errorf("published fingerprint %s does not match certificate %s", identity.Fingerprint, pinned.Fingerprint())
+	}
+	res, err := lnd.VerifyMessage(ctx, &lnrpc.VerifyMessageRequest{
+		Msg:       []byte(lndutils.TLSFingerprintMsg(pinned.Fingerprint())),
+		Signature: identity.Signature,
+	})
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(res.Pubkey, nodePubkey) {
+		return fmt.Errorf("fingerprint is signed by %s, expected %s", res.Pubkey, nodePubkey)
+	}
+	return nil
+}
+
+// verifyServerIdentity checks that the fileserver is operated by the node
+// set with --server_pubkey. The fileserver has to sign a random nonce
+// together with the fingerprint of the tls certificate of the connection.
+// Nothing is checked if --server_pubkey is not set.
+func verifyServerIdentity(ctx *cli.Context, lnfs api.PrivateFileStoreClient, lnd lnrpc.LightningClient) error {
+	serverPubkey := ctx.GlobalString("server_pubkey")
+	if serverPubkey == "" {
+		return nil
+	}
+	ctxb := context.Background()
+	nonceBytes := make([]byte, 32)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return err
+	}
+	nonce := hex.EncodeToString(nonceBytes)
+	var p peer.Peer
+	info, err := lnfs.GetInfo(ctxb, &api.GetInfoRequest{Nonce: nonce}, grpc.Peer(&p))
+	if err != nil {
+		return err
+	}
+	identity := info.NodeIdentity
+	if identity == nil || identity.Signature == "" {
+		return fmt.Errorf("fileserver does not prove its identity")
+	}
+	if !strings.EqualFold(identity.Pubkey, serverPubkey) {
+		return fmt.Errorf("fileserver is operated by %s, expected %s", identity.Pubkey, serverPubkey)
+	}
+	// the fingerprint of the certificate of this connection is signed, so
+	// the proof can not be relayed through another connection
+	var fingerprint string
+	if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.PeerCertificates) > 0 {
+		fingerprint = lndutils.CertFingerprint(tlsInfo.State.PeerCertificates[0].Raw)
+	}
+	res, err := lnd.VerifyMessage(ctxb, &lnrpc.VerifyMessageRequest{
+		Msg:       []byte(lndutils.IdentityMsg(nonce, fingerprint)),
+		Signature: identity.Signature,
+	})
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(res.Pubkey, serverPubkey) {
+		return fmt.Errorf("identity proof of the fileserver is invalid")
+	}
+	return nil
+}
+
+// publicMethods are the fileserver methods that don't need a session.
+var publicMethods = map[string]bool{
+	"/api.PrivateFileStore/GetInfo":      true,
+	"/api.PrivateFileStore/GetChallenge": true,
+	"/api.PrivateFileStore/Authenticate": true,
+}
+
+// sessionRenewMargin is the number of seconds before the expiry
+// of a session at which a new session is requested.
+const sessionRenewMargin = 30
+
+// session caches the session token obtained from the fileserver.
+type session struct {
+	sync.Mutex
+	pubkey string
+	token  string
+	expiry int64
+}
+
+func UnaryAuthenticationInterceptor(lnd lnrpc.LightningClient, sess *session) grpc.UnaryClientInterceptor {
 	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
-		ctx, err := GetPfContext(ctx, lnd, msg)
+		if publicMethods[method] {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		ctx, err := GetPfContext(ctx, lnd, api.NewPrivateFileStoreClient(cc), sess)
 		if err != nil {
 			return err
 		}
@@ -102,9 +261,9 @@ func UnaryAuthenticationInterceptor(lnd lnrpc.LightningClient, msg *string) grpc
 	}
 }
 
-func StreamAuthenticationIntercetpor(lnd lnrpc.LightningClient, msg *string) grpc.StreamClientInterceptor {
+func StreamAuthenticationIntercetpor(lnd lnrpc.LightningClient, sess *session) grpc.StreamClientInterceptor {
 	return func(parentCtx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
-		ctx, err := GetPfContext(parentCtx, lnd, msg)
+		ctx, err := GetPfContext(parentCtx, lnd, api.NewPrivateFileStoreClient(cc), sess)
 		if err != nil {
 			return nil, err
 		}
@@ -116,18 +275,38 @@ func StreamAuthenticationIntercetpor(lnd lnrpc.LightningClient, msg *string) grp
 	}
 }
 
-func GetPfContext(ctx context.Context, lnd lnrpc.LightningClient, msg *string) (context.Context, error) {
-	gi, err := lnd.GetInfo(ctx, &lnrpc.GetInfoRequest{})
-	if err != nil {
-		return nil, err
-	}
-	ctx = metadata.AppendToOutgoingContext(ctx, "pubkey", gi.IdentityPubkey)
-
-	sig, err := lnd.SignMessage(ctx, &lnrpc.SignMessageRequest{Msg: []byte(*msg)})
-	if err != nil {
-		return nil, err
+// GetPfContext appends the pubkey and session token to the context. If
+// there is no valid session, a challenge is requested from the fileserver,
+// signed with lnd and exchanged for a new session token.
+func GetPfContext(ctx context.Context, lnd lnrpc.LightningClient, lnfs api.PrivateFileStoreClient, sess *session) (context.Context, error) {
+	sess.Lock()
+	defer sess.Unlock()
+	if sess.token == "" || time.Now().UTC().Unix()+sessionRenewMargin >= sess.expiry {
+		gi, err := lnd.GetInfo(ctx, &lnrpc.GetInfoRequest{})
+		if err != nil {
+			return nil, err
+		}
+		challenge, err := lnfs.GetChallenge(ctx, &api.GetChallengeRequest{})
+		if err != nil {
+			return nil, err
+		}
+		sig, err := lnd.SignMessage(ctx, &lnrpc.SignMessageRequest{Msg: []byte(lndutils.ChallengeMsg(challenge.Challenge))})
+		if err != nil {
+			return nil, err
+		}
+		res, err := lnfs.Authenticate(ctx, &api.AuthenticateRequest{
+			Pubkey:    gi.IdentityPubkey,
+			Challenge: challenge.Challenge,
+			Sig:       sig.Signature,
+		})
+		if err != nil {
+			return nil, err
+		}
+		sess.pubkey = gi.IdentityPubkey
+		sess.token = res.Token
+		sess.expiry = res.Expiry
 	}
 
-	ctx = metadata.AppendToOutgoingContext(ctx, "sig", sig.Signature)
+	ctx = metadata.AppendToOutgoingContext(ctx, "pubkey", sess.pubkey, "token", sess.token)
 	return ctx, nil
 }
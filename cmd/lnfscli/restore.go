@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/sputn1ck/ln-fileserver/api"
+	"github.com/sputn1ck/ln-fileserver/utils"
+	"github.com/urfave/cli"
+	"golang.org/x/net/context"
+	"strings"
+)
+
+var restoreCommand = cli.Command{
+	Name:  "restore",
+	Usage: "downloads the newest channel backup and restores it with lnd",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "id",
+			Usage: "id of the backup to restore (default: newest channel backup)",
+		},
+		cli.BoolFlag{
+			Name:  "force",
+			Usage: "if set doesnt wait for fee confirmation",
+		},
+	},
+	Action: restore,
+}
+
+func restore(ctx *cli.Context) error {
+	ctxb := context.Background()
+	lnfs, lnd, cleanUp := getClients(ctx)
+	defer cleanUp()
+
+	backups, err := listBackups(ctxb, lnfs, lnd, nil)
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		return fmt.Errorf("no channel backup found")
+	}
+	backup := backups[0]
+	if ctx.IsSet("id") {
+		backup = nil
+		for _, b := range backups {
+			if b.FileId == ctx.String("id") {
+				backup = b
+			}
+		}
+		if backup == nil {
+			return fmt.Errorf("channel backup %s not found", ctx.String("id"))
+		}
+	}
+	if !ctx.Bool("force") {
+		getinfo, err := lnfs.GetInfo(ctxb, &api.GetInfoRequest{})
+		if err != nil {
+			return err
+		}
+		fee := utils.GetTotalDownloadFee(backup.Bytes, getinfo.FeeReport)
+		fmt.Printf("\n Restoring backup: %v (%v), Estimated fee: %v", backup.Filename, backup.FileId, fee)
+		do := promptForConfirmation("\n Confirm restore (yes/no): ")
+		if !do {
+			return fmt.Errorf("aborted restore")
+		}
+	}
+
+	multiChanBackup, paid, err := downloadBackup(ctxb, lnfs, lnd, backup)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\n Downloaded backup %v, paid %v mSats", backup.FileId, paid)
+
+	_, err = lnd.RestoreChannelBackups(ctxb, &lnrpc.RestoreChanBackupRequest{
+		Backup: &lnrpc.RestoreChanBackupRequest_MultiChanBackup{
+			MultiChanBackup: multiChanBackup,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to restore channel backup: %v", err)
+	}
+	fmt.Printf("\n Restored channel backup %v", backup.Filename)
+	return nil
+}
+
+// downloadBackup downloads the backup, verifies its checksum and decrypts
+// it if needed. It returns the multi channel backup and the amount of msats
+// paid.
+func downloadBackup(ctx context.Context, lnfs api.PrivateFileStoreClient, lnd lnrpc.LightningClient, backup *api.FileSlot) ([]byte, int64, error) {
+	stream, err := lnfs.DownloadFile(ctx, &api.DownloadFileRequest{FileId: backup.FileId})
+	if err != nil {
+		return nil, 0, err
+	}
+	res, err := stream.Recv()
+	if err != nil {
+		return nil, 0, err
+	}
+	fileInfo := res.GetFileInfo()
+	if fileInfo == nil {
+		return nil, 0, fmt.Errorf("fileinfo expected")
+	}
+	var buf bytes.Buffer
+	paid, err := downloadStream(ctx, lnd, stream, &buf)
+	if err != nil {
+		return nil, paid, err
+	}
+	checksum := sha256.Sum256(buf.Bytes())
+	if !strings.EqualFold(hex.EncodeToString(checksum[:]), fileInfo.ShaChecksum) {
+		return nil, paid, fmt.Errorf("checksum of backup %s does not match, expected %s got %x", backup.FileId, fileInfo.ShaChecksum, checksum)
+	}
+	multiChanBackup := buf.Bytes()
+	if isEncrypted(fileInfo.Filename) {
+		key, err := deriveEncryptionKey(ctx, lnd)
+		if err != nil {
+			return nil, paid, err
+		}
+		var plain bytes.Buffer
+		if err := decryptStream(key, bytes.NewReader(multiChanBackup), &plain); err != nil {
+			return nil, paid, err
+		}
+		multiChanBackup = plain.Bytes()
+	}
+	// backups uploaded by backupd also carry the checksum of the plaintext
+	if sha := backupChecksum(backup); sha != backup.Description {
+		plainChecksum := sha256.Sum256(multiChanBackup)
+		if !strings.EqualFold(hex.EncodeToString(plainChecksum[:]), sha) {
+			return nil, paid, fmt.Errorf("checksum of decrypted backup %s does not match", backup.FileId)
+		}
+	}
+	return multiChanBackup, paid, nil
+}
@@ -0,0 +1,47 @@
+package filestore
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+var (
+	BlobNotFoundErr = fmt.Errorf("blob not found")
+	InvalidRangeErr = fmt.Errorf("range starts after the end of the blob")
+)
+
+// BlobStore stores the content of finished uploads. Keys are slash
+// separated paths.
+type BlobStore interface {
+	// Put stores size bytes read from r under the key.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get returns a reader for the whole blob.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// GetRange returns a reader for length bytes starting at offset. A
+	// length of 0 reads until the end of the blob. Reading at the end of
+	// the blob returns nothing, offsets after the end return
+	// InvalidRangeErr.
+	GetRange(ctx context.Context, key string, offset int64, length int64) (io.ReadCloser, error)
+	// Delete removes the blob, deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+	// Stat returns the size of the blob or BlobNotFoundErr.
+	Stat(ctx context.Context, key string) (int64, error)
+}
+
+// blobFileMover is implemented by blob stores that can take over a local
+// file without copying it.
+type blobFileMover interface {
+	PutFile(ctx context.Context, key string, path string) error
+}
+
+// blobKey returns the key of the file of the user.
+func blobKey(pubkey string, fileid string) string {
+	return pubkey + "/" + fileid
+}
+
+// readCloser combines a reader with the closer of the underlying blob.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,115 @@
+package filestore
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// LocalBlobStore stores blobs as files below a directory.
+type LocalBlobStore struct {
+	baseDir string
+}
+
+func NewLocalBlobStore(baseDir string) *LocalBlobStore {
+	return &LocalBlobStore{baseDir: baseDir}
+}
+
+func (l *LocalBlobStore) path(key string) string {
+	return filepath.Join(l.baseDir, filepath.FromSlash(key))
+}
+
+func (l *LocalBlobStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	path := l.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), dirPermissions); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.CopyN(tmp, r, size); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// PutFile moves the local file to the key.
+func (l *LocalBlobStore) PutFile(ctx context.Context, key string, path string) error {
+	target := l.path(key)
+	if target == path {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), dirPermissions); err != nil {
+		return err
+	}
+	return os.Rename(path, target)
+}
+
+func (l *LocalBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	f, err := os.Open(l.path(key))
+	if os.IsNotExist(err) {
+		return nil, BlobNotFoundErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (l *LocalBlobStore) GetRange(ctx context.Context, key string, offset int64, length int64) (io.ReadCloser, error) {
+	f, err := os.Open(l.path(key))
+	if os.IsNotExist(err) {
+		return nil, BlobNotFoundErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if offset > fi.Size() {
+		f.Close()
+		return nil, InvalidRangeErr
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if length <= 0 {
+		return f, nil
+	}
+	return &readCloser{Reader: io.LimitReader(f, length), Closer: f}, nil
+}
+
+func (l *LocalBlobStore) Delete(ctx context.Context, key string) error {
+	err := os.Remove(l.path(key))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (l *LocalBlobStore) Stat(ctx context.Context, key string) (int64, error) {
+	fi, err := os.Stat(l.path(key))
+	if os.IsNotExist(err) {
+		return 0, BlobNotFoundErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
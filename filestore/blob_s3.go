@@ -0,0 +1,137 @@
+package filestore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+
+	minio "github.com/minio/minio-go"
+)
+
+// S3BlobStore stores blobs in a bucket of an S3 compatible object store.
+type S3BlobStore struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// S3Config configures the connection to the object store.
+type S3Config struct {
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	Region    string
+	Bucket    string
+	// Prefix is prepended to all keys.
+	Prefix string
+	// Insecure disables TLS.
+	Insecure bool
+}
+
+// NewS3BlobStore connects to the object store and creates the bucket if it
+// does not exist.
+func NewS3BlobStore(cfg S3Config) (*S3BlobStore, error) {
+	client, err := minio.NewWithRegion(cfg.Endpoint, cfg.AccessKey, cfg.SecretKey, !cfg.Insecure, cfg.Region)
+	if err != nil {
+		return nil, err
+	}
+	exists, err := client.BucketExists(cfg.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if err := client.MakeBucket(cfg.Bucket, cfg.Region); err != nil {
+			return nil, err
+		}
+	}
+	return &S3BlobStore{client: client, bucket: cfg.Bucket, prefix: cfg.Prefix}, nil
+}
+
+func (s *S3BlobStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	_, err := s.client.PutObjectWithContext(ctx, s.bucket, s.prefix+key, r, size, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+	return err
+}
+
+func (s *S3BlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.GetRange(ctx, key, 0, 0)
+}
+
+func (s *S3BlobStore) GetRange(ctx context.Context, key string, offset int64, length int64) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{}
+	var err error
+	switch {
+	case length > 0:
+		err = opts.SetRange(offset, offset+length-1)
+	case offset > 0:
+		err = opts.SetRange(offset, 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+	obj, err := s.client.GetObjectWithContext(ctx, s.bucket, s.prefix+key, opts)
+	if err != nil {
+		return nil, s3Error(err)
+	}
+	// the request is only sent on the first read. Object.Stat would drop
+	// the range, so the first byte is peeked to return errors right away.
+	r := bufio.NewReader(obj)
+	if _, err := r.Peek(1); err != nil && err != io.EOF {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code != "InvalidRange" {
+			return nil, s3Error(err)
+		}
+		// reading at the end of the blob returns nothing
+		size, statErr := s.Stat(ctx, key)
+		if statErr != nil {
+			return nil, statErr
+		}
+		if offset != size {
+			return nil, InvalidRangeErr
+		}
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}
+	return &readCloser{Reader: r, Closer: obj}, nil
+}
+
+func (s *S3BlobStore) Delete(ctx context.Context, key string) error {
+	// the multi object delete is the only removal that takes a context
+	keys := make(chan string, 1)
+	keys <- s.prefix + key
+	close(keys)
+	for removeErr := range s.client.RemoveObjectsWithContext(ctx, s.bucket, keys) {
+		if err := s3Error(removeErr.Err); err != BlobNotFoundErr {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *S3BlobStore) Stat(ctx context.Context, key string) (int64, error) {
+	// the stat of an object that was not read yet is a head request that
+	// takes the context, unlike StatObject
+	obj, err := s.client.GetObjectWithContext(ctx, s.bucket, s.prefix+key, minio.GetObjectOptions{})
+	if err != nil {
+		return 0, s3Error(err)
+	}
+	defer obj.Close()
+	info, err := obj.Stat()
+	if err != nil {
+		return 0, s3Error(err)
+	}
+	return info.Size, nil
+}
+
+// s3Error maps missing objects to BlobNotFoundErr.
+func s3Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return BlobNotFoundErr
+	}
+	return err
+}
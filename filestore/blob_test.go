@@ -0,0 +1,475 @@
+package filestore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is a minimal S3 compatible object store serving a single bucket.
+// Keys containing "denied" are refused with AccessDenied.
+type fakeS3 struct {
+	bucket  string
+	mu      sync.Mutex
+	created bool
+	objects map[string][]byte
+}
+
+func newFakeS3(bucket string) *fakeS3 {
+	return &fakeS3{bucket: bucket, objects: make(map[string][]byte)}
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if path[0] != s.bucket {
+		s.error(w, r, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	if len(path) == 1 || path[1] == "" {
+		switch r.Method {
+		case http.MethodHead:
+			if !s.created {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case http.MethodPut:
+			s.created = true
+		case http.MethodPost:
+			s.deleteObjects(w, r)
+		default:
+			s.error(w, r, http.StatusNotImplemented, "NotImplemented")
+		}
+		return
+	}
+	key := path[1]
+	if strings.Contains(key, "denied") {
+		s.error(w, r, http.StatusForbidden, "AccessDenied")
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		content, err := readS3Body(r)
+		if err != nil {
+			s.error(w, r, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		s.objects[key] = content
+		w.Header().Set("ETag", `"etag"`)
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodHead, http.MethodGet:
+		content, ok := s.objects[key]
+		if !ok {
+			s.error(w, r, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		status := http.StatusOK
+		if rng := r.Header.Get("Range"); rng != "" {
+			start, end, ok := parseRange(rng, int64(len(content)))
+			if !ok {
+				s.error(w, r, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+				return
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(content)))
+			content = content[start : end+1]
+			status = http.StatusPartialContent
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.WriteHeader(status)
+		if r.Method == http.MethodGet {
+			w.Write(content)
+		}
+	default:
+		s.error(w, r, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// deleteObjects handles a multi object delete.
+func (s *fakeS3) deleteObjects(w http.ResponseWriter, r *http.Request) {
+	if _, ok := r.URL.Query()["delete"]; !ok {
+		s.error(w, r, http.StatusNotImplemented, "NotImplemented")
+		return
+	}
+	var req struct {
+		Objects []struct {
+			Key string
+		} `xml:"Object"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.error(w, r, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+	var res bytes.Buffer
+	res.WriteString("<DeleteResult>")
+	for _, object := range req.Objects {
+		if strings.Contains(object.Key, "denied") {
+			fmt.Fprintf(&res, "<Error><Key>%s</Key><Code>AccessDenied</Code><Message>AccessDenied</Message></Error>", object.Key)
+			continue
+		}
+		delete(s.objects, object.Key)
+	}
+	res.WriteString("</DeleteResult>")
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write(res.Bytes())
+}
+
+// error writes an S3 error response, HEAD responses have no body.
+func (s *fakeS3) error(w http.ResponseWriter, r *http.Request, status int, code string) {
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message><Resource>%s</Resource></Error>", code, code, r.URL.Path)
+}
+
+// parseRange parses a range header of the form bytes=start-[end] and clips
+// the end to the size.
+func parseRange(rng string, size int64) (int64, int64, bool) {
+	bounds := strings.SplitN(strings.TrimPrefix(rng, "bytes="), "-", 2)
+	if len(bounds) != 2 {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(bounds[0], 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if bounds[1] != "" {
+		end, err = strconv.ParseInt(bounds[1], 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end, true
+}
+
+// readS3Body reads the body of a put request, decoding the chunks of
+// streaming signed uploads.
+func readS3Body(r *http.Request) ([]byte, error) {
+	if r.Header.Get("X-Amz-Content-Sha256") != "STREAMING-AWS4-HMAC-SHA256-PAYLOAD" {
+		return ioutil.ReadAll(r.Body)
+	}
+	var content []byte
+	body := bufio.NewReader(r.Body)
+	for {
+		header, err := body.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.ParseInt(strings.SplitN(header, ";", 2)[0], 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		chunk := make([]byte, size+2)
+		if _, err := io.ReadFull(body, chunk); err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return content, nil
+		}
+		content = append(content, chunk[:size]...)
+	}
+}
+
+func readBlob(r io.ReadCloser, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// testBlobStore checks the contract of BlobStore.
+func testBlobStore(t *testing.T, blobs BlobStore) {
+	ctx := context.Background()
+	key := blobKey(testPubkey, testFileId)
+	content := make([]byte, 1000)
+	for i := range content {
+		content[i] = byte(i)
+	}
+
+	if _, err := blobs.Stat(ctx, key); err != BlobNotFoundErr {
+		t.Fatalf("Stat of missing blob: expected %v, got %v", BlobNotFoundErr, err)
+	}
+	if _, err := blobs.Get(ctx, key); err != BlobNotFoundErr {
+		t.Fatalf("Get of missing blob: expected %v, got %v", BlobNotFoundErr, err)
+	}
+	if _, err := blobs.GetRange(ctx, key, 10, 10); err != BlobNotFoundErr {
+		t.Fatalf("GetRange of missing blob: expected %v, got %v", BlobNotFoundErr, err)
+	}
+	if err := blobs.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete of missing blob: %v", err)
+	}
+
+	if err := blobs.Put(ctx, key, bytes.NewReader(content), int64(len(content))); err != nil {
+		t.Fatal(err)
+	}
+	size, err := blobs.Stat(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len(content)) {
+		t.Fatalf("expected size %v, got %v", len(content), size)
+	}
+	got, err := readBlob(blobs.Get(ctx, key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatalf("Get returned %v bytes that do not match", len(got))
+	}
+
+	ranges := []struct {
+		name     string
+		offset   int64
+		length   int64
+		expected []byte
+	}{
+		{"whole", 0, 0, content},
+		{"range", 10, 20, content[10:30]},
+		{"first byte", 0, 1, content[:1]},
+		{"last byte", 999, 1, content[999:]},
+		{"open ended", 100, 0, content[100:]},
+		{"past the end", 995, 100, content[995:]},
+		{"at the end", 1000, 0, nil},
+		{"range at the end", 1000, 10, nil},
+	}
+	for _, r := range ranges {
+		got, err := readBlob(blobs.GetRange(ctx, key, r.offset, r.length))
+		if err != nil {
+			t.Fatalf("GetRange %v: %v", r.name, err)
+		}
+		if !bytes.Equal(got, r.expected) {
+			t.Fatalf("GetRange %v returned %v bytes, expected %v", r.name, len(got), len(r.expected))
+		}
+	}
+	for _, offset := range []int64{1001, 2000} {
+		if _, err := blobs.GetRange(ctx, key, offset, 0); err != InvalidRangeErr {
+			t.Fatalf("GetRange after the end: expected %v, got %v", InvalidRangeErr, err)
+		}
+		if _, err := blobs.GetRange(ctx, key, offset, 10); err != InvalidRangeErr {
+			t.Fatalf("GetRange of length after the end: expected %v, got %v", InvalidRangeErr, err)
+		}
+	}
+
+	replaced := []byte("replaced")
+	if err := blobs.Put(ctx, key, bytes.NewReader(replaced), int64(len(replaced))); err != nil {
+		t.Fatal(err)
+	}
+	got, err = readBlob(blobs.Get(ctx, key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, replaced) {
+		t.Fatalf("expected the blob to be replaced, got %q", got)
+	}
+
+	if err := blobs.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := blobs.Stat(ctx, key); err != BlobNotFoundErr {
+		t.Fatalf("Stat of deleted blob: expected %v, got %v", BlobNotFoundErr, err)
+	}
+	if _, err := blobs.Get(ctx, key); err != BlobNotFoundErr {
+		t.Fatalf("Get of deleted blob: expected %v, got %v", BlobNotFoundErr, err)
+	}
+}
+
+func TestLocalBlobStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	testBlobStore(t, NewLocalBlobStore(dir))
+}
+
+func TestS3BlobStore(t *testing.T) {
+	blobs, fake, closeS3 := newFakeS3Store(t, "blobs/")
+	defer closeS3()
+	if !fake.created {
+		t.Fatal("bucket was not created")
+	}
+	testBlobStore(t, blobs)
+
+	// keys are stored below the prefix
+	ctx := context.Background()
+	if err := blobs.Put(ctx, "key", bytes.NewReader([]byte("content")), 7); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.objects["blobs/key"]; !ok {
+		t.Fatalf("expected the blob to be stored below the prefix, got %v", fake.objects)
+	}
+
+	// errors other than missing keys are returned as is
+	if _, err := blobs.Stat(ctx, "denied"); err == nil || err == BlobNotFoundErr {
+		t.Fatalf("Stat: expected AccessDenied, got %v", err)
+	}
+	if _, err := blobs.Get(ctx, "denied"); err == nil || err == BlobNotFoundErr {
+		t.Fatalf("Get: expected AccessDenied, got %v", err)
+	}
+	if _, err := blobs.GetRange(ctx, "denied", 10, 0); err == nil || err == BlobNotFoundErr {
+		t.Fatalf("GetRange: expected AccessDenied, got %v", err)
+	}
+	if err := blobs.Delete(ctx, "denied"); err == nil {
+		t.Fatal("Delete: expected AccessDenied")
+	}
+
+	// requests are canceled with the context
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := blobs.Stat(canceled, "key"); err == nil {
+		t.Fatal("Stat: expected the request to be canceled")
+	}
+	if _, err := blobs.GetRange(canceled, "key", 1, 0); err == nil {
+		t.Fatal("GetRange: expected the request to be canceled")
+	}
+	if err := blobs.Delete(canceled, "key"); err == nil {
+		t.Fatal("Delete: expected the request to be canceled")
+	}
+	if _, ok := fake.objects["blobs/key"]; !ok {
+		t.Fatal("canceled delete removed the blob")
+	}
+}
+
+// newFakeS3Store returns a blob store backed by a new fake S3 server and the
+// fake to inspect the stored objects.
+func newFakeS3Store(t *testing.T, prefix string) (*S3BlobStore, *fakeS3, func()) {
+	fake := newFakeS3("files")
+	srv := httptest.NewServer(fake)
+	blobs, err := NewS3BlobStore(S3Config{
+		Endpoint:  strings.TrimPrefix(srv.URL, "http://"),
+		AccessKey: "access",
+		SecretKey: "secret",
+		Region:    "us-east-1",
+		Bucket:    "files",
+		Prefix:    prefix,
+		Insecure:  true,
+	})
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	return blobs, fake, srv.Close
+}
+
+func TestServiceS3(t *testing.T) {
+	// compressible content of several encrypted chunks
+	content := bytes.Repeat([]byte("lightning network file server "), 10000)
+	tests := []struct {
+		name     string
+		compress bool
+		dedup    bool
+		encrypt  bool
+	}{
+		{name: "plain"},
+		{name: "compressed", compress: true},
+		{name: "dedup", dedup: true},
+		{name: "encrypted", encrypt: true},
+		{name: "all", compress: true, dedup: true, encrypt: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs, _, cleanup := newTestService(t)
+			defer cleanup()
+			blobs, fake, closeS3 := newFakeS3Store(t, "")
+			defer closeS3()
+			fs.SetBlobStore(blobs)
+			ctx := context.Background()
+			if test.compress {
+				fs.EnableCompression()
+			}
+			if test.dedup {
+				if err := fs.EnableDedup(ctx); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if test.encrypt {
+				key, err := NewMasterKey(bytes.Repeat([]byte{7}, 32))
+				if err != nil {
+					t.Fatal(err)
+				}
+				fs.EnableEncryption(key)
+			}
+
+			owners := []string{testPubkey, otherPubkey}
+			var slots []*FileSlot
+			for _, pubkey := range owners {
+				slots = append(slots, uploadTestFile(t, fs, pubkey, content))
+			}
+			blobCount := len(owners)
+			if test.dedup {
+				blobCount = 1
+			}
+			if len(fake.objects) != blobCount {
+				t.Fatalf("expected %v blobs in the bucket, got %v", blobCount, len(fake.objects))
+			}
+			for _, blob := range fake.objects {
+				if test.encrypt && bytes.Contains(blob, content[:100]) {
+					t.Fatal("encrypted blob contains the plaintext")
+				}
+				if test.compress && len(blob) >= len(content) {
+					t.Fatalf("compressed blob has %v bytes, the content %v", len(blob), len(content))
+				}
+			}
+
+			for i, pubkey := range owners {
+				got, err := readBlob(fs.GetFileReader(ctx, pubkey, slots[i].Id))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, content) {
+					t.Fatalf("downloaded %v bytes that do not match the upload", len(got))
+				}
+				for _, r := range [][2]int64{{70000, 1000}, {100, 0}, {int64(len(content)) - 10, 0}, {int64(len(content)), 0}} {
+					got, err := readBlob(fs.GetFileRange(ctx, pubkey, slots[i].Id, r[0], r[1]))
+					if err != nil {
+						t.Fatalf("range %v: %v", r, err)
+					}
+					expected := content[r[0]:]
+					if r[1] > 0 {
+						expected = expected[:r[1]]
+					}
+					if !bytes.Equal(got, expected) {
+						t.Fatalf("range %v returned %v bytes that do not match", r, len(got))
+					}
+				}
+			}
+
+			for i, pubkey := range owners {
+				if err := fs.DeleteFile(ctx, pubkey, slots[i].Id); err != nil {
+					t.Fatal(err)
+				}
+				left := len(owners) - i - 1
+				if test.dedup && left > 0 {
+					left = 1
+				}
+				if len(fake.objects) != left {
+					t.Fatalf("expected %v blobs after deleting %v files, got %v", left, i+1, len(fake.objects))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package filestore
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"gopkg.in/yaml.v2"
+)
+
+// BoltDbName is the name of the metadata database in the data dir.
+const BoltDbName = "metadata.db"
+
+var (
+	usersBucket  = []byte("users")
+	filesBucket  = []byte("files")
+	expiryBucket = []byte("expiry")
+
+	UserExistsErr = fmt.Errorf("userconfig already exists")
+)
+
+// BoltUserConfigStore stores the user configs in a bbolt database. Besides
+// the configs it keeps an index of file ids to their owner and of all files
+// by deletion date.
+type BoltUserConfigStore struct {
+	db   *bolt.DB
+	keys *keyRing
+}
+
+// NewBoltUserConfigStore opens or creates the database at path.
+func NewBoltUserConfigStore(path string) (*BoltUserConfigStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("unable to open metadata db: %v", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{usersBucket, filesBucket, expiryBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltUserConfigStore{db: db}, nil
+}
+
+// SetMasterKey encrypts the stored configs with a data key wrapped by the
+// master key. Unencrypted configs are encrypted once they are updated. The
+// indexes only hold file ids, deletion dates and pubkeys and are not
+// encrypted.
+func (b *BoltUserConfigStore) SetMasterKey(key *MasterKey) {
+	b.keys = newKeyRing(key)
+}
+
+func (b *BoltUserConfigStore) setKeyRing(keys *keyRing) {
+	b.keys = keys
+}
+
+// Close closes the database.
+func (b *BoltUserConfigStore) Close() error {
+	return b.db.Close()
+}
+
+func (b *BoltUserConfigStore) Create(ctx context.Context, pubkey string) (*UserConfig, error) {
+	if err := ValidatePubkey(pubkey); err != nil {
+		return nil, err
+	}
+	userConfig := &UserConfig{Pubkey: pubkey}
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(usersBucket).Get([]byte(pubkey)) != nil {
+			return UserExistsErr
+		}
+		return b.putUserConfig(tx, userConfig)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return userConfig, nil
+}
+
+func (b *BoltUserConfigStore) Read(ctx context.Context, pubkey string) (*UserConfig, error) {
+	if err := ValidatePubkey(pubkey); err != nil {
+		return nil, err
+	}
+	var userConfig *UserConfig
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		userConfig, err = b.getUserConfig(tx, pubkey)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return userConfig, nil
+}
+
+func (b *BoltUserConfigStore) Update(ctx context.Context, config *UserConfig) error {
+	if err := ValidatePubkey(config.Pubkey); err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		old, err := b.getUserConfig(tx, config.Pubkey)
+		if err != nil {
+			return err
+		}
+		if err := removeIndexes(tx, old); err != nil {
+			return err
+		}
+		return b.putUserConfig(tx, config)
+	})
+}
+
+func (b *BoltUserConfigStore) ListUsers(ctx context.Context) ([]string, error) {
+	var pubkeys []string
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(usersBucket).ForEach(func(k, v []byte) error {
+			pubkeys = append(pubkeys, string(k))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pubkeys, nil
+}
+
+// FileOwner returns the pubkey of the user owning the file or pending
+// upload.
+func (b *BoltUserConfigStore) FileOwner(ctx context.Context, fileid string) (string, error) {
+	var pubkey string
+	err := b.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(filesBucket).Get([]byte(fileid))
+		if v == nil {
+			return FileNotFoundErr
+		}
+		pubkey = string(v)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return pubkey, nil
+}
+
+// ExpiredUsers returns the pubkeys of all users owning files whose deletion
+// date is before the given unix timestamp.
+func (b *BoltUserConfigStore) ExpiredUsers(ctx context.Context, before int64) ([]string, error) {
+	var pubkeys []string
+	seen := make(map[string]bool)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(expiryBucket).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if int64(binary.BigEndian.Uint64(k[:8])) >= before {
+				break
+			}
+			if !seen[string(v)] {
+				seen[string(v)] = true
+				pubkeys = append(pubkeys, string(v))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pubkeys, nil
+}
+
+func (b *BoltUserConfigStore) getUserConfig(tx *bolt.Tx, pubkey string) (*UserConfig, error) {
+	configBytes := tx.Bucket(usersBucket).Get([]byte(pubkey))
+	if configBytes == nil {
+		return nil, NotFoundErr
+	}
+	configBytes, err := b.keys.openConfig(configBytes)
+	if err != nil {
+		return nil, err
+	}
+	userConfig := &UserConfig{}
+	if err := yaml.Unmarshal(configBytes, userConfig); err != nil {
+		return nil, err
+	}
+	return userConfig, nil
+}
+
+// putUserConfig stores the config and adds its files to the indexes.
+func (b *BoltUserConfigStore) putUserConfig(tx *bolt.Tx, config *UserConfig) error {
+	configBytes, err := yaml.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("unable to marshal Fileslot: %v", err)
+	}
+	configBytes, err = b.keys.sealConfig(configBytes)
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(usersBucket).Put([]byte(config.Pubkey), configBytes); err != nil {
+		return err
+	}
+	files := tx.Bucket(filesBucket)
+	expiry := tx.Bucket(expiryBucket)
+	for _, slots := range []map[string]*FileSlot{config.FileSlots, config.PendingSlots} {
+		for id, slot := range slots {
+			if err := files.Put([]byte(id), []byte(config.Pubkey)); err != nil {
+				return err
+			}
+			if err := expiry.Put(expiryKey(slot.DeletionDate, id), []byte(config.Pubkey)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// removeIndexes removes the files of the config from the indexes.
+func removeIndexes(tx *bolt.Tx, config *UserConfig) error {
+	files := tx.Bucket(filesBucket)
+	expiry := tx.Bucket(expiryBucket)
+	for _, slots := range []map[string]*FileSlot{config.FileSlots, config.PendingSlots} {
+		for id, slot := range slots {
+			if err := files.Delete([]byte(id)); err != nil {
+				return err
+			}
+			if err := expiry.Delete(expiryKey(slot.DeletionDate, id)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// expiryKey orders the files by deletion date.
+func expiryKey(deletionDate int64, fileid string) []byte {
+	key := make([]byte, 8+len(fileid))
+	binary.BigEndian.PutUint64(key, uint64(deletionDate))
+	copy(key[8:], fileid)
+	return key
+}
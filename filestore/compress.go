@@ -0,0 +1,115 @@
+package filestore
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// CompressionGzip is the compression of blobs compressed with gzip.
+const CompressionGzip = "gzip"
+
+// EnableCompression compresses finished files before they are stored.
+// Files that do not get smaller are stored uncompressed. Downloads are
+// decompressed transparently.
+func (s *Service) EnableCompression() {
+	s.compression = CompressionGzip
+}
+
+// Compression returns the compression of new blobs, empty if files are
+// stored uncompressed.
+func (s *Service) Compression() string {
+	return s.compression
+}
+
+// compressUpload compresses the finished upload into a new staging file. It
+// returns the file that has to be stored, which is the upload itself if
+// compression is disabled or does not pay off, and sets the physical size
+// and compression of the slot.
+func (s *Service) compressUpload(slot *FileSlot, file *os.File) (*os.File, error) {
+	slot.PhysicalBytes = slot.Bytes
+	if s.compression == "" {
+		return file, nil
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	compressed, err := ioutil.TempFile(filepath.Dir(file.Name()), ".compress-*")
+	if err != nil {
+		return nil, err
+	}
+	zw := gzip.NewWriter(compressed)
+	_, err = io.Copy(zw, file)
+	if err == nil {
+		err = zw.Close()
+	}
+	var fi os.FileInfo
+	if err == nil {
+		fi, err = compressed.Stat()
+	}
+	if err != nil || fi.Size() >= slot.Bytes {
+		compressed.Close()
+		os.Remove(compressed.Name())
+		if err != nil {
+			return nil, err
+		}
+		return file, nil
+	}
+	slot.Compression = s.compression
+	slot.PhysicalBytes = fi.Size()
+	return compressed, nil
+}
+
+// openBlob returns a reader for the decompressed content of the slot.
+func (s *Service) openBlob(ctx context.Context, pubkey string, slot *FileSlot) (io.ReadCloser, error) {
+	blob, err := s.openStored(ctx, pubkey, slot, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	if slot.Compression == "" {
+		return blob, nil
+	}
+	zr, err := gzip.NewReader(blob)
+	if err != nil {
+		blob.Close()
+		return nil, err
+	}
+	return readCloser{Reader: zr, Closer: blob}, nil
+}
+
+// openStored returns a reader for length bytes of the stored, possibly
+// compressed, blob of the slot starting at offset. Encrypted blobs are
+// decrypted.
+func (s *Service) openStored(ctx context.Context, pubkey string, slot *FileSlot, offset int64, length int64) (io.ReadCloser, error) {
+	if slot.EncryptedKey != "" {
+		return s.openEncrypted(ctx, pubkey, slot, offset, length)
+	}
+	if offset == 0 && length == 0 {
+		return s.blobs.Get(ctx, slotBlobKey(pubkey, slot))
+	}
+	return s.blobs.GetRange(ctx, slotBlobKey(pubkey, slot), offset, length)
+}
+
+// openBlobRange returns a reader for length bytes of the decompressed content
+// of the slot starting at offset. Compressed blobs are decompressed from the
+// start, as the offset can not be mapped to the compressed stream.
+func (s *Service) openBlobRange(ctx context.Context, pubkey string, slot *FileSlot, offset int64, length int64) (io.ReadCloser, error) {
+	if slot.Compression == "" {
+		return s.openStored(ctx, pubkey, slot, offset, length)
+	}
+	r, err := s.openBlob(ctx, pubkey, slot)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(ioutil.Discard, r, offset); err != nil && err != io.EOF {
+		r.Close()
+		return nil, err
+	}
+	if length == 0 {
+		return r, nil
+	}
+	return readCloser{Reader: io.LimitReader(r, length), Closer: r}, nil
+}
@@ -0,0 +1,119 @@
+package filestore
+
+import (
+	"context"
+	"os"
+	"sync"
+)
+
+// blobRefs counts the file slots referencing a content addressed blob.
+type blobRefs struct {
+	sync.Mutex
+	counts map[string]int
+	// keys holds the wrapped data keys of encrypted blobs
+	keys map[string]string
+}
+
+// contentKey returns the key of the content addressed blob of the slot.
+// Compressed and encrypted blobs are stored separately from plain ones.
+func contentKey(slot *FileSlot) string {
+	key := "sha256/" + slot.Sha256Checksum
+	if slot.Compression != "" {
+		key += "." + slot.Compression
+	}
+	if slot.EncryptedKey != "" {
+		key += ".enc"
+	}
+	return key
+}
+
+// EnableDedup stores finished files by their sha256 checksum, so identical
+// files of all users are only stored once. The references of existing
+// files are counted on startup. Once enabled it has to stay enabled, as
+// shared blobs are never removed without reference counts.
+func (s *Service) EnableDedup(ctx context.Context) error {
+	refs := &blobRefs{counts: make(map[string]int), keys: make(map[string]string)}
+	pubkeys, err := s.store.ListUsers(ctx)
+	if err != nil {
+		return err
+	}
+	for _, pubkey := range pubkeys {
+		userConfig, err := s.store.Read(ctx, pubkey)
+		if err != nil {
+			return err
+		}
+		for _, slot := range userConfig.FileSlots {
+			if slot.BlobKey != "" {
+				refs.counts[slot.BlobKey]++
+				if slot.EncryptedKey != "" {
+					refs.keys[slot.BlobKey] = slot.EncryptedKey
+				}
+			}
+		}
+	}
+	s.refs = refs
+	return nil
+}
+
+// slotBlobKey returns the key of the blob holding the content of the slot.
+func slotBlobKey(pubkey string, slot *FileSlot) string {
+	if slot.BlobKey != "" {
+		return slot.BlobKey
+	}
+	return blobKey(pubkey, slot.Id)
+}
+
+// storeDedup stores the finished upload as content addressed blob unless it
+// already exists and references it from the slot. A slot referencing an
+// existing encrypted blob takes over its data key.
+func (s *Service) storeDedup(ctx context.Context, slot *FileSlot, file *os.File) error {
+	key := contentKey(slot)
+	s.refs.Lock()
+	defer s.refs.Unlock()
+	if s.refs.counts[key] == 0 {
+		if err := s.putBlob(ctx, key, file, slot.PhysicalBytes); err != nil {
+			return err
+		}
+		if slot.EncryptedKey != "" {
+			s.refs.keys[key] = slot.EncryptedKey
+		}
+	} else if err := removeFile(file.Name()); err != nil {
+		return err
+	} else if slot.EncryptedKey != "" {
+		slot.EncryptedKey = s.refs.keys[key]
+	}
+	s.refs.counts[key]++
+	slot.BlobKey = key
+	return nil
+}
+
+// releaseBlob removes the blob of a deleted slot. Content addressed blobs
+// are only removed once the last slot referencing them is deleted.
+func (s *Service) releaseBlob(ctx context.Context, pubkey string, slot *FileSlot) error {
+	if slot.BlobKey == "" {
+		return s.blobs.Delete(ctx, blobKey(pubkey, slot.Id))
+	}
+	if s.refs == nil {
+		return nil
+	}
+	s.refs.Lock()
+	defer s.refs.Unlock()
+	s.refs.counts[slot.BlobKey]--
+	if s.refs.counts[slot.BlobKey] > 0 {
+		return nil
+	}
+	delete(s.refs.counts, slot.BlobKey)
+	delete(s.refs.keys, slot.BlobKey)
+	return s.blobs.Delete(ctx, slot.BlobKey)
+}
+
+// releaseShared drops the reference of a slot that could not be saved. The
+// blob of a file that is not deduplicated is kept, so the upload can be
+// finished again.
+func (s *Service) releaseShared(ctx context.Context, pubkey string, slot *FileSlot) {
+	if slot.BlobKey == "" {
+		return
+	}
+	s.releaseBlob(ctx, pubkey, slot)
+	slot.BlobKey = ""
+}
@@ -0,0 +1,80 @@
+package filestore
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"testing"
+)
+
+const otherPubkey = "03bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+
+// failingStore fails to update the configs while fail is set.
+type failingStore struct {
+	UserConfigStore
+	fail bool
+}
+
+func (f *failingStore) Update(ctx context.Context, config *UserConfig) error {
+	if f.fail {
+		return fmt.Errorf("update failed")
+	}
+	return f.UserConfigStore.Update(ctx, config)
+}
+
+func TestDedupFailedDeleteKeepsSharedBlob(t *testing.T) {
+	fs, dir, cleanup := newTestService(t)
+	defer cleanup()
+	store := &failingStore{UserConfigStore: NewYmlUserConfigStore(dir)}
+	fs.store = store
+	ctx := context.Background()
+	if err := fs.EnableDedup(ctx); err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("shared content")
+	mine := uploadTestFile(t, fs, testPubkey, content)
+	other := uploadTestFile(t, fs, otherPubkey, content)
+	if mine.BlobKey == "" || mine.BlobKey != other.BlobKey {
+		t.Fatalf("expected a shared blob, got %q and %q", mine.BlobKey, other.BlobKey)
+	}
+
+	for _, del := range []func() error{
+		func() error { return fs.DeleteFile(ctx, testPubkey, mine.Id) },
+		func() error {
+			_, err := fs.DeleteExpired(ctx, testPubkey, 4102444801)
+			return err
+		},
+	} {
+		store.fail = true
+		if err := del(); err == nil {
+			t.Fatal("expected delete to fail")
+		}
+		store.fail = false
+		if _, err := fs.GetFile(ctx, testPubkey, mine.Id); err != nil {
+			t.Fatalf("slot removed by failed delete: %v", err)
+		}
+	}
+	if err := fs.DeleteFile(ctx, testPubkey, mine.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := fs.GetFileReader(ctx, otherPubkey, other.Id)
+	if err != nil {
+		t.Fatalf("shared blob removed: %v", err)
+	}
+	defer reader.Close()
+	read, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(read) != string(content) {
+		t.Fatalf("expected %q, got %q", content, read)
+	}
+
+	if err := fs.DeleteFile(ctx, otherPubkey, other.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.blobs.Stat(ctx, other.BlobKey); err != BlobNotFoundErr {
+		t.Fatalf("expected unreferenced blob to be removed, got %v", err)
+	}
+}
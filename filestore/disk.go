@@ -0,0 +1,29 @@
+//go:build !windows
+// +build !windows
+
+package filestore
+
+import (
+	"os"
+	"syscall"
+)
+
+// freeDiskSpace returns the bytes available to unprivileged users on the
+// filesystem of the path.
+func freeDiskSpace(path string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
+
+// syncDir flushes the directory entry of renamed files to disk.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,14 @@
+package filestore
+
+import "math"
+
+// freeDiskSpace is not implemented on windows, the disk is treated as
+// unlimited.
+func freeDiskSpace(path string) (int64, error) {
+	return math.MaxInt64, nil
+}
+
+// syncDir is a no-op on windows, directories can not be synced there.
+func syncDir(dir string) error {
+	return nil
+}
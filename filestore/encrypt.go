@@ -0,0 +1,381 @@
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// masterKeySize and dataKeySize are the sizes of the AES-256 keys.
+	masterKeySize = 32
+	dataKeySize   = 32
+	// blobChunkSize is the size of the plaintext chunks of encrypted blobs,
+	// which are sealed separately so ranges can be decrypted.
+	blobChunkSize = 64 * 1024
+)
+
+var (
+	// configMagic marks encrypted user configs.
+	configMagic = []byte("LNFSCFG1")
+
+	InvalidMasterKeyErr = fmt.Errorf("master key must be 32 hex encoded bytes")
+	MasterKeyMissingErr = fmt.Errorf("data is encrypted but no master key is set")
+	WrongMasterKeyErr   = fmt.Errorf("unable to unwrap data key with the master key")
+)
+
+// MasterKey wraps the data keys that files and user configs are encrypted
+// with.
+type MasterKey struct {
+	aead cipher.AEAD
+}
+
+// NewMasterKey returns the master key of the 32 key bytes.
+func NewMasterKey(key []byte) (*MasterKey, error) {
+	if len(key) != masterKeySize {
+		return nil, InvalidMasterKeyErr
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &MasterKey{aead: aead}, nil
+}
+
+// ParseMasterKey parses a hex encoded master key.
+func ParseMasterKey(hexKey string) (*MasterKey, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(hexKey))
+	if err != nil {
+		return nil, InvalidMasterKeyErr
+	}
+	return NewMasterKey(key)
+}
+
+// LoadMasterKey reads a hex encoded master key from the file at path.
+func LoadMasterKey(path string) (*MasterKey, error) {
+	hexKey, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseMasterKey(string(hexKey))
+}
+
+// LoadOrParseMasterKey loads the master key from the file at path if it is
+// set, otherwise it parses the hex encoded key. It returns nil if neither
+// is set.
+func LoadOrParseMasterKey(path string, hexKey string) (*MasterKey, error) {
+	switch {
+	case path != "":
+		return LoadMasterKey(path)
+	case hexKey != "":
+		return ParseMasterKey(hexKey)
+	}
+	return nil, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// wrap encrypts the data key.
+func (m *MasterKey) wrap(dataKey []byte) ([]byte, error) {
+	nonce := make([]byte, m.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return m.aead.Seal(nonce, nonce, dataKey, nil), nil
+}
+
+// unwrap decrypts a data key wrapped by wrap.
+func (m *MasterKey) unwrap(wrapped []byte) ([]byte, error) {
+	if len(wrapped) < m.aead.NonceSize() {
+		return nil, WrongMasterKeyErr
+	}
+	dataKey, err := m.aead.Open(nil, wrapped[:m.aead.NonceSize()], wrapped[m.aead.NonceSize():], nil)
+	if err != nil {
+		return nil, WrongMasterKeyErr
+	}
+	return dataKey, nil
+}
+
+// keyRing wraps new data keys with the current master key. During a key
+// rotation data keys may still be wrapped with the previous master key. A
+// nil keyRing stores everything unencrypted.
+type keyRing struct {
+	current  *MasterKey
+	previous *MasterKey
+}
+
+func newKeyRing(key *MasterKey) *keyRing {
+	if key == nil {
+		return nil
+	}
+	return &keyRing{current: key}
+}
+
+// newDataKey returns a random data key and the key wrapped by the current
+// master key.
+func (k *keyRing) newDataKey() ([]byte, []byte, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, err
+	}
+	wrapped, err := k.current.wrap(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dataKey, wrapped, nil
+}
+
+// unwrap decrypts a data key with the current or previous master key.
+func (k *keyRing) unwrap(wrapped []byte) ([]byte, error) {
+	if k == nil {
+		return nil, MasterKeyMissingErr
+	}
+	dataKey, err := k.current.unwrap(wrapped)
+	if err == WrongMasterKeyErr && k.previous != nil {
+		return k.previous.unwrap(wrapped)
+	}
+	return dataKey, err
+}
+
+// rewrap wraps the data key with the current master key.
+func (k *keyRing) rewrap(wrapped []byte) ([]byte, error) {
+	dataKey, err := k.unwrap(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return k.current.wrap(dataKey)
+}
+
+// sealConfig encrypts a marshaled user config with a new data key. The
+// wrapped data key is stored in front of the config.
+func (k *keyRing) sealConfig(plain []byte) ([]byte, error) {
+	if k == nil {
+		return plain, nil
+	}
+	dataKey, wrapped, err := k.newDataKey()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	sealed := make([]byte, len(configMagic)+2, len(configMagic)+2+len(wrapped)+len(plain)+aead.Overhead())
+	copy(sealed, configMagic)
+	binary.BigEndian.PutUint16(sealed[len(configMagic):], uint16(len(wrapped)))
+	sealed = append(sealed, wrapped...)
+	// the data key is only used once, so the nonce can be fixed
+	return aead.Seal(sealed, make([]byte, aead.NonceSize()), plain, nil), nil
+}
+
+// openConfig decrypts a user config sealed by sealConfig. Unencrypted
+// configs are returned as is, so encryption can be enabled for an existing
+// data dir.
+func (k *keyRing) openConfig(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, configMagic) {
+		return data, nil
+	}
+	data = data[len(configMagic):]
+	if len(data) < 2 || len(data) < 2+int(binary.BigEndian.Uint16(data)) {
+		return nil, fmt.Errorf("encrypted config is truncated")
+	}
+	wrapped := data[2 : 2+binary.BigEndian.Uint16(data)]
+	dataKey, err := k.unwrap(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, make([]byte, aead.NonceSize()), data[2+len(wrapped):], nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt config: %v", err)
+	}
+	return plain, nil
+}
+
+// EnableEncryption encrypts finished files with a new data key per file,
+// which is wrapped by the master key and stored in the file slot. Existing
+// unencrypted files stay readable. The user configs are encrypted by the
+// UserConfigStore. Unfinished uploads and the staging files of SaveFile are
+// not encrypted.
+func (s *Service) EnableEncryption(key *MasterKey) {
+	s.keys = newKeyRing(key)
+}
+
+// blobChunkNonce returns the nonce of the i-th chunk of an encrypted blob.
+// Every blob has its own data key, so the nonce only has to be unique within
+// the blob. The last chunk is marked, so a truncated blob can not be
+// decrypted.
+func blobChunkNonce(i uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint32(nonce[7:11], i)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// blobChunks returns the number of chunks of an encrypted blob of the given
+// size. Empty files are stored as a single empty chunk.
+func blobChunks(size int64, sealedChunkSize int64) int64 {
+	chunks := (size + sealedChunkSize - 1) / sealedChunkSize
+	if chunks == 0 {
+		return 1
+	}
+	return chunks
+}
+
+// encryptUpload encrypts the upload into a new staging file if encryption
+// is enabled. It returns the file that has to be stored and sets the
+// physical size and the wrapped data key of the slot.
+func (s *Service) encryptUpload(slot *FileSlot, file *os.File) (*os.File, error) {
+	if s.keys == nil {
+		return file, nil
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	dataKey, wrapped, err := s.keys.newDataKey()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := ioutil.TempFile(filepath.Dir(file.Name()), ".encrypt-*")
+	if err != nil {
+		return nil, err
+	}
+	chunks := blobChunks(fi.Size(), blobChunkSize)
+	buf := make([]byte, blobChunkSize)
+	remaining := fi.Size()
+	for i := int64(0); i < chunks; i++ {
+		n := int64(blobChunkSize)
+		if remaining < n {
+			n = remaining
+		}
+		if _, err = io.ReadFull(file, buf[:n]); err != nil {
+			break
+		}
+		remaining -= n
+		if _, err = encrypted.Write(aead.Seal(nil, blobChunkNonce(uint32(i), i == chunks-1), buf[:n], nil)); err != nil {
+			break
+		}
+	}
+	var encryptedInfo os.FileInfo
+	if err == nil {
+		encryptedInfo, err = encrypted.Stat()
+	}
+	if err != nil {
+		encrypted.Close()
+		os.Remove(encrypted.Name())
+		return nil, err
+	}
+	slot.EncryptedKey = base64.StdEncoding.EncodeToString(wrapped)
+	slot.PhysicalBytes = encryptedInfo.Size()
+	return encrypted, nil
+}
+
+// openEncrypted returns a reader for length bytes of the decrypted blob of
+// the slot starting at offset. Only the chunks containing the range are
+// read from the blob store.
+func (s *Service) openEncrypted(ctx context.Context, pubkey string, slot *FileSlot, offset int64, length int64) (io.ReadCloser, error) {
+	wrapped, err := base64.StdEncoding.DecodeString(slot.EncryptedKey)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := s.keys.unwrap(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	sealedChunkSize := int64(blobChunkSize + aead.Overhead())
+	chunks := blobChunks(slot.PhysicalBytes, sealedChunkSize)
+	first := offset / blobChunkSize
+	if first >= chunks {
+		first = chunks - 1
+	}
+	blob, err := s.blobs.GetRange(ctx, slotBlobKey(pubkey, slot), first*sealedChunkSize, 0)
+	if err != nil {
+		return nil, err
+	}
+	var r io.Reader = &decryptReader{
+		aead:  aead,
+		src:   blob,
+		buf:   make([]byte, sealedChunkSize),
+		index: first,
+		last:  chunks - 1,
+	}
+	if _, err := io.CopyN(ioutil.Discard, r, offset-first*blobChunkSize); err != nil && err != io.EOF {
+		blob.Close()
+		return nil, err
+	}
+	if length > 0 {
+		r = io.LimitReader(r, length)
+	}
+	return readCloser{Reader: r, Closer: blob}, nil
+}
+
+// decryptReader decrypts the chunks of an encrypted blob starting at chunk
+// index.
+type decryptReader struct {
+	aead  cipher.AEAD
+	src   io.Reader
+	buf   []byte
+	plain []byte
+	index int64
+	last  int64
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.index > d.last {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(d.src, d.buf)
+		if err == io.ErrUnexpectedEOF && d.index == d.last {
+			err = nil
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		d.plain, err = d.aead.Open(d.buf[:0], blobChunkNonce(uint32(d.index), d.index == d.last), d.buf[:n], nil)
+		if err != nil {
+			return 0, CorruptedFileErr
+		}
+		d.index++
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
@@ -0,0 +1,249 @@
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testMasterKey returns a master key filled with b.
+func testMasterKey(t *testing.T, b byte) *MasterKey {
+	key, err := NewMasterKey(bytes.Repeat([]byte{b}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// newEncryptedTestService returns a service encrypting files and configs
+// with key.
+func newEncryptedTestService(t *testing.T, key *MasterKey) (*Service, string, func()) {
+	dir, err := ioutil.TempDir("", "filestore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return openEncryptedTestService(t, dir, key), dir, func() { os.RemoveAll(dir) }
+}
+
+// openEncryptedTestService opens the data dir with key.
+func openEncryptedTestService(t *testing.T, dir string, key *MasterKey) *Service {
+	store := NewYmlUserConfigStore(dir)
+	store.SetMasterKey(key)
+	fs, err := NewService(store, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.EnableEncryption(key)
+	return fs
+}
+
+func TestSealConfig(t *testing.T) {
+	plain := []byte("pubkey: " + testPubkey)
+	keys := newKeyRing(testMasterKey(t, 1))
+	sealed, err := keys.sealConfig(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, plain) {
+		t.Fatal("sealed config contains the plaintext")
+	}
+	opened, err := keys.openConfig(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, plain) {
+		t.Fatalf("expected %q, got %q", plain, opened)
+	}
+
+	if _, err := newKeyRing(testMasterKey(t, 2)).openConfig(sealed); err != WrongMasterKeyErr {
+		t.Fatalf("wrong master key: expected %v, got %v", WrongMasterKeyErr, err)
+	}
+	var noKeys *keyRing
+	if _, err := noKeys.openConfig(sealed); err != MasterKeyMissingErr {
+		t.Fatalf("no master key: expected %v, got %v", MasterKeyMissingErr, err)
+	}
+	tampered := append([]byte(nil), sealed...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := keys.openConfig(tampered); err == nil {
+		t.Fatal("tampered config was opened")
+	}
+	if _, err := keys.openConfig(sealed[:len(sealed)-1]); err == nil {
+		t.Fatal("truncated config was opened")
+	}
+	// configs written before encryption was enabled stay readable
+	if opened, err := keys.openConfig(plain); err != nil || !bytes.Equal(opened, plain) {
+		t.Fatalf("unencrypted config: expected %q, got %q, %v", plain, opened, err)
+	}
+}
+
+func TestEncryptedFiles(t *testing.T) {
+	fs, dir, cleanup := newEncryptedTestService(t, testMasterKey(t, 1))
+	defer cleanup()
+	ctx := context.Background()
+
+	sizes := []int{0, 1, blobChunkSize - 1, blobChunkSize, blobChunkSize + 1, 3*blobChunkSize + 5}
+	for _, size := range sizes {
+		content := make([]byte, size)
+		for i := range content {
+			content[i] = byte(i * 7)
+		}
+		slot := uploadTestFile(t, fs, testPubkey, content)
+		if slot.EncryptedKey == "" {
+			t.Fatalf("%d bytes: file was stored unencrypted", size)
+		}
+		blob, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(slotBlobKey(testPubkey, slot))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int64(len(blob)) != slot.PhysicalBytes {
+			t.Fatalf("%d bytes: expected %d physical bytes, got %d", size, len(blob), slot.PhysicalBytes)
+		}
+		// short contents may occur in the ciphertext by chance
+		if size >= 16 && bytes.Contains(blob, content) {
+			t.Fatalf("%d bytes: blob contains the plaintext", size)
+		}
+
+		got, err := readBlob(fs.GetFileReader(ctx, testPubkey, slot.Id))
+		if err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Fatalf("%d bytes: decrypted content differs", size)
+		}
+		ranges := [][2]int{{0, 1}, {size / 2, 0}, {size, 0}, {blobChunkSize - 1, 2}, {blobChunkSize, 10}, {2*blobChunkSize + 3, blobChunkSize}}
+		for _, r := range ranges {
+			offset, length := r[0], r[1]
+			if offset > size {
+				continue
+			}
+			end := size
+			if length > 0 && offset+length < end {
+				end = offset + length
+			}
+			got, err := readBlob(fs.GetFileRange(ctx, testPubkey, slot.Id, int64(offset), int64(length)))
+			if err != nil {
+				t.Fatalf("%d bytes, range %d+%d: %v", size, offset, length, err)
+			}
+			if !bytes.Equal(got, content[offset:end]) {
+				t.Fatalf("%d bytes, range %d+%d: expected %d bytes, got %d", size, offset, length, end-offset, len(got))
+			}
+		}
+	}
+}
+
+func TestEncryptedFileTampering(t *testing.T) {
+	content := bytes.Repeat([]byte("tamper"), blobChunkSize/2)
+	tests := []struct {
+		name   string
+		modify func(blob []byte) []byte
+		err    error
+	}{
+		{
+			name: "flipped byte",
+			modify: func(blob []byte) []byte {
+				blob[10] ^= 1
+				return blob
+			},
+			err: CorruptedFileErr,
+		},
+		{
+			name: "truncated last chunk",
+			modify: func(blob []byte) []byte {
+				return blob[:len(blob)-1]
+			},
+			err: CorruptedFileErr,
+		},
+		{
+			name: "missing last chunk",
+			modify: func(blob []byte) []byte {
+				return blob[:2*(blobChunkSize+16)]
+			},
+		},
+		{
+			name: "swapped chunks",
+			modify: func(blob []byte) []byte {
+				sealedChunkSize := blobChunkSize + 16
+				swapped := append([]byte(nil), blob[sealedChunkSize:2*sealedChunkSize]...)
+				swapped = append(swapped, blob[:sealedChunkSize]...)
+				return append(swapped, blob[2*sealedChunkSize:]...)
+			},
+			err: CorruptedFileErr,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs, dir, cleanup := newEncryptedTestService(t, testMasterKey(t, 1))
+			defer cleanup()
+			ctx := context.Background()
+			slot := uploadTestFile(t, fs, testPubkey, content)
+			path := filepath.Join(dir, filepath.FromSlash(slotBlobKey(testPubkey, slot)))
+			blob, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(path, test.modify(blob), 0666); err != nil {
+				t.Fatal(err)
+			}
+			_, err = readBlob(fs.GetFileReader(ctx, testPubkey, slot.Id))
+			if err == nil || test.err != nil && err != test.err {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestRotateMasterKey(t *testing.T) {
+	oldKey, newKey := testMasterKey(t, 1), testMasterKey(t, 2)
+	fs, dir, cleanup := newEncryptedTestService(t, oldKey)
+	defer cleanup()
+	ctx := context.Background()
+	content := bytes.Repeat([]byte("rotate"), blobChunkSize/3)
+	files := map[string]*FileSlot{
+		testPubkey:  uploadTestFile(t, fs, testPubkey, content),
+		otherPubkey: uploadTestFile(t, fs, otherPubkey, content),
+	}
+	if _, err := fs.CreditBalance(ctx, testPubkey, 5000); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewYmlUserConfigStore(dir)
+	store.SetMasterKey(oldKey)
+	n, err := RotateMasterKey(ctx, store, oldKey, newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(files) {
+		t.Fatalf("expected %d rotated users, got %d", len(files), n)
+	}
+	// an interrupted rotation can be run again
+	if _, err := RotateMasterKey(ctx, store, oldKey, newKey); err != nil {
+		t.Fatalf("repeated rotation: %v", err)
+	}
+
+	rotated := openEncryptedTestService(t, dir, newKey)
+	for pubkey, slot := range files {
+		got, err := readBlob(rotated.GetFileReader(ctx, pubkey, slot.Id))
+		if err != nil {
+			t.Fatalf("%s: %v", pubkey, err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Fatalf("%s: decrypted content differs", pubkey)
+		}
+	}
+	balance, err := rotated.GetBalance(ctx, testPubkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance != 5000 {
+		t.Fatalf("expected a balance of 5000, got %d", balance)
+	}
+
+	oldStore := NewYmlUserConfigStore(dir)
+	oldStore.SetMasterKey(oldKey)
+	if _, err := oldStore.Read(ctx, testPubkey); err != WrongMasterKeyErr {
+		t.Fatalf("config with the old key: expected %v, got %v", WrongMasterKeyErr, err)
+	}
+}
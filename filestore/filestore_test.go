@@ -0,0 +1,47 @@
+package filestore
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+const testPubkey = "02aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+
+// newTestService returns a service storing its files in a new temp dir and
+// a function to remove the dir.
+func newTestService(t *testing.T) (*Service, string, func()) {
+	dir, err := ioutil.TempDir("", "filestore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, err := NewService(NewYmlUserConfigStore(dir), dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return fs, dir, func() { os.RemoveAll(dir) }
+}
+
+// uploadTestFile uploads content as a new file of the user.
+func uploadTestFile(t *testing.T, fs *Service, pubkey string, content []byte) *FileSlot {
+	ctx := context.Background()
+	slot, err := fs.NewFile(ctx, pubkey, "test.txt", "", 4102444800, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, _, err := fs.GetFileAppender(ctx, pubkey, slot.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := fs.SaveFile(ctx, pubkey, slot, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return saved
+}
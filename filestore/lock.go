@@ -0,0 +1,108 @@
+package filestore
+
+import (
+	"sync"
+	"time"
+)
+
+// userLocks serializes read-modify-write operations on the config of a
+// single user. Locks are removed once nobody holds or waits for them.
+type userLocks struct {
+	sync.Mutex
+	locks map[string]*userLock
+}
+
+type userLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newUserLocks() *userLocks {
+	return &userLocks{locks: make(map[string]*userLock)}
+}
+
+// lock locks the pubkey and returns the function to unlock it.
+func (u *userLocks) lock(pubkey string) func() {
+	u.Lock()
+	l, ok := u.locks[pubkey]
+	if !ok {
+		l = &userLock{}
+		u.locks[pubkey] = l
+	}
+	l.refs++
+	u.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		u.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(u.locks, pubkey)
+		}
+		u.Unlock()
+	}
+}
+
+// uploadLocks marks the unfinished uploads that are written by a stream,
+// so an upload is never appended to by two streams at once.
+type uploadLocks struct {
+	sync.Mutex
+	uploads map[string]bool
+}
+
+func newUploadLocks() *uploadLocks {
+	return &uploadLocks{uploads: make(map[string]bool)}
+}
+
+// lock marks the upload as written and returns the function to unmark it.
+// It returns false if the upload is already written.
+func (u *uploadLocks) lock(pubkey string, fileid string) (func(), bool) {
+	key := blobKey(pubkey, fileid)
+	u.Lock()
+	defer u.Unlock()
+	if u.uploads[key] {
+		return nil, false
+	}
+	u.uploads[key] = true
+	return func() {
+		u.Lock()
+		delete(u.uploads, key)
+		u.Unlock()
+	}, true
+}
+
+// filePins keeps the reaper from deleting files, e.g. while an extension
+// is being paid. Pins expire, so they never have to be removed.
+type filePins struct {
+	sync.Mutex
+	pins map[string]time.Time
+}
+
+func newFilePins() *filePins {
+	return &filePins{pins: make(map[string]time.Time)}
+}
+
+// pin protects the file until the given time.
+func (p *filePins) pin(pubkey string, fileid string, until time.Time) {
+	p.Lock()
+	defer p.Unlock()
+	now := time.Now()
+	for k, v := range p.pins {
+		if now.After(v) {
+			delete(p.pins, k)
+		}
+	}
+	key := blobKey(pubkey, fileid)
+	if until.After(p.pins[key]) {
+		p.pins[key] = until
+	}
+}
+
+// pinned returns true if the file is protected.
+func (p *filePins) pinned(pubkey string, fileid string) bool {
+	p.Lock()
+	defer p.Unlock()
+	until, ok := p.pins[blobKey(pubkey, fileid)]
+	return ok && time.Now().Before(until)
+}
@@ -0,0 +1,76 @@
+package filestore
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentUploads(t *testing.T) {
+	const uploads = 32
+	for _, backend := range []string{"yml", "bolt"} {
+		t.Run(backend, func(t *testing.T) {
+			fs, dir, cleanup := newTestService(t)
+			defer cleanup()
+			if backend == "bolt" {
+				if raceEnabled {
+					// bbolt v1.3.3 fails the pointer checks enabled by -race
+					t.Skip("bbolt does not support the race detector")
+				}
+				store, err := NewBoltUserConfigStore(filepath.Join(dir, BoltDbName))
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer store.Close()
+				fs.store = store
+			}
+			ctx := context.Background()
+
+			var wg sync.WaitGroup
+			for i := 0; i < uploads; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					if err := uploadConcurrent(ctx, fs, []byte(fmt.Sprintf("file %v", i))); err != nil {
+						t.Error(err)
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			files, err := fs.ListFiles(ctx, testPubkey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != uploads {
+				t.Fatalf("expected %v files, got %v", uploads, len(files))
+			}
+			userConfig, err := fs.store.Read(ctx, testPubkey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(userConfig.PendingSlots) != 0 {
+				t.Fatalf("expected no pending uploads, got %v", len(userConfig.PendingSlots))
+			}
+		})
+	}
+}
+
+func uploadConcurrent(ctx context.Context, fs *Service, content []byte) error {
+	slot, err := fs.NewFile(ctx, testPubkey, "test.txt", "", 4102444800, 0, "")
+	if err != nil {
+		return err
+	}
+	file, _, err := fs.GetFileAppender(ctx, testPubkey, slot.Id)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Write(content); err != nil {
+		return err
+	}
+	_, err = fs.SaveFile(ctx, testPubkey, slot, file)
+	return err
+}
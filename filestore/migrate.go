@@ -0,0 +1,31 @@
+package filestore
+
+import "context"
+
+// MigrateUserConfigs copies the configs of all users from one store to
+// another and returns the number of migrated users. Users that already
+// exist in the target store are overwritten.
+func MigrateUserConfigs(ctx context.Context, from UserConfigStore, to UserConfigStore) (int, error) {
+	pubkeys, err := from.ListUsers(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for i, pubkey := range pubkeys {
+		userConfig, err := from.Read(ctx, pubkey)
+		if err != nil {
+			return i, err
+		}
+		userConfig.Pubkey = pubkey
+		_, err = to.Read(ctx, pubkey)
+		if err == NotFoundErr {
+			_, err = to.Create(ctx, pubkey)
+		}
+		if err != nil {
+			return i, err
+		}
+		if err := to.Update(ctx, userConfig); err != nil {
+			return i, err
+		}
+	}
+	return len(pubkeys), nil
+}
@@ -0,0 +1,7 @@
+//go:build !race
+// +build !race
+
+package filestore
+
+// raceEnabled is set if the tests run with the race detector.
+const raceEnabled = false
@@ -0,0 +1,355 @@
+package filestore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+)
+
+var (
+	TooManyFilesErr = fmt.Errorf("maximum number of files per user reached")
+	FileTooLargeErr = fmt.Errorf("maximum file size exceeded")
+	UserQuotaErr    = fmt.Errorf("maximum storage per user exceeded")
+	DiskFullErr     = fmt.Errorf("not enough disk space left on server")
+)
+
+// Limits restricts the storage used by users. Zero values are unlimited.
+type Limits struct {
+	MaxBytesPerUser int64
+	MaxFilesPerUser int64
+	MaxFileSize     int64
+	// MinFreeBytes is the disk space of the base dir that is always kept
+	// free. If files are not stored in the base dir, it only limits the
+	// unfinished uploads.
+	MinFreeBytes int64
+}
+
+// IsQuotaErr returns true if the error is caused by a storage limit.
+func IsQuotaErr(err error) bool {
+	switch err {
+	case TooManyFilesErr, FileTooLargeErr, UserQuotaErr, DiskFullErr:
+		return true
+	}
+	return false
+}
+
+// SetLimits sets the storage limits.
+func (s *Service) SetLimits(limits Limits) {
+	s.limits = limits
+}
+
+// Limits returns the storage limits.
+func (s *Service) Limits() Limits {
+	return s.limits
+}
+
+// AvailableBytes returns the bytes that can be written to the base dir
+// until the disk reserve is reached, or -1 if there is no disk reserve.
+func (s *Service) AvailableBytes() (int64, error) {
+	if s.limits.MinFreeBytes <= 0 {
+		return -1, nil
+	}
+	free, err := freeDiskSpace(s.baseDir)
+	if err != nil {
+		return 0, err
+	}
+	if free < s.limits.MinFreeBytes {
+		return 0, nil
+	}
+	return free - s.limits.MinFreeBytes, nil
+}
+
+// Usage returns the number of files and bytes stored by the user, including
+// unfinished uploads. Unfinished uploads of declared size count with their
+// declared size.
+func (s *Service) Usage(ctx context.Context, pubkey string) (int64, int64, error) {
+	if err := validateIds(pubkey); err != nil {
+		return 0, 0, err
+	}
+	userConfig, err := s.store.Read(ctx, pubkey)
+	if err == NotFoundErr {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	var bytes int64
+	for _, slot := range userConfig.FileSlots {
+		bytes += slot.Bytes
+	}
+	for id, slot := range userConfig.PendingSlots {
+		fi, err := os.Stat(s.uploadPath(pubkey, id))
+		if err != nil && !os.IsNotExist(err) {
+			return 0, 0, err
+		}
+		size := slot.DeclaredBytes
+		if err == nil && fi.Size() > size {
+			size = fi.Size()
+		}
+		bytes += size
+	}
+	return int64(len(userConfig.FileSlots) + len(userConfig.PendingSlots)), bytes, nil
+}
+
+// ReserveNewFile checks if the user may create another file of the given
+// size and reserves it until release is called, which has to happen once
+// the pending file was created or the upload failed. Reservations are
+// shared by all uploads of the user, so concurrent uploads can not exceed
+// the limits together. A size of 0 only checks the number of files.
+func (s *Service) ReserveNewFile(ctx context.Context, pubkey string, fileBytes int64) (func(), error) {
+	if err := validateIds(pubkey); err != nil {
+		return nil, err
+	}
+	unlock := s.locks.lock(pubkey)
+	defer unlock()
+	files, bytes, err := s.Usage(ctx, pubkey)
+	if err != nil {
+		return nil, err
+	}
+	reservedFiles, reservedBytes := s.reserved.get(pubkey)
+	if s.limits.MaxFilesPerUser > 0 && files+reservedFiles >= s.limits.MaxFilesPerUser {
+		return nil, TooManyFilesErr
+	}
+	// the disk only has to hold the whole file if it is stored there
+	diskBytes := fileBytes
+	if _, ok := s.blobs.(*LocalBlobStore); !ok {
+		diskBytes = 0
+	}
+	if err := s.checkLimits(fileBytes, bytes+reservedBytes+fileBytes, diskBytes); err != nil {
+		return nil, err
+	}
+	s.reserved.add(pubkey, 1, fileBytes)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.reserved.add(pubkey, -1, -fileBytes)
+			// the declared size of the pending file is not part of the
+			// usage counted by running uploads yet
+			s.reserved.use(pubkey, fileBytes)
+		})
+	}, nil
+}
+
+// Quota tracks the bytes written by an upload against the limits. The
+// usage of the user is counted once by the first running upload and shared
+// by all uploads of the user, which add the bytes they write. Files deleted
+// meanwhile are counted until the last upload of the user is closed.
+type Quota struct {
+	service  *Service
+	pubkey   string
+	declared int64
+	// fileBytes is the size of the file including reserved bytes
+	fileBytes int64
+	// reserved are the bytes reserved by the quota that are not released
+	reserved int64
+}
+
+// NewQuota returns a quota for an upload of a file of which fileBytes are
+// already stored. declaredBytes is the declared size of the file, which is
+// already accounted for, or 0. Close has to be called once the upload
+// stopped.
+func (s *Service) NewQuota(ctx context.Context, pubkey string, fileBytes int64, declaredBytes int64) (*Quota, error) {
+	if err := validateIds(pubkey); err != nil {
+		return nil, err
+	}
+	unlock := s.locks.lock(pubkey)
+	defer unlock()
+	err := s.reserved.openUsage(pubkey, func() (int64, error) {
+		_, bytes, err := s.Usage(ctx, pubkey)
+		return bytes, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Quota{service: s, pubkey: pubkey, declared: declaredBytes, fileBytes: fileBytes}, nil
+}
+
+// Reserve checks if n more bytes can be written and reserves them for the
+// user until Release is called.
+func (q *Quota) Reserve(ctx context.Context, n int64) error {
+	s := q.service
+	unlock := s.locks.lock(q.pubkey)
+	defer unlock()
+	userBytes := s.reserved.usage(q.pubkey)
+	_, reservedBytes := s.reserved.get(q.pubkey)
+	// bytes within the declared size are already counted by the usage
+	extra := n
+	if q.declared > 0 {
+		extra = q.fileBytes + n - q.declared
+		if extra < 0 {
+			extra = 0
+		}
+	}
+	if err := s.checkLimits(q.fileBytes+n, userBytes+reservedBytes+extra, n); err != nil {
+		return err
+	}
+	s.reserved.add(q.pubkey, 0, extra)
+	q.reserved += extra
+	q.fileBytes += n
+	return nil
+}
+
+// Release adds the reserved bytes to the usage of the user once they were
+// written to the upload.
+func (q *Quota) Release() {
+	if q.reserved == 0 {
+		return
+	}
+	q.service.reserved.add(q.pubkey, 0, -q.reserved)
+	q.service.reserved.use(q.pubkey, q.reserved)
+	q.reserved = 0
+}
+
+// Close releases the bytes reserved for a chunk that was not written once
+// the upload stopped. The usage of the user is counted again by the next
+// upload after the last quota was closed.
+func (q *Quota) Close() {
+	if q.service == nil {
+		return
+	}
+	q.service.reserved.add(q.pubkey, 0, -q.reserved)
+	q.service.reserved.closeUsage(q.pubkey)
+	q.reserved = 0
+	q.service = nil
+}
+
+// checkLimits checks a file of fileBytes and a user storing userBytes
+// against the limits, n is the number of bytes about to be written to the
+// base dir.
+func (s *Service) checkLimits(fileBytes int64, userBytes int64, n int64) error {
+	if s.limits.MaxFileSize > 0 && fileBytes > s.limits.MaxFileSize {
+		return FileTooLargeErr
+	}
+	if s.limits.MaxBytesPerUser > 0 && userBytes > s.limits.MaxBytesPerUser {
+		return UserQuotaErr
+	}
+	if s.limits.MinFreeBytes > 0 {
+		free, err := freeDiskSpace(s.baseDir)
+		if err != nil {
+			return err
+		}
+		if free-n < s.limits.MinFreeBytes {
+			return DiskFullErr
+		}
+	}
+	return nil
+}
+
+// reservations tracks the files and bytes of each user that are reserved
+// by running uploads but not stored yet, and the usage of users with running
+// uploads.
+type reservations struct {
+	sync.Mutex
+	users map[string]*reservation
+}
+
+type reservation struct {
+	files int64
+	bytes int64
+	// quotas is the number of open quotas sharing used
+	quotas int
+	// used are the bytes stored by the user
+	used int64
+}
+
+func newReservations() *reservations {
+	return &reservations{users: make(map[string]*reservation)}
+}
+
+// get returns the reserved files and bytes of the user.
+func (r *reservations) get(pubkey string) (int64, int64) {
+	r.Lock()
+	defer r.Unlock()
+	res, ok := r.users[pubkey]
+	if !ok {
+		return 0, 0
+	}
+	return res.files, res.bytes
+}
+
+// add adds files and bytes to the reservation of the user, negative values
+// release them.
+func (r *reservations) add(pubkey string, files int64, bytes int64) {
+	r.Lock()
+	defer r.Unlock()
+	res, ok := r.users[pubkey]
+	if !ok {
+		res = &reservation{}
+		r.users[pubkey] = res
+	}
+	res.files += files
+	res.bytes += bytes
+	r.prune(pubkey, res)
+}
+
+// prune removes the reservation of the user once nothing is reserved.
+func (r *reservations) prune(pubkey string, res *reservation) {
+	if res.files == 0 && res.bytes == 0 && res.quotas == 0 {
+		delete(r.users, pubkey)
+	}
+}
+
+// openUsage counts the usage of the user with load unless another quota of
+// the user is open. The caller has to hold the lock of the user.
+func (r *reservations) openUsage(pubkey string, load func() (int64, error)) error {
+	r.Lock()
+	res, ok := r.users[pubkey]
+	if ok && res.quotas > 0 {
+		res.quotas++
+		r.Unlock()
+		return nil
+	}
+	r.Unlock()
+	used, err := load()
+	if err != nil {
+		return err
+	}
+	r.Lock()
+	defer r.Unlock()
+	res, ok = r.users[pubkey]
+	if !ok {
+		res = &reservation{}
+		r.users[pubkey] = res
+	}
+	res.quotas = 1
+	res.used = used
+	return nil
+}
+
+// closeUsage closes a quota of the user.
+func (r *reservations) closeUsage(pubkey string) {
+	r.Lock()
+	defer r.Unlock()
+	res, ok := r.users[pubkey]
+	if !ok || res.quotas == 0 {
+		return
+	}
+	res.quotas--
+	if res.quotas == 0 {
+		res.used = 0
+	}
+	r.prune(pubkey, res)
+}
+
+// usage returns the bytes stored by a user with an open quota.
+func (r *reservations) usage(pubkey string) int64 {
+	r.Lock()
+	defer r.Unlock()
+	res, ok := r.users[pubkey]
+	if !ok {
+		return 0
+	}
+	return res.used
+}
+
+// use adds bytes to the usage of a user with an open quota.
+func (r *reservations) use(pubkey string, bytes int64) {
+	r.Lock()
+	defer r.Unlock()
+	res, ok := r.users[pubkey]
+	if !ok || res.quotas == 0 {
+		return
+	}
+	res.used += bytes
+}
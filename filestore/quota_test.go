@@ -0,0 +1,159 @@
+package filestore
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestReserveNewFileConcurrent(t *testing.T) {
+	fs, _, cleanup := newTestService(t)
+	defer cleanup()
+	fs.SetLimits(Limits{MaxFilesPerUser: 3, MaxBytesPerUser: 1000})
+	ctx := context.Background()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		reserved []func()
+		rejected int
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := fs.ReserveNewFile(ctx, testPubkey, 100)
+			mu.Lock()
+			defer mu.Unlock()
+			if err == TooManyFilesErr {
+				rejected++
+				return
+			}
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			reserved = append(reserved, release)
+		}()
+	}
+	wg.Wait()
+	if len(reserved) != 3 || rejected != 7 {
+		t.Fatalf("expected 3 reservations and 7 rejections, got %v and %v", len(reserved), rejected)
+	}
+
+	// pending files count until they are finished
+	for _, release := range reserved {
+		if _, err := fs.NewFile(ctx, testPubkey, "f", "", 4102444800, 100, ""); err != nil {
+			t.Fatal(err)
+		}
+		release()
+		release()
+	}
+	if _, err := fs.ReserveNewFile(ctx, testPubkey, 0); err != TooManyFilesErr {
+		t.Fatalf("expected %v, got %v", TooManyFilesErr, err)
+	}
+}
+
+func TestQuotaShared(t *testing.T) {
+	fs, _, cleanup := newTestService(t)
+	defer cleanup()
+	fs.SetLimits(Limits{MaxBytesPerUser: 100})
+	ctx := context.Background()
+
+	// a declared upload counts with its declared size
+	release, err := fs.ReserveNewFile(ctx, testPubkey, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	declared, err := fs.NewFile(ctx, testPubkey, "declared", "", 4102444800, 60, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if _, err := fs.ReserveNewFile(ctx, testPubkey, 50); err != UserQuotaErr {
+		t.Fatalf("expected %v, got %v", UserQuotaErr, err)
+	}
+
+	// bytes within the declared size do not count twice
+	q1, err := fs.NewQuota(ctx, testPubkey, 0, declared.DeclaredBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q1.Reserve(ctx, 60); err != nil {
+		t.Fatal(err)
+	}
+
+	// two uploads without declared size share the rest
+	q2, _ := fs.NewQuota(ctx, testPubkey, 0, 0)
+	q3, _ := fs.NewQuota(ctx, testPubkey, 0, 0)
+	if err := q2.Reserve(ctx, 30); err != nil {
+		t.Fatal(err)
+	}
+	if err := q3.Reserve(ctx, 30); err != UserQuotaErr {
+		t.Fatalf("expected %v, got %v", UserQuotaErr, err)
+	}
+	// a chunk that was not written is released
+	q2.Close()
+	if err := q3.Reserve(ctx, 30); err != nil {
+		t.Fatal(err)
+	}
+
+	// written chunks count for all uploads of the user without reading
+	// the usage again
+	q3.Release()
+	q4, _ := fs.NewQuota(ctx, testPubkey, 0, 0)
+	if err := q4.Reserve(ctx, 20); err != UserQuotaErr {
+		t.Fatalf("expected %v, got %v", UserQuotaErr, err)
+	}
+	q1.Close()
+	q3.Close()
+	q4.Close()
+	q4.Close()
+
+	// the usage is counted again once all uploads stopped, q3 did not
+	// write to disk
+	q5, _ := fs.NewQuota(ctx, testPubkey, 0, 0)
+	defer q5.Close()
+	if err := q5.Reserve(ctx, 40); err != nil {
+		t.Fatal(err)
+	}
+	if err := q5.Reserve(ctx, 1); err != UserQuotaErr {
+		t.Fatalf("expected %v, got %v", UserQuotaErr, err)
+	}
+	if len(fs.reserved.users) != 1 {
+		t.Fatalf("expected only the reservation of the open quota, got %v", len(fs.reserved.users))
+	}
+}
+
+func TestDiskReserveWithRemoteBlobs(t *testing.T) {
+	fs, _, cleanup := newTestService(t)
+	defer cleanup()
+	ctx := context.Background()
+	free, err := freeDiskSpace(fs.baseDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.SetLimits(Limits{MinFreeBytes: free / 2})
+
+	// a file larger than the free disk space does not fit the base dir
+	if _, err := fs.ReserveNewFile(ctx, testPubkey, free); err != DiskFullErr {
+		t.Fatalf("expected %v, got %v", DiskFullErr, err)
+	}
+	// unless it is stored elsewhere, but its chunks still have to fit
+	blobs, _, closeS3 := newFakeS3Store(t, "")
+	defer closeS3()
+	fs.SetBlobStore(blobs)
+	release, err := fs.ReserveNewFile(ctx, testPubkey, free)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	q, err := fs.NewQuota(ctx, testPubkey, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if err := q.Reserve(ctx, free); err != DiskFullErr {
+		t.Fatalf("expected %v, got %v", DiskFullErr, err)
+	}
+}
@@ -0,0 +1,55 @@
+package filestore
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Reaper periodically deletes files whose deletion date has passed.
+type Reaper struct {
+	fs          *Service
+	interval    time.Duration
+	gracePeriod time.Duration
+}
+
+// NewReaper returns a reaper that scans all users every interval and
+// removes files whose deletion date is more than gracePeriod in the past.
+func NewReaper(fs *Service, interval time.Duration, gracePeriod time.Duration) *Reaper {
+	return &Reaper{fs: fs, interval: interval, gracePeriod: gracePeriod}
+}
+
+// Run reaps expired files until the context is canceled.
+func (r *Reaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		r.reap(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Reaper) reap(ctx context.Context) {
+	before := time.Now().UTC().Add(-r.gracePeriod).Unix()
+	pubkeys, err := r.fs.ExpiredUsers(ctx, before)
+	if err != nil {
+		log.Printf("\t [REAPER] > unable to list users: %v", err)
+		return
+	}
+	for _, pubkey := range pubkeys {
+		if ctx.Err() != nil {
+			return
+		}
+		removed, err := r.fs.DeleteExpired(ctx, pubkey, before)
+		if err != nil {
+			log.Printf("\t [REAPER] > unable to delete expired files of %s: %v", pubkey, err)
+		}
+		for _, slot := range removed {
+			log.Printf("\t [REAPER] > removed %s/%s (%s, %v bytes, expired %v)", pubkey, slot.Id, slot.FileName, slot.Bytes, time.Unix(slot.DeletionDate, 0).UTC())
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package filestore
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+)
+
+// keyRingStore is implemented by config stores that encrypt the configs.
+type keyRingStore interface {
+	UserConfigStore
+	setKeyRing(keys *keyRing)
+}
+
+// RotateMasterKey re-wraps the data keys of all files and user configs of
+// the store with newKey and returns the number of updated users. Blobs are
+// not rewritten. Keys are unwrapped with newKey or oldKey, so an interrupted
+// rotation can be run again. Afterwards the store uses newKey.
+func RotateMasterKey(ctx context.Context, store UserConfigStore, oldKey *MasterKey, newKey *MasterKey) (int, error) {
+	if newKey == nil {
+		return 0, InvalidMasterKeyErr
+	}
+	ringStore, ok := store.(keyRingStore)
+	if !ok {
+		return 0, fmt.Errorf("config store does not support encryption")
+	}
+	keys := &keyRing{current: newKey, previous: oldKey}
+	ringStore.setKeyRing(keys)
+	pubkeys, err := store.ListUsers(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for i, pubkey := range pubkeys {
+		userConfig, err := store.Read(ctx, pubkey)
+		if err != nil {
+			return i, err
+		}
+		for _, slot := range userConfig.FileSlots {
+			if slot.EncryptedKey == "" {
+				continue
+			}
+			wrapped, err := base64.StdEncoding.DecodeString(slot.EncryptedKey)
+			if err != nil {
+				return i, err
+			}
+			wrapped, err = keys.rewrap(wrapped)
+			if err != nil {
+				return i, fmt.Errorf("unable to rewrap key of %s/%s: %v", pubkey, slot.Id, err)
+			}
+			slot.EncryptedKey = base64.StdEncoding.EncodeToString(wrapped)
+		}
+		// the config is sealed with a data key wrapped by newKey
+		if err := store.Update(ctx, userConfig); err != nil {
+			return i, err
+		}
+	}
+	ringStore.setKeyRing(newKeyRing(newKey))
+	return len(pubkeys), nil
+}
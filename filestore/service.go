@@ -4,11 +4,11 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
-	"fmt"
 	uuid "github.com/satori/go.uuid"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -16,20 +16,58 @@ type UserConfigStore interface {
 	Create(ctx context.Context, pubkey string) (*UserConfig, error)
 	Read(ctx context.Context, pubkey string) (*UserConfig, error)
 	Update(ctx context.Context, config *UserConfig) error
+	ListUsers(ctx context.Context) ([]string, error)
+}
+
+// ExpiryIndex is implemented by stores that can look up the users owning
+// expired files without reading every config.
+type ExpiryIndex interface {
+	ExpiredUsers(ctx context.Context, before int64) ([]string, error)
 }
 type Service struct {
 	store   UserConfigStore
 	baseDir string
+	limits  Limits
+	locks   *userLocks
+	pins    *filePins
+	uploads *uploadLocks
+	// reserved are the files and bytes of running uploads
+	reserved *reservations
+	blobs    BlobStore
+	// refs is set if files are deduplicated
+	refs *blobRefs
+	// compression of new blobs, empty if they are stored uncompressed
+	compression string
+	// keys is set if new blobs are encrypted
+	keys *keyRing
 }
 
 func NewService(store UserConfigStore, baseDir string) (*Service, error) {
 	if err := os.MkdirAll(baseDir, 0755); err != nil {
 		return nil, err
 	}
-	return &Service{store: store, baseDir: baseDir}, nil
+	return &Service{
+		store:    store,
+		baseDir:  baseDir,
+		locks:    newUserLocks(),
+		pins:     newFilePins(),
+		uploads:  newUploadLocks(),
+		reserved: newReservations(),
+		blobs:    NewLocalBlobStore(baseDir),
+	}, nil
+}
+
+// SetBlobStore sets the store of finished files, by default files are
+// stored in the base dir. Unfinished uploads are always kept in the base
+// dir.
+func (s *Service) SetBlobStore(blobs BlobStore) {
+	s.blobs = blobs
 }
 
 func (s *Service) ListFiles(ctx context.Context, pubkey string) (map[string]*FileSlot, error) {
+	if err := validateIds(pubkey); err != nil {
+		return nil, err
+	}
 	userConfig, err := s.store.Read(ctx, pubkey)
 	if err != nil {
 		return nil, err
@@ -37,26 +75,163 @@ func (s *Service) ListFiles(ctx context.Context, pubkey string) (map[string]*Fil
 	return userConfig.FileSlots, nil
 }
 
-func (s *Service) GetFileReader(ctx context.Context, pubkey string, fileid string) (*os.File, error) {
-	f, err := os.Open(filepath.Join(s.baseDir, pubkey, fileid))
+// GetFileReader returns a reader for the stored file.
+func (s *Service) GetFileReader(ctx context.Context, pubkey string, fileid string) (io.ReadCloser, error) {
+	if err := validateIds(pubkey, fileid); err != nil {
+		return nil, err
+	}
+	slot, err := s.GetFile(ctx, pubkey, fileid)
+	if err != nil {
+		return nil, err
+	}
+	return s.openBlob(ctx, pubkey, slot)
+}
+
+// GetFileRange returns a reader for length bytes of the stored file starting
+// at offset. A length of 0 reads until the end of the file.
+func (s *Service) GetFileRange(ctx context.Context, pubkey string, fileid string, offset int64, length int64) (io.ReadCloser, error) {
+	if err := validateIds(pubkey, fileid); err != nil {
+		return nil, err
+	}
+	slot, err := s.GetFile(ctx, pubkey, fileid)
+	if err != nil {
+		return nil, err
+	}
+	return s.openBlobRange(ctx, pubkey, slot, offset, length)
+}
+
+// GetFileAppender opens the file for appending and returns the number of
+// bytes already written.
+func (s *Service) GetFileAppender(ctx context.Context, pubkey string, fileid string) (*os.File, int64, error) {
+	if err := validateIds(pubkey, fileid); err != nil {
+		return nil, 0, err
+	}
+	if err := os.MkdirAll(filepath.Join(s.baseDir, pubkey), dirPermissions); err != nil {
+		return nil, 0, err
+	}
+	f, err := os.OpenFile(s.uploadPath(pubkey, fileid), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, 0, err
+	}
+	fi, err := f.Stat()
 	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, fi.Size(), nil
+}
+
+// LockUpload reserves the unfinished upload for a single stream and returns
+// the function to release it. It fails with UploadInUseErr while another
+// stream holds the upload.
+func (s *Service) LockUpload(pubkey string, fileid string) (func(), error) {
+	if err := validateIds(pubkey, fileid); err != nil {
 		return nil, err
 	}
-	return f, nil
+	release, ok := s.uploads.lock(pubkey, fileid)
+	if !ok {
+		return nil, UploadInUseErr
+	}
+	return release, nil
+}
+
+// uploadPath returns the path of an unfinished upload.
+func (s *Service) uploadPath(pubkey string, fileid string) string {
+	return filepath.Join(s.baseDir, pubkey, fileid)
+}
+
+// storeUpload compresses and encrypts the finished upload if enabled and
+// moves it to the blob store.
+func (s *Service) storeUpload(ctx context.Context, pubkey string, slot *FileSlot, file *os.File) error {
+	blob, err := s.prepareBlob(slot, file)
+	if err != nil {
+		return err
+	}
+	if blob == file {
+		return s.putFile(ctx, pubkey, slot, blob)
+	}
+	// the upload is kept until the compressed blob is stored, so a failed
+	// upload can be finished again
+	defer blob.Close()
+	if err := s.putFile(ctx, pubkey, slot, blob); err != nil {
+		removeFile(blob.Name())
+		return err
+	}
+	// the local blob store replaces the upload if it is stored at the same
+	// path
+	uploaded, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	current, err := os.Stat(file.Name())
+	if err != nil || !os.SameFile(uploaded, current) {
+		return nil
+	}
+	return removeFile(file.Name())
 }
 
-func (s *Service) GetFileWriter(ctx context.Context, pubkey string, fileid string) (*os.File, error) {
-	f, err := os.Create(filepath.Join(s.baseDir, pubkey, fileid))
+// prepareBlob compresses and encrypts the upload if enabled. It returns the
+// file that has to be stored, which is the upload itself if it is stored
+// as is.
+func (s *Service) prepareBlob(slot *FileSlot, file *os.File) (*os.File, error) {
+	compressed, err := s.compressUpload(slot, file)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := s.encryptUpload(slot, compressed)
+	if compressed != file && encrypted != compressed {
+		compressed.Close()
+		removeFile(compressed.Name())
+	}
 	if err != nil {
 		return nil, err
 	}
-	return f, nil
+	return encrypted, nil
+}
+
+// putFile stores the file as blob of the slot.
+func (s *Service) putFile(ctx context.Context, pubkey string, slot *FileSlot, file *os.File) error {
+	if s.refs != nil {
+		return s.storeDedup(ctx, slot, file)
+	}
+	return s.putBlob(ctx, blobKey(pubkey, slot.Id), file, slot.PhysicalBytes)
+}
+
+// putBlob moves the file to the key of the blob store.
+func (s *Service) putBlob(ctx context.Context, key string, file *os.File, size int64) error {
+	if mover, ok := s.blobs.(blobFileMover); ok {
+		return mover.PutFile(ctx, key, file.Name())
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := s.blobs.Put(ctx, key, file, size); err != nil {
+		return err
+	}
+	return removeFile(file.Name())
+}
+
+// removeFile removes the file, a missing file is not an error.
+func removeFile(path string) error {
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
 }
 
-func (s *Service) NewFile(ctx context.Context, pubkey string, filename string, description string, deleteAt int64) (*FileSlot, error) {
-	_, err := s.store.Read(ctx, pubkey)
+// NewFile creates a new file slot and stores it as pending until the upload
+// is finished with SaveFile. If declaredBytes is set, SaveFile only accepts
+// a file of that size and, if set, the declared checksum.
+func (s *Service) NewFile(ctx context.Context, pubkey string, filename string, description string, deleteAt int64, declaredBytes int64, declaredChecksum string) (*FileSlot, error) {
+	if err := validateIds(pubkey); err != nil {
+		return nil, err
+	}
+	unlock := s.locks.lock(pubkey)
+	defer unlock()
+	userConfig, err := s.store.Read(ctx, pubkey)
 	if err == NotFoundErr {
-		_, err = s.store.Create(ctx, pubkey)
+		userConfig, err = s.store.Create(ctx, pubkey)
 		if err != nil {
 			return nil, err
 		}
@@ -67,23 +242,48 @@ func (s *Service) NewFile(ctx context.Context, pubkey string, filename string, d
 	if err != nil {
 		return nil, err
 	}
-	return &FileSlot{
-		FileName:     filename,
-		Description:  description,
-		DeletionDate: deleteAt,
-		Id:           id.String(),
-	}, nil
+	slot := &FileSlot{
+		FileName:         filename,
+		Description:      description,
+		DeletionDate:     deleteAt,
+		Id:               id.String(),
+		DeclaredBytes:    declaredBytes,
+		DeclaredChecksum: declaredChecksum,
+	}
+	if userConfig.PendingSlots == nil {
+		userConfig.PendingSlots = make(map[string]*FileSlot)
+	}
+	userConfig.PendingSlots[slot.Id] = slot
+	err = s.store.Update(ctx, userConfig)
+	if err != nil {
+		return nil, err
+	}
+	return slot, nil
 
 }
 
-func (s *Service) SaveFile(ctx context.Context, pubkey string, slot *FileSlot, file *os.File) (*FileSlot, error) {
+// GetPendingFile returns a file slot whose upload is not finished yet.
+func (s *Service) GetPendingFile(ctx context.Context, pubkey string, fileid string) (*FileSlot, error) {
+	if err := validateIds(pubkey, fileid); err != nil {
+		return nil, err
+	}
 	// Get User Config
 	userConfig, err := s.store.Read(ctx, pubkey)
 	if err != nil {
 		return nil, err
 	}
+	if val, ok := userConfig.PendingSlots[fileid]; ok {
+		return val, nil
+	}
+	return nil, FileNotFoundErr
+}
+
+func (s *Service) SaveFile(ctx context.Context, pubkey string, slot *FileSlot, file *os.File) (*FileSlot, error) {
+	if err := validateIds(pubkey, slot.Id); err != nil {
+		return nil, err
+	}
 	// set Sha hash
-	_, err = file.Seek(0, io.SeekStart)
+	_, err := file.Seek(0, io.SeekStart)
 	if err != nil {
 		return nil, err
 	}
@@ -98,18 +298,45 @@ func (s *Service) SaveFile(ctx context.Context, pubkey string, slot *FileSlot, f
 		return nil, err
 	}
 	slot.Bytes = fi.Size()
+	// check declared size and checksum
+	if slot.DeclaredBytes > 0 && slot.Bytes != slot.DeclaredBytes {
+		return nil, SizeMismatchErr
+	}
+	if slot.DeclaredChecksum != "" && !strings.EqualFold(slot.DeclaredChecksum, slot.Sha256Checksum) {
+		return nil, ChecksumMismatchErr
+	}
 	// set creation date
 	slot.CreationDate = time.Now().UTC().Unix()
+	if err := s.storeUpload(ctx, pubkey, slot, file); err != nil {
+		return nil, err
+	}
+
+	unlock := s.locks.lock(pubkey)
+	defer unlock()
+	// Get User Config
+	userConfig, err := s.store.Read(ctx, pubkey)
+	if err != nil {
+		s.releaseShared(ctx, pubkey, slot)
+		return nil, err
+	}
+	if userConfig.FileSlots == nil {
+		userConfig.FileSlots = make(map[string]*FileSlot)
+	}
+	delete(userConfig.PendingSlots, slot.Id)
 	userConfig.FileSlots[slot.Id] = slot
 
 	err = s.store.Update(ctx, userConfig)
 	if err != nil {
+		s.releaseShared(ctx, pubkey, slot)
 		return nil, err
 	}
 	return slot, nil
 }
 
 func (s *Service) GetFile(ctx context.Context, pubkey string, fileid string) (*FileSlot, error) {
+	if err := validateIds(pubkey, fileid); err != nil {
+		return nil, err
+	}
 	// Get User Config
 	userConfig, err := s.store.Read(ctx, pubkey)
 	if err != nil {
@@ -118,5 +345,236 @@ func (s *Service) GetFile(ctx context.Context, pubkey string, fileid string) (*F
 	if val, ok := userConfig.FileSlots[fileid]; ok {
 		return val, nil
 	}
-	return nil, fmt.Errorf("File not found or user does not own file")
+	return nil, FileNotFoundErr
+}
+
+// VerifyFile checks that the stored file matches the size and checksum of
+// the slot.
+func (s *Service) VerifyFile(ctx context.Context, pubkey string, slot *FileSlot) error {
+	file, err := s.openBlob(ctx, pubkey, slot)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	hasher := sha256.New()
+	n, err := io.Copy(hasher, file)
+	if err != nil {
+		return err
+	}
+	if n != slot.Bytes || !strings.EqualFold(hex.EncodeToString(hasher.Sum(nil)), slot.Sha256Checksum) {
+		return CorruptedFileErr
+	}
+	return nil
+}
+
+func (s *Service) SetDeletionDate(ctx context.Context, pubkey string, fileid string, deleteAt int64) (*FileSlot, error) {
+	if err := validateIds(pubkey, fileid); err != nil {
+		return nil, err
+	}
+	unlock := s.locks.lock(pubkey)
+	defer unlock()
+	// Get User Config
+	userConfig, err := s.store.Read(ctx, pubkey)
+	if err != nil {
+		return nil, err
+	}
+	slot, ok := userConfig.FileSlots[fileid]
+	if !ok {
+		return nil, FileNotFoundErr
+	}
+	slot.DeletionDate = deleteAt
+	err = s.store.Update(ctx, userConfig)
+	if err != nil {
+		return nil, err
+	}
+	return slot, nil
+}
+
+// ProtectFile keeps DeleteExpired from deleting the file until the given
+// time, even if its deletion date has passed. It is used while an extension
+// of the file is paid.
+func (s *Service) ProtectFile(pubkey string, fileid string, until time.Time) {
+	s.pins.pin(pubkey, fileid, until)
+}
+
+// DeletePendingFile removes an unfinished upload.
+func (s *Service) DeletePendingFile(ctx context.Context, pubkey string, fileid string) error {
+	if err := validateIds(pubkey, fileid); err != nil {
+		return err
+	}
+	unlock := s.locks.lock(pubkey)
+	defer unlock()
+	// Get User Config
+	userConfig, err := s.store.Read(ctx, pubkey)
+	if err != nil {
+		return err
+	}
+	if _, ok := userConfig.PendingSlots[fileid]; !ok {
+		return FileNotFoundErr
+	}
+	// remove upload
+	err = removeFile(s.uploadPath(pubkey, fileid))
+	if err != nil {
+		return err
+	}
+	delete(userConfig.PendingSlots, fileid)
+	return s.store.Update(ctx, userConfig)
+}
+
+func (s *Service) DeleteFile(ctx context.Context, pubkey string, fileid string) error {
+	if err := validateIds(pubkey, fileid); err != nil {
+		return err
+	}
+	unlock := s.locks.lock(pubkey)
+	defer unlock()
+	// Get User Config
+	userConfig, err := s.store.Read(ctx, pubkey)
+	if err != nil {
+		return err
+	}
+	slot, ok := userConfig.FileSlots[fileid]
+	if !ok {
+		return FileNotFoundErr
+	}
+	delete(userConfig.FileSlots, fileid)
+	err = s.store.Update(ctx, userConfig)
+	if err != nil {
+		return err
+	}
+	// the blob is only released once the slot is gone, so a failed update
+	// can not release a shared blob twice
+	return s.releaseBlob(ctx, pubkey, slot)
+}
+
+// DeleteExpired removes all files and unfinished uploads of the user whose
+// deletion date is before the given unix timestamp and returns the removed
+// slots. Protected files are kept. If a blob can not be removed, the slots
+// are removed nevertheless and the error is returned with them.
+func (s *Service) DeleteExpired(ctx context.Context, pubkey string, before int64) ([]*FileSlot, error) {
+	if err := validateIds(pubkey); err != nil {
+		return nil, err
+	}
+	unlock := s.locks.lock(pubkey)
+	defer unlock()
+	userConfig, err := s.store.Read(ctx, pubkey)
+	if err != nil {
+		return nil, err
+	}
+	var removed, removedFiles, removedUploads []*FileSlot
+	for id, slot := range userConfig.FileSlots {
+		if slot.DeletionDate >= before || s.pins.pinned(pubkey, id) {
+			continue
+		}
+		delete(userConfig.FileSlots, id)
+		removedFiles = append(removedFiles, slot)
+	}
+	for id, slot := range userConfig.PendingSlots {
+		if slot.DeletionDate >= before {
+			continue
+		}
+		delete(userConfig.PendingSlots, id)
+		removedUploads = append(removedUploads, slot)
+	}
+	if len(removedFiles) == 0 && len(removedUploads) == 0 {
+		return nil, nil
+	}
+	err = s.store.Update(ctx, userConfig)
+	if err != nil {
+		return nil, err
+	}
+	// blobs are only released once the slots are gone, so a failed update
+	// can not release a shared blob twice
+	var releaseErr error
+	for _, slot := range removedFiles {
+		if err := s.releaseBlob(ctx, pubkey, slot); err != nil && releaseErr == nil {
+			releaseErr = err
+		}
+		removed = append(removed, slot)
+	}
+	for _, slot := range removedUploads {
+		if err := removeFile(s.uploadPath(pubkey, slot.Id)); err != nil && releaseErr == nil {
+			releaseErr = err
+		}
+		removed = append(removed, slot)
+	}
+	return removed, releaseErr
+}
+
+// ListUsers returns the pubkeys of all users.
+func (s *Service) ListUsers(ctx context.Context) ([]string, error) {
+	return s.store.ListUsers(ctx)
+}
+
+// ExpiredUsers returns the pubkeys of users that may own files whose
+// deletion date is before the given unix timestamp. If the store has no
+// expiry index all users are returned.
+func (s *Service) ExpiredUsers(ctx context.Context, before int64) ([]string, error) {
+	if index, ok := s.store.(ExpiryIndex); ok {
+		return index.ExpiredUsers(ctx, before)
+	}
+	return s.store.ListUsers(ctx)
+}
+
+// GetBalance returns the prepaid balance of the user.
+func (s *Service) GetBalance(ctx context.Context, pubkey string) (int64, error) {
+	if err := validateIds(pubkey); err != nil {
+		return 0, err
+	}
+	userConfig, err := s.store.Read(ctx, pubkey)
+	if err == NotFoundErr {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return userConfig.BalanceMsat, nil
+}
+
+// CreditBalance adds msat to the prepaid balance of the user and returns
+// the new balance.
+func (s *Service) CreditBalance(ctx context.Context, pubkey string, msat int64) (int64, error) {
+	if err := validateIds(pubkey); err != nil {
+		return 0, err
+	}
+	unlock := s.locks.lock(pubkey)
+	defer unlock()
+	userConfig, err := s.store.Read(ctx, pubkey)
+	if err == NotFoundErr {
+		userConfig, err = s.store.Create(ctx, pubkey)
+	}
+	if err != nil {
+		return 0, err
+	}
+	userConfig.BalanceMsat += msat
+	err = s.store.Update(ctx, userConfig)
+	if err != nil {
+		return 0, err
+	}
+	return userConfig.BalanceMsat, nil
+}
+
+// DebitBalance subtracts msat from the prepaid balance of the user. It
+// returns false and leaves the balance untouched if the balance is too low.
+func (s *Service) DebitBalance(ctx context.Context, pubkey string, msat int64) (bool, error) {
+	if err := validateIds(pubkey); err != nil {
+		return false, err
+	}
+	unlock := s.locks.lock(pubkey)
+	defer unlock()
+	userConfig, err := s.store.Read(ctx, pubkey)
+	if err == NotFoundErr {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if userConfig.BalanceMsat < msat {
+		return false, nil
+	}
+	userConfig.BalanceMsat -= msat
+	err = s.store.Update(ctx, userConfig)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
 }
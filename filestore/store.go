@@ -14,12 +14,19 @@ const (
 )
 
 var (
-	NotFoundErr = fmt.Errorf("no userconfig found")
+	NotFoundErr         = fmt.Errorf("no userconfig found")
+	FileNotFoundErr     = fmt.Errorf("File not found or user does not own file")
+	SizeMismatchErr     = fmt.Errorf("file size does not match declared size")
+	ChecksumMismatchErr = fmt.Errorf("file checksum does not match declared checksum")
+	CorruptedFileErr    = fmt.Errorf("stored file does not match its checksum")
+	UploadInUseErr      = fmt.Errorf("upload is written by another stream")
 )
 
 type UserConfig struct {
-	Pubkey    string               `yaml:"pubkey"`
-	FileSlots map[string]*FileSlot `yaml:"fileslots"`
+	Pubkey       string               `yaml:"pubkey"`
+	FileSlots    map[string]*FileSlot `yaml:"fileslots"`
+	PendingSlots map[string]*FileSlot `yaml:"pending_slots"`
+	BalanceMsat  int64                `yaml:"balance_msat"`
 }
 
 type FileSlot struct {
@@ -30,6 +37,20 @@ type FileSlot struct {
 	Bytes          int64  `yaml:"bytes"`
 	CreationDate   int64  `yaml:"creation_date"`
 	DeletionDate   int64  `yaml:"deletion_date"`
+	// DeclaredBytes and DeclaredChecksum are set for uploads that were paid
+	// up front and are checked when the file is saved.
+	DeclaredBytes    int64  `yaml:"declared_bytes,omitempty"`
+	DeclaredChecksum string `yaml:"declared_checksum,omitempty"`
+	// BlobKey is set if the content is stored in a shared content
+	// addressed blob.
+	BlobKey string `yaml:"blob_key,omitempty"`
+	// PhysicalBytes is the size of the stored blob and Compression its
+	// compression, Bytes is always the size of the uploaded file.
+	PhysicalBytes int64  `yaml:"physical_bytes,omitempty"`
+	Compression   string `yaml:"compression,omitempty"`
+	// EncryptedKey is the base64 encoded data key of an encrypted blob,
+	// wrapped by the master key.
+	EncryptedKey string `yaml:"encrypted_key,omitempty"`
 }
 
 func (u *UserConfig) Save(file string) error {
@@ -38,7 +59,7 @@ func (u *UserConfig) Save(file string) error {
 		return fmt.Errorf("unable to marshal Fileslot: %v", err)
 	}
 
-	if err := ioutil.WriteFile(file, configBytes, dirPermissions); err != nil {
+	if err := writeFileAtomic(file, configBytes, dirPermissions); err != nil {
 		return fmt.Errorf("unable to write yaml file: %v", err)
 	}
 
@@ -68,34 +89,50 @@ func (u *UserConfig) Read(file string) error {
 
 type YmlUserConfigStore struct {
 	baseDir string
+	keys    *keyRing
 }
 
 func NewYmlUserConfigStore(baseDir string) *YmlUserConfigStore {
 	return &YmlUserConfigStore{baseDir: baseDir}
 }
 
+// SetMasterKey encrypts the config files with a data key wrapped by the
+// master key. Unencrypted config files are encrypted once they are updated.
+func (y *YmlUserConfigStore) SetMasterKey(key *MasterKey) {
+	y.keys = newKeyRing(key)
+}
+
+func (y *YmlUserConfigStore) setKeyRing(keys *keyRing) {
+	y.keys = keys
+}
+
 func (y *YmlUserConfigStore) Create(ctx context.Context, pubkey string) (*UserConfig, error) {
+	if err := ValidatePubkey(pubkey); err != nil {
+		return nil, err
+	}
 	userConfig := &UserConfig{Pubkey: pubkey}
 	configBytes, err := yaml.Marshal(userConfig)
 	if err != nil {
 		return nil, fmt.Errorf("unable to marshal Fileslot: %v", err)
 	}
-	err = os.Mkdir(filepath.Join(y.baseDir, userConfig.Pubkey), dirPermissions)
+	configBytes, err = y.keys.sealConfig(configBytes)
 	if err != nil {
 		return nil, err
 	}
-	f, err := os.Create(filepath.Join(y.baseDir, userConfig.Pubkey, "config.yml"))
+	err = os.Mkdir(filepath.Join(y.baseDir, userConfig.Pubkey), dirPermissions)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
-	_, err = f.Write(configBytes)
+	err = writeFileAtomic(filepath.Join(y.baseDir, userConfig.Pubkey, "config.yml"), configBytes, dirPermissions)
 	if err != nil {
 		return nil, err
 	}
 	return userConfig, nil
 }
 func (y *YmlUserConfigStore) Read(ctx context.Context, pubkey string) (*UserConfig, error) {
+	if err := ValidatePubkey(pubkey); err != nil {
+		return nil, err
+	}
 	configBytes, err := ioutil.ReadFile(filepath.Join(y.baseDir, pubkey, "config.yml"))
 	if err != nil {
 		switch {
@@ -107,6 +144,10 @@ func (y *YmlUserConfigStore) Read(ctx context.Context, pubkey string) (*UserConf
 			return nil, err
 		}
 	}
+	configBytes, err = y.keys.openConfig(configBytes)
+	if err != nil {
+		return nil, err
+	}
 
 	userConfig := &UserConfig{}
 	if err := yaml.Unmarshal(configBytes, userConfig); err != nil {
@@ -117,14 +158,74 @@ func (y *YmlUserConfigStore) Read(ctx context.Context, pubkey string) (*UserConf
 }
 
 func (y *YmlUserConfigStore) Update(ctx context.Context, config *UserConfig) error {
+	if err := ValidatePubkey(config.Pubkey); err != nil {
+		return err
+	}
 	configBytes, err := yaml.Marshal(config)
 	if err != nil {
 		return fmt.Errorf("unable to marshal Fileslot: %v", err)
 	}
+	configBytes, err = y.keys.sealConfig(configBytes)
+	if err != nil {
+		return err
+	}
 
-	if err := ioutil.WriteFile(filepath.Join(y.baseDir, config.Pubkey, "config.yml"), configBytes, dirPermissions); err != nil {
+	if err := writeFileAtomic(filepath.Join(y.baseDir, config.Pubkey, "config.yml"), configBytes, dirPermissions); err != nil {
 		return fmt.Errorf("unable to write yaml file: %v", err)
 	}
 
 	return nil
 }
+
+func (y *YmlUserConfigStore) ListUsers(ctx context.Context) ([]string, error) {
+	dirs, err := ioutil.ReadDir(y.baseDir)
+	if err != nil {
+		return nil, err
+	}
+	var pubkeys []string
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		_, err := os.Stat(filepath.Join(y.baseDir, dir.Name(), "config.yml"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		pubkeys = append(pubkeys, dir.Name())
+	}
+	return pubkeys, nil
+}
+
+// writeFileAtomic writes the data to a temporary file in the same directory
+// and renames it to file, so readers never see a partially written file.
+func writeFileAtomic(file string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(file)
+	tmp, err := ioutil.TempFile(dir, filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	// remove the temp file if anything fails before the rename
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
@@ -0,0 +1,58 @@
+package filestore
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+const pubkeyLength = 66
+
+var (
+	InvalidPubkeyErr = fmt.Errorf("pubkey must be 66 lowercase hex characters")
+	InvalidFileIdErr = fmt.Errorf("file id must be a uuid")
+)
+
+// ValidatePubkey checks that the pubkey is a lowercase hex encoded
+// compressed public key, so it can be safely used as a directory name and
+// every user has exactly one.
+func ValidatePubkey(pubkey string) error {
+	if len(pubkey) != pubkeyLength {
+		return InvalidPubkeyErr
+	}
+	if _, err := hex.DecodeString(pubkey); err != nil || strings.ToLower(pubkey) != pubkey {
+		return InvalidPubkeyErr
+	}
+	return nil
+}
+
+// ValidateFileId checks that the file id is a uuid in its canonical form,
+// so it can be safely used as a file name.
+func ValidateFileId(fileid string) error {
+	id, err := uuid.FromString(fileid)
+	if err != nil || id.String() != fileid {
+		return InvalidFileIdErr
+	}
+	return nil
+}
+
+// IsValidationErr returns true if the error is caused by an invalid pubkey
+// or file id.
+func IsValidationErr(err error) bool {
+	return err == InvalidPubkeyErr || err == InvalidFileIdErr
+}
+
+// validateIds validates the pubkey and all file ids.
+func validateIds(pubkey string, fileids ...string) error {
+	if err := ValidatePubkey(pubkey); err != nil {
+		return err
+	}
+	for _, fileid := range fileids {
+		if err := ValidateFileId(fileid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package filestore
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const testFileId = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+
+// padPubkey pads s to the length of a pubkey, so the payload is not
+// rejected for its length alone.
+func padPubkey(s string) string {
+	if len(s) >= pubkeyLength {
+		return s
+	}
+	return s + strings.Repeat("a", pubkeyLength-len(s))
+}
+
+// invalidPubkeys returns pubkeys that have to be rejected. root is the
+// parent of the data dir, escaping pubkeys point into it.
+func invalidPubkeys(root string) map[string]string {
+	return map[string]string{
+		"empty":          "",
+		"short":          "02aa",
+		"long":           testPubkey + "aa",
+		"uppercase":      "02" + strings.Repeat("A", 64),
+		"mixed case":     "02" + strings.Repeat("aA", 32),
+		"parent":         padPubkey("../"),
+		"parents":        strings.Repeat("../", 22),
+		"backslash":      padPubkey("..\\"),
+		"absolute":       padPubkey(filepath.Join(root, "abs")),
+		"url encoded":    padPubkey("%2e%2e%2f"),
+		"nul":            padPubkey("02\x00"),
+		"nul terminated": testPubkey[:pubkeyLength-1] + "\x00",
+	}
+}
+
+// invalidFileIds returns file ids that have to be rejected. root is the
+// parent of the data dir, escaping file ids point into it.
+func invalidFileIds(root string) map[string]string {
+	return map[string]string{
+		"empty":       "",
+		"parent":      "../../escape",
+		"root":        "../../../" + filepath.Base(root) + "-escape",
+		"absolute":    filepath.Join(root, "escape"),
+		"url encoded": "%2e%2e%2f%2e%2e%2fescape",
+		"uppercase":   strings.ToUpper(testFileId),
+		"braces":      "{" + testFileId + "}",
+		"urn":         "urn:uuid:" + testFileId,
+		"no dashes":   strings.Replace(testFileId, "-", "", -1),
+		"suffix":      testFileId + "/../../escape",
+		"nul":         testFileId + "\x00",
+	}
+}
+
+// listTree returns all paths below dir and its siblings starting with the
+// name of dir.
+func listTree(t *testing.T, dir string) []string {
+	var paths []string
+	siblings, err := filepath.Glob(dir + "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sibling := range siblings {
+		err := filepath.Walk(sibling, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			paths = append(paths, path)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestValidateIds(t *testing.T) {
+	root, err := ioutil.TempDir("", "validate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "data", "store")
+	fs, err := NewService(NewYmlUserConfigStore(dir), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ymlStore := NewYmlUserConfigStore(dir)
+	var boltStore *BoltUserConfigStore
+	if !raceEnabled {
+		// bbolt v1.3.3 fails the pointer checks enabled by -race
+		boltStore, err = NewBoltUserConfigStore(filepath.Join(dir, BoltDbName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer boltStore.Close()
+	}
+	ctx := context.Background()
+
+	// the test user owns a file and an upload, so a valid pubkey does not
+	// fail for a missing user
+	saved := uploadTestFile(t, fs, testPubkey, []byte("content"))
+	pending, err := fs.NewFile(ctx, testPubkey, "pending.txt", "", 4102444800, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type call func(pubkey string, fileid string) error
+	fileCalls := map[string]call{
+		"GetFileReader": func(pubkey string, fileid string) error {
+			_, err := fs.GetFileReader(ctx, pubkey, fileid)
+			return err
+		},
+		"GetFileRange": func(pubkey string, fileid string) error {
+			_, err := fs.GetFileRange(ctx, pubkey, fileid, 1, 2)
+			return err
+		},
+		"GetFileAppender": func(pubkey string, fileid string) error {
+			file, _, err := fs.GetFileAppender(ctx, pubkey, fileid)
+			if file != nil {
+				file.Close()
+			}
+			return err
+		},
+		"GetPendingFile": func(pubkey string, fileid string) error {
+			_, err := fs.GetPendingFile(ctx, pubkey, fileid)
+			return err
+		},
+		"SaveFile": func(pubkey string, fileid string) error {
+			_, err := fs.SaveFile(ctx, pubkey, &FileSlot{Id: fileid}, nil)
+			return err
+		},
+		"GetFile": func(pubkey string, fileid string) error {
+			_, err := fs.GetFile(ctx, pubkey, fileid)
+			return err
+		},
+		"SetDeletionDate": func(pubkey string, fileid string) error {
+			_, err := fs.SetDeletionDate(ctx, pubkey, fileid, 4102444800)
+			return err
+		},
+		"DeleteFile": func(pubkey string, fileid string) error {
+			return fs.DeleteFile(ctx, pubkey, fileid)
+		},
+		"DeletePendingFile": func(pubkey string, fileid string) error {
+			return fs.DeletePendingFile(ctx, pubkey, fileid)
+		},
+	}
+	userCalls := map[string]func(pubkey string) error{
+		"NewFile": func(pubkey string) error {
+			_, err := fs.NewFile(ctx, pubkey, "test.txt", "", 4102444800, 0, "")
+			return err
+		},
+		"DeleteExpired": func(pubkey string) error {
+			_, err := fs.DeleteExpired(ctx, pubkey, 4102444801)
+			return err
+		},
+		"ListFiles": func(pubkey string) error {
+			_, err := fs.ListFiles(ctx, pubkey)
+			return err
+		},
+		"GetBalance": func(pubkey string) error {
+			_, err := fs.GetBalance(ctx, pubkey)
+			return err
+		},
+		"CreditBalance": func(pubkey string) error {
+			_, err := fs.CreditBalance(ctx, pubkey, 1000)
+			return err
+		},
+		"DebitBalance": func(pubkey string) error {
+			_, err := fs.DebitBalance(ctx, pubkey, 1)
+			return err
+		},
+		"Usage": func(pubkey string) error {
+			_, _, err := fs.Usage(ctx, pubkey)
+			return err
+		},
+		"ReserveNewFile": func(pubkey string) error {
+			release, err := fs.ReserveNewFile(ctx, pubkey, 1)
+			if err == nil {
+				release()
+			}
+			return err
+		},
+		"NewQuota": func(pubkey string) error {
+			_, err := fs.NewQuota(ctx, pubkey, 0, 1)
+			return err
+		},
+	}
+	stores := map[string]UserConfigStore{"yml": ymlStore}
+	if boltStore != nil {
+		stores["bolt"] = boltStore
+	}
+	for name, store := range stores {
+		store := store
+		userCalls[name+" Create"] = func(pubkey string) error {
+			_, err := store.Create(ctx, pubkey)
+			return err
+		}
+		userCalls[name+" Read"] = func(pubkey string) error {
+			_, err := store.Read(ctx, pubkey)
+			return err
+		}
+		userCalls[name+" Update"] = func(pubkey string) error {
+			return store.Update(ctx, &UserConfig{Pubkey: pubkey})
+		}
+	}
+	for name, fileCall := range fileCalls {
+		fileCall := fileCall
+		userCalls[name] = func(pubkey string) error {
+			return fileCall(pubkey, saved.Id)
+		}
+	}
+
+	before := listTree(t, root)
+	for name, userCall := range userCalls {
+		for payload, pubkey := range invalidPubkeys(root) {
+			if err := userCall(pubkey); err != InvalidPubkeyErr {
+				t.Errorf("%v with %v pubkey %q: expected %v, got %v", name, payload, pubkey, InvalidPubkeyErr, err)
+			}
+		}
+	}
+	for name, fileCall := range fileCalls {
+		for payload, fileid := range invalidFileIds(root) {
+			if err := fileCall(testPubkey, fileid); err != InvalidFileIdErr {
+				t.Errorf("%v with %v file id %q: expected %v, got %v", name, payload, fileid, InvalidFileIdErr, err)
+			}
+		}
+	}
+	after := listTree(t, root)
+	if strings.Join(before, "\n") != strings.Join(after, "\n") {
+		t.Fatalf("invalid ids changed the data dir:\nbefore: %v\nafter: %v", before, after)
+	}
+
+	if _, err := fs.GetFile(ctx, testPubkey, saved.Id); err != nil {
+		t.Fatalf("file was changed by invalid ids: %v", err)
+	}
+	if _, err := fs.GetPendingFile(ctx, testPubkey, pending.Id); err != nil {
+		t.Fatalf("upload was changed by invalid ids: %v", err)
+	}
+}
@@ -3,9 +3,13 @@ module github.com/sputn1ck/ln-fileserver
 go 1.13
 
 require (
+	github.com/coreos/bbolt v1.3.3
+	github.com/go-ini/ini v1.42.0 // indirect
 	github.com/golang/protobuf v1.3.3
 	github.com/grpc-ecosystem/go-grpc-middleware v1.2.0
 	github.com/lightningnetwork/lnd v0.10.1-beta.rc3
+	github.com/minio/minio-go v6.0.14+incompatible
+	github.com/mitchellh/go-homedir v1.1.0 // indirect
 	github.com/satori/go.uuid v1.2.1-0.20181028125025-b2ce2384e17b
 	github.com/spf13/pflag v1.0.5
 	github.com/spf13/viper v1.7.0
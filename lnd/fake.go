@@ -0,0 +1,175 @@
+package lnd
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"sync"
+	"time"
+)
+
+type fakeInvoice struct {
+	ctx         context.Context
+	invoice     *lnrpc.Invoice
+	paymentChan chan *lnrpc.Invoice
+	hold        bool
+}
+
+// FakeService is an in-memory payment backend that settles invoices on
+// command. It does not need a running lnd node.
+type FakeService struct {
+	sync.Mutex
+	autoSettle bool
+	invoices   map[string]*fakeInvoice
+	settled    int64
+}
+
+// NewFakeService returns a new fake payment backend. If autoSettle is set,
+// every invoice is settled right after it is created.
+func NewFakeService(autoSettle bool) *FakeService {
+	return &FakeService{autoSettle: autoSettle, invoices: make(map[string]*fakeInvoice)}
+}
+
+func (s *FakeService) CreateListenInvoice(ctx context.Context, paymentChan chan *lnrpc.Invoice, invoice *lnrpc.Invoice) (string, error) {
+	paymentRequest, _, err := s.addInvoice(ctx, paymentChan, invoice, false)
+	return paymentRequest, err
+}
+
+func (s *FakeService) CreateListenHoldInvoice(ctx context.Context, paymentChan chan *lnrpc.Invoice, invoice *lnrpc.Invoice) (string, []byte, error) {
+	return s.addInvoice(ctx, paymentChan, invoice, true)
+}
+
+func (s *FakeService) addInvoice(ctx context.Context, paymentChan chan *lnrpc.Invoice, invoice *lnrpc.Invoice, hold bool) (string, []byte, error) {
+	hash := make([]byte, 32)
+	if _, err := rand.Read(hash); err != nil {
+		return "", nil, err
+	}
+	inv := &lnrpc.Invoice{
+		Memo:           invoice.Memo,
+		ValueMsat:      invoice.ValueMsat,
+		Expiry:         invoice.Expiry,
+		RHash:          hash,
+		PaymentRequest: fmt.Sprintf("fakeinvoice%s", hex.EncodeToString(hash)),
+		CreationDate:   time.Now().Unix(),
+		State:          lnrpc.Invoice_OPEN,
+	}
+	s.Lock()
+	s.invoices[inv.PaymentRequest] = &fakeInvoice{ctx: ctx, invoice: inv, paymentChan: paymentChan, hold: hold}
+	s.Unlock()
+	if s.autoSettle {
+		go s.Settle(inv.PaymentRequest)
+	}
+	return inv.PaymentRequest, hash, nil
+}
+
+// Settle marks the invoice as paid and notifies the listener. Hold invoices
+// are accepted and have to be settled with SettleHoldInvoice.
+func (s *FakeService) Settle(paymentRequest string) error {
+	s.Lock()
+	inv, ok := s.invoices[paymentRequest]
+	s.Unlock()
+	if ok && inv.hold {
+		return s.resolve(paymentRequest, lnrpc.Invoice_ACCEPTED)
+	}
+	return s.resolve(paymentRequest, lnrpc.Invoice_SETTLED)
+}
+
+func (s *FakeService) SettleHoldInvoice(ctx context.Context, paymentHash []byte) error {
+	s.Lock()
+	defer s.Unlock()
+	inv, err := s.holdInvoice(paymentHash)
+	if err != nil {
+		return err
+	}
+	if inv.invoice.State != lnrpc.Invoice_ACCEPTED {
+		return fmt.Errorf("hold invoice is %v", inv.invoice.State)
+	}
+	inv.invoice.State = lnrpc.Invoice_SETTLED
+	s.settled += inv.invoice.AmtPaidMsat
+	return nil
+}
+
+func (s *FakeService) CancelHoldInvoice(ctx context.Context, paymentHash []byte) error {
+	s.Lock()
+	inv, err := s.holdInvoice(paymentHash)
+	if err != nil {
+		s.Unlock()
+		return err
+	}
+	if inv.invoice.State == lnrpc.Invoice_SETTLED {
+		s.Unlock()
+		return fmt.Errorf("hold invoice is already settled")
+	}
+	wasOpen := inv.invoice.State == lnrpc.Invoice_OPEN
+	inv.invoice.State = lnrpc.Invoice_CANCELED
+	inv.invoice.AmtPaidMsat = 0
+	s.Unlock()
+	if wasOpen {
+		notifyPayment(inv.ctx, inv.paymentChan, inv.invoice)
+	}
+	return nil
+}
+
+// holdInvoice returns the hold invoice with the given hash. The caller must
+// hold the lock.
+func (s *FakeService) holdInvoice(paymentHash []byte) (*fakeInvoice, error) {
+	for _, inv := range s.invoices {
+		if inv.hold && bytes.Equal(inv.invoice.RHash, paymentHash) {
+			return inv, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown hold invoice %x", paymentHash)
+}
+
+// Cancel marks the invoice as canceled and notifies the listener.
+func (s *FakeService) Cancel(paymentRequest string) error {
+	return s.resolve(paymentRequest, lnrpc.Invoice_CANCELED)
+}
+
+func (s *FakeService) resolve(paymentRequest string, state lnrpc.Invoice_InvoiceState) error {
+	s.Lock()
+	inv, ok := s.invoices[paymentRequest]
+	if !ok {
+		s.Unlock()
+		return fmt.Errorf("unknown invoice %s", paymentRequest)
+	}
+	if inv.invoice.State != lnrpc.Invoice_OPEN {
+		s.Unlock()
+		return fmt.Errorf("invoice %s is %v", paymentRequest, inv.invoice.State)
+	}
+	inv.invoice.State = state
+	switch state {
+	case lnrpc.Invoice_SETTLED:
+		inv.invoice.AmtPaidMsat = inv.invoice.ValueMsat
+		s.settled += inv.invoice.ValueMsat
+	case lnrpc.Invoice_ACCEPTED:
+		inv.invoice.AmtPaidMsat = inv.invoice.ValueMsat
+	}
+	s.Unlock()
+
+	notifyPayment(inv.ctx, inv.paymentChan, inv.invoice)
+	return nil
+}
+
+// OpenInvoices returns the payment requests of all unpaid invoices.
+func (s *FakeService) OpenInvoices() []string {
+	s.Lock()
+	defer s.Unlock()
+	var open []string
+	for paymentRequest, inv := range s.invoices {
+		if inv.invoice.State == lnrpc.Invoice_OPEN {
+			open = append(open, paymentRequest)
+		}
+	}
+	return open
+}
+
+// SettledMsat returns the sum of all settled invoices.
+func (s *FakeService) SettledMsat() int64 {
+	s.Lock()
+	defer s.Unlock()
+	return s.settled
+}
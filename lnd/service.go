@@ -2,19 +2,32 @@ package lnd
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"github.com/lightningnetwork/lnd/lnrpc"
 	"github.com/lightningnetwork/lnd/lnrpc/invoicesrpc"
 	"io"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// expiryGracePeriod is the time after the expiry of an invoice until
+// ListenPayment stops waiting for a payment.
+const expiryGracePeriod = 10 * time.Second
+
 type Service struct {
 	lnd      lnrpc.LightningClient
 	invoices invoicesrpc.InvoicesClient
+
+	sync.Mutex
+	preimages map[string][]byte
 }
 
 func NewService(lnd lnrpc.LightningClient, invoices invoicesrpc.InvoicesClient) *Service {
-	return &Service{lnd: lnd, invoices: invoices}
+	return &Service{lnd: lnd, invoices: invoices, preimages: make(map[string][]byte)}
 }
 func (s *Service) CreateListenInvoice(ctx context.Context, paymentChan chan *lnrpc.Invoice, invoice *lnrpc.Invoice) (string, error) {
 	invoiceRes, err := s.lnd.AddInvoice(ctx, invoice)
@@ -32,29 +45,130 @@ func (s *Service) CreateListenInvoice(ctx context.Context, paymentChan chan *lnr
 
 }
 
+// CreateListenHoldInvoice adds a hold invoice and returns its payment request
+// and payment hash. The invoice is sent to paymentChan once it is accepted
+// or canceled. Accepted invoices have to be settled with SettleHoldInvoice
+// or canceled with CancelHoldInvoice.
+func (s *Service) CreateListenHoldInvoice(ctx context.Context, paymentChan chan *lnrpc.Invoice, invoice *lnrpc.Invoice) (string, []byte, error) {
+	preimage := make([]byte, 32)
+	if _, err := rand.Read(preimage); err != nil {
+		return "", nil, err
+	}
+	hash := sha256.Sum256(preimage)
+	invoiceRes, err := s.invoices.AddHoldInvoice(ctx, &invoicesrpc.AddHoldInvoiceRequest{
+		Memo:      invoice.Memo,
+		Hash:      hash[:],
+		ValueMsat: invoice.ValueMsat,
+		Expiry:    invoice.Expiry,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	s.Lock()
+	s.preimages[hex.EncodeToString(hash[:])] = preimage
+	s.Unlock()
+	go func() {
+		listenChan := make(chan *lnrpc.Invoice, 1)
+		err := s.ListenPayment(ctx, listenChan, hash[:])
+		var invoice *lnrpc.Invoice
+		select {
+		case invoice = <-listenChan:
+		default:
+		}
+		// canceled and expired invoices can't be settled anymore
+		if invoice == nil || invoice.State == lnrpc.Invoice_CANCELED {
+			s.forgetPreimage(hash[:])
+		}
+		if invoice != nil {
+			notifyPayment(ctx, paymentChan, invoice)
+		}
+		if err != nil {
+			fmt.Printf("[LND] > Listen Payment error: %v", err)
+		}
+	}()
+	return invoiceRes.PaymentRequest, hash[:], nil
+}
+
+// forgetPreimage removes the preimage of a hold invoice.
+func (s *Service) forgetPreimage(paymentHash []byte) {
+	s.Lock()
+	delete(s.preimages, hex.EncodeToString(paymentHash))
+	s.Unlock()
+}
+
+// SettleHoldInvoice settles an accepted hold invoice.
+func (s *Service) SettleHoldInvoice(ctx context.Context, paymentHash []byte) error {
+	key := hex.EncodeToString(paymentHash)
+	s.Lock()
+	preimage, ok := s.preimages[key]
+	delete(s.preimages, key)
+	s.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown hold invoice %s", key)
+	}
+	_, err := s.invoices.SettleInvoice(ctx, &invoicesrpc.SettleInvoiceMsg{Preimage: preimage})
+	return err
+}
+
+// CancelHoldInvoice cancels a hold invoice and returns the payment to the
+// payer.
+func (s *Service) CancelHoldInvoice(ctx context.Context, paymentHash []byte) error {
+	s.forgetPreimage(paymentHash)
+	_, err := s.invoices.CancelInvoice(ctx, &invoicesrpc.CancelInvoiceMsg{PaymentHash: paymentHash})
+	return err
+}
+
+// ListenPayment waits until the invoice is settled, accepted or canceled and
+// sends it to paymentChan. Only hold invoices are accepted.
+//
+// Invoices that are still open after their expiry are reported as canceled,
+// as lnd cancels expired invoices as well.
 func (s *Service) ListenPayment(ctx context.Context, paymentChan chan *lnrpc.Invoice, paymentHash []byte) error {
-	stream, err := s.invoices.SubscribeSingleInvoice(ctx, &invoicesrpc.SubscribeSingleInvoiceRequest{
+	listenCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := s.invoices.SubscribeSingleInvoice(listenCtx, &invoicesrpc.SubscribeSingleInvoiceRequest{
 		RHash: paymentHash,
 	})
 	if err != nil {
 		return err
 	}
+	var (
+		last    *lnrpc.Invoice
+		expired int32
+	)
 	for {
-		select {
-		case <-ctx.Done():
+		res, err := stream.Recv()
+		if err != nil && atomic.LoadInt32(&expired) == 1 {
+			last.State = lnrpc.Invoice_CANCELED
+			notifyPayment(ctx, paymentChan, last)
 			return nil
-		default:
-			res, err := stream.Recv()
-			if err == io.EOF {
-				return nil
-			}
-			if err != nil {
-				return err
-			}
-			if res.State == lnrpc.Invoice_SETTLED {
-				paymentChan <- res
-				return nil
-			}
 		}
+		if err == io.EOF || ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if last == nil {
+			deadline := time.Unix(res.CreationDate+res.Expiry, 0).Add(expiryGracePeriod)
+			timer := time.AfterFunc(time.Until(deadline), func() {
+				atomic.StoreInt32(&expired, 1)
+				cancel()
+			})
+			defer timer.Stop()
+		}
+		last = res
+		switch res.State {
+		case lnrpc.Invoice_SETTLED, lnrpc.Invoice_ACCEPTED, lnrpc.Invoice_CANCELED:
+			notifyPayment(ctx, paymentChan, res)
+			return nil
+		}
+	}
+}
+
+func notifyPayment(ctx context.Context, paymentChan chan *lnrpc.Invoice, invoice *lnrpc.Invoice) {
+	select {
+	case paymentChan <- invoice:
+	case <-ctx.Done():
 	}
 }
@@ -0,0 +1,114 @@
+package lnd
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/invoicesrpc"
+	"google.golang.org/grpc"
+)
+
+// invoicesStub streams the invoice updates sent to updates to every
+// subscriber.
+type invoicesStub struct {
+	invoicesrpc.InvoicesClient
+	updates chan *lnrpc.Invoice
+}
+
+func (i *invoicesStub) AddHoldInvoice(ctx context.Context, in *invoicesrpc.AddHoldInvoiceRequest, opts ...grpc.CallOption) (*invoicesrpc.AddHoldInvoiceResp, error) {
+	return &invoicesrpc.AddHoldInvoiceResp{PaymentRequest: "holdinvoice"}, nil
+}
+
+func (i *invoicesStub) SubscribeSingleInvoice(ctx context.Context, in *invoicesrpc.SubscribeSingleInvoiceRequest, opts ...grpc.CallOption) (invoicesrpc.Invoices_SubscribeSingleInvoiceClient, error) {
+	return &invoiceStream{ctx: ctx, updates: i.updates}, nil
+}
+
+func (i *invoicesStub) SettleInvoice(ctx context.Context, in *invoicesrpc.SettleInvoiceMsg, opts ...grpc.CallOption) (*invoicesrpc.SettleInvoiceResp, error) {
+	return &invoicesrpc.SettleInvoiceResp{}, nil
+}
+
+type invoiceStream struct {
+	invoicesrpc.Invoices_SubscribeSingleInvoiceClient
+	ctx     context.Context
+	updates chan *lnrpc.Invoice
+}
+
+func (s *invoiceStream) Recv() (*lnrpc.Invoice, error) {
+	select {
+	case invoice, ok := <-s.updates:
+		if !ok {
+			return nil, io.EOF
+		}
+		return invoice, nil
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
+
+func TestHoldInvoicePreimages(t *testing.T) {
+	now := time.Now().Unix()
+	tests := []struct {
+		name    string
+		updates []*lnrpc.Invoice
+		state   lnrpc.Invoice_InvoiceState
+		kept    bool
+	}{
+		{
+			name:    "accepted",
+			updates: []*lnrpc.Invoice{{CreationDate: now, Expiry: 60, State: lnrpc.Invoice_ACCEPTED}},
+			state:   lnrpc.Invoice_ACCEPTED,
+			kept:    true,
+		},
+		{
+			name:    "canceled",
+			updates: []*lnrpc.Invoice{{CreationDate: now, Expiry: 60, State: lnrpc.Invoice_CANCELED}},
+			state:   lnrpc.Invoice_CANCELED,
+		},
+		{
+			name:    "expired",
+			updates: []*lnrpc.Invoice{{CreationDate: now - 3600, Expiry: 60, State: lnrpc.Invoice_OPEN}},
+			state:   lnrpc.Invoice_CANCELED,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stub := &invoicesStub{updates: make(chan *lnrpc.Invoice, len(test.updates))}
+			for _, update := range test.updates {
+				stub.updates <- update
+			}
+			s := NewService(nil, stub)
+			paymentChan := make(chan *lnrpc.Invoice, 1)
+			_, hash, err := s.CreateListenHoldInvoice(context.Background(), paymentChan, &lnrpc.Invoice{ValueMsat: 1000, Expiry: 60})
+			if err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case invoice := <-paymentChan:
+				if invoice.State != test.state {
+					t.Fatalf("expected %v, got %v", test.state, invoice.State)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("invoice was not reported")
+			}
+			s.Lock()
+			_, kept := s.preimages[hex.EncodeToString(hash)]
+			s.Unlock()
+			if kept != test.kept {
+				t.Fatalf("expected the preimage to be kept: %v, got %v", test.kept, kept)
+			}
+			if !kept {
+				return
+			}
+			if err := s.SettleHoldInvoice(context.Background(), hash); err != nil {
+				t.Fatal(err)
+			}
+			if len(s.preimages) != 0 {
+				t.Fatal("preimage is kept after settling")
+			}
+		})
+	}
+}
@@ -10,13 +10,16 @@ import (
 	"google.golang.org/grpc/status"
 	"log"
 	"strings"
+	"time"
 )
 
 var (
 	errMissingMetadata  = status.Errorf(codes.InvalidArgument, "missing metadata")
 	errInvalidSignature = status.Errorf(codes.Unauthenticated, "invalid signature")
 	errMissingPubkey    = status.Errorf(codes.InvalidArgument, "missing pubkey in metadata")
-	errMissingSig       = status.Errorf(codes.InvalidArgument, "missing sig in metadata")
+	errMissingToken     = status.Errorf(codes.InvalidArgument, "missing token in metadata")
+	errInvalidToken     = status.Errorf(codes.Unauthenticated, "invalid or expired session token")
+	errInvalidChallenge = status.Errorf(codes.Unauthenticated, "invalid or expired challenge")
 )
 
 type contextKey string
@@ -39,21 +42,51 @@ type VerificationClient interface {
 
 // GPRCUtils groups usefull lnd utility functions.
 type GPRCUtils struct {
-	vc VerificationClient
+	vc       VerificationClient
+	sessions *sessionStore
 }
 
 // New returns new lnd utils
 func New(vc VerificationClient) *GPRCUtils {
-	return &GPRCUtils{vc: vc}
+	return &GPRCUtils{vc: vc, sessions: newSessionStore(DefaultChallengeTTL, DefaultSessionTTL)}
 }
 
-// UnaryServerAuthenticationInterceptor checks if a signed message was
-// signed by provided lnd node. To check if the provided pubkey is the
-// identity of origin, the origin has to provide the pubkey as well as
-// a signed message in the metadata of the request.
+// NewChallenge returns a new single use challenge and its expiry.
+func (u *GPRCUtils) NewChallenge() (string, time.Time, error) {
+	return u.sessions.newChallenge()
+}
+
+// Authenticate checks if the challenge was signed by the given pubkey and
+// returns a session token bound to the pubkey, as well as its expiry.
+// The signed message has to be ChallengeMsg(challenge).
+func (u *GPRCUtils) Authenticate(ctx context.Context, pubkey string, challenge string, sig string) (string, time.Time, error) {
+	if !u.sessions.validChallenge(challenge) {
+		return "", time.Time{}, errInvalidChallenge
+	}
+	ok, err := u.valid(ctx, pubkey, ChallengeMsg(challenge), sig)
+	if err != nil {
+		log.Printf("\t [LND UTILS] > unable to process signature: %v", err)
+		return "", time.Time{}, err
+	}
+	if !ok {
+		return "", time.Time{}, errInvalidSignature
+	}
+	// the challenge is only remembered once it was answered, so unanswered
+	// challenges can not fill up the store
+	if !u.sessions.useChallenge(challenge) {
+		return "", time.Time{}, errInvalidChallenge
+	}
+	return u.sessions.newSession(pubkey)
+}
+
+// UnaryServerAuthenticationInterceptor checks if the request carries a
+// valid session token of the provided lnd node. A session token is
+// obtained by signing a challenge and calling Authenticate. The origin
+// has to provide the pubkey as well as the token in the metadata of
+// the request.
 // {
-//	"pubkey": the-nodes-62-chars-long-pubkey (string),
-//	"sig": the-message-signed-by-node (string)
+//	"pubkey": the-nodes-66-chars-long-pubkey (string),
+//	"token": the-session-token (string)
 // }
 func (u *GPRCUtils) UnaryServerAuthenticationInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 	// Skip the authentication if the requested method is public
@@ -73,30 +106,24 @@ func (u *GPRCUtils) UnaryServerAuthenticationInterceptor(ctx context.Context, re
 		return nil, errMissingPubkey
 	}
 
-	sig, ok := getSig(md)
+	token, ok := getToken(md)
 	if !ok {
-		return nil, errMissingSig
+		return nil, errMissingToken
 	}
 
-	ok, err := u.valid(ctx, pubkey, sig)
-	if err != nil {
-		log.Printf("\t [LND UTILS] > unable to process signature: %v", err)
-		return nil, err
-	}
-	if !ok {
-		return nil, errInvalidSignature
+	if !u.sessions.validSession(pubkey, token) {
+		return nil, errInvalidToken
 	}
 
 	return handler(context.WithValue(ctx, lndPubkey, pubkey), req)
 }
 
-// StreamServerAuthenticationInterceptor checks if a signed message was
-// signed by provided lnd node. To check if the provided pubkey is the
-// identity of origin, the origin has to provide the pubkey as well as
-// a signed message in the metadata of the request.
+// StreamServerAuthenticationInterceptor checks if the request carries a
+// valid session token of the provided lnd node. The origin has to provide
+// the pubkey as well as the token in the metadata of the request.
 // {
-//	"pubkey": the-nodes-62-chars-long-pubkey (string),
-//	"sig": the-message-signed-by-node (string)
+//	"pubkey": the-nodes-66-chars-long-pubkey (string),
+//	"token": the-session-token (string)
 // }
 func (u *GPRCUtils) StreamServerAuthenticationInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
 	// Skip the authentication if the requested method is public
@@ -117,23 +144,18 @@ func (u *GPRCUtils) StreamServerAuthenticationInterceptor(srv interface{}, ss gr
 		return errMissingPubkey
 	}
 
-	sig, ok := getSig(md)
+	token, ok := getToken(md)
 	if !ok {
-		return errMissingSig
+		return errMissingToken
 	}
 
-	ok, err := u.valid(ss.Context(), pubkey, sig)
-	if err != nil {
-		log.Printf("\t [LND UTILS] > unable to process signature: %v", err)
-		return err
-	}
-	if !ok {
-		return errInvalidSignature
+	if !u.sessions.validSession(pubkey, token) {
+		return errInvalidToken
 	}
 
 	wrapped := grpc_middleware.WrapServerStream(ss)
 	wrapped.WrappedContext = context.WithValue(ss.Context(), lndPubkey, pubkey)
-	err = handler(srv, wrapped)
+	err := handler(srv, wrapped)
 	if err != nil {
 		log.Printf("\t [RPC] > failed with error: %v", err)
 	}
@@ -149,19 +171,19 @@ func getPubkey(md metadata.MD) (string, bool) {
 	return strings.TrimSpace(md["pubkey"][0]), true
 }
 
-// getSig retrieves the signature from metadata.
-func getSig(md metadata.MD) (string, bool) {
-	if len(md["sig"]) < 1 {
+// getToken retrieves the session token from metadata.
+func getToken(md metadata.MD) (string, bool) {
+	if len(md["token"]) < 1 {
 		return "", false
 	}
-	return strings.TrimSpace(md["sig"][0]), true
+	return strings.TrimSpace(md["token"][0]), true
 }
 
 // valid checks if the correct message was signed, and if it
 // was signed by the given pubkey
-func (u *GPRCUtils) valid(ctx context.Context, pubkey string, sig string) (bool, error) {
+func (u *GPRCUtils) valid(ctx context.Context, pubkey string, msg string, sig string) (bool, error) {
 	r, err := u.vc.VerifyMessage(ctx, &lnrpc.VerifyMessageRequest{
-		Msg:       []byte(AuthMsg),
+		Msg:       []byte(msg),
 		Signature: sig,
 	})
 	if err != nil {
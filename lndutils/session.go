@@ -0,0 +1,188 @@
+package lndutils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultChallengeTTL is the time a client has to sign and return
+	// a challenge before it expires.
+	DefaultChallengeTTL = time.Minute
+	// DefaultSessionTTL is the lifetime of a session token.
+	DefaultSessionTTL = 10 * time.Minute
+)
+
+// ChallengeMsg returns the message a client has to sign to answer
+// the given challenge.
+func ChallengeMsg(challenge string) string {
+	return fmt.Sprintf("%s:%s", AuthMsg, challenge)
+}
+
+// IdentityMsg returns the message the server signs to prove its node
+// identity to a client that sent the nonce. The fingerprint of the tls
+// certificate binds the proof to the connection, it is empty without tls.
+func IdentityMsg(nonce string, tlsFingerprint string) string {
+	return fmt.Sprintf("%s-info:%s:%s", AuthMsg, nonce, tlsFingerprint)
+}
+
+type session struct {
+	pubkey string
+	expiry time.Time
+}
+
+const (
+	challengeNonceLen = 16
+	challengeMacLen   = 16
+	challengeLen      = challengeNonceLen + 8 + challengeMacLen
+)
+
+// sessionStore issues stateless challenges and keeps track of answered
+// challenges and the session tokens that were issued for them. A challenge
+// carries its expiry and is authenticated with a secret of the store, so
+// unanswered challenges take no memory.
+type sessionStore struct {
+	sync.Mutex
+	challengeTTL time.Duration
+	sessionTTL   time.Duration
+	secret       []byte
+
+	usedChallenges map[string]time.Time
+	sessions       map[string]*session
+}
+
+func newSessionStore(challengeTTL, sessionTTL time.Duration) *sessionStore {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(fmt.Sprintf("unable to create challenge secret: %v", err))
+	}
+	return &sessionStore{
+		challengeTTL:   challengeTTL,
+		sessionTTL:     sessionTTL,
+		secret:         secret,
+		usedChallenges: make(map[string]time.Time),
+		sessions:       make(map[string]*session),
+	}
+}
+
+// newChallenge creates a new random challenge of the form
+// nonce | expiry | mac.
+func (s *sessionStore) newChallenge() (string, time.Time, error) {
+	challenge := make([]byte, challengeLen)
+	if _, err := rand.Read(challenge[:challengeNonceLen]); err != nil {
+		return "", time.Time{}, err
+	}
+	expiry := time.Now().Add(s.challengeTTL)
+	binary.BigEndian.PutUint64(challenge[challengeNonceLen:], uint64(expiry.Unix()))
+	copy(challenge[challengeNonceLen+8:], s.challengeMac(challenge[:challengeNonceLen+8]))
+	return hex.EncodeToString(challenge), time.Unix(expiry.Unix(), 0), nil
+}
+
+// validChallenge checks if the challenge was issued by the store and has
+// neither expired nor been used.
+func (s *sessionStore) validChallenge(challenge string) bool {
+	expiry, ok := s.challengeExpiry(challenge)
+	if !ok || time.Now().After(expiry) {
+		return false
+	}
+	s.Lock()
+	defer s.Unlock()
+	_, used := s.usedChallenges[challenge]
+	return !used
+}
+
+// useChallenge marks the challenge as used, it returns false if the
+// challenge is invalid, expired or was already used. Only answered
+// challenges are remembered until they expire.
+func (s *sessionStore) useChallenge(challenge string) bool {
+	expiry, ok := s.challengeExpiry(challenge)
+	if !ok || time.Now().After(expiry) {
+		return false
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.prune()
+	if _, used := s.usedChallenges[challenge]; used {
+		return false
+	}
+	s.usedChallenges[challenge] = expiry
+	return true
+}
+
+// challengeExpiry returns the expiry of the challenge if its mac is valid.
+func (s *sessionStore) challengeExpiry(challenge string) (time.Time, bool) {
+	raw, err := hex.DecodeString(challenge)
+	if err != nil || len(raw) != challengeLen {
+		return time.Time{}, false
+	}
+	if !hmac.Equal(raw[challengeNonceLen+8:], s.challengeMac(raw[:challengeNonceLen+8])) {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(binary.BigEndian.Uint64(raw[challengeNonceLen:])), 0), true
+}
+
+func (s *sessionStore) challengeMac(msg []byte) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(msg)
+	return mac.Sum(nil)[:challengeMacLen]
+}
+
+// newSession creates a new session token bound to the pubkey.
+func (s *sessionStore) newSession(pubkey string) (string, time.Time, error) {
+	token, err := randomHex(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.prune()
+	expiry := time.Now().Add(s.sessionTTL)
+	s.sessions[token] = &session{pubkey: pubkey, expiry: expiry}
+	return token, expiry, nil
+}
+
+// validSession checks if the token belongs to a non expired session of
+// the pubkey.
+func (s *sessionStore) validSession(pubkey string, token string) bool {
+	s.Lock()
+	defer s.Unlock()
+	sess, ok := s.sessions[token]
+	if !ok {
+		return false
+	}
+	if time.Now().After(sess.expiry) {
+		delete(s.sessions, token)
+		return false
+	}
+	return sess.pubkey == pubkey
+}
+
+// prune removes all expired used challenges and sessions. The caller must
+// hold the lock.
+func (s *sessionStore) prune() {
+	now := time.Now()
+	for k, v := range s.usedChallenges {
+		if now.After(v) {
+			delete(s.usedChallenges, k)
+		}
+	}
+	for k, v := range s.sessions {
+		if now.After(v.expiry) {
+			delete(s.sessions, k)
+		}
+	}
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,61 @@
+package lndutils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChallenges(t *testing.T) {
+	s := newSessionStore(time.Minute, time.Minute)
+	for i := 0; i < 1000; i++ {
+		if _, _, err := s.newChallenge(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(s.usedChallenges) != 0 {
+		t.Fatalf("unanswered challenges are stored: %v", len(s.usedChallenges))
+	}
+
+	challenge, expiry, err := s.newChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expiry.Before(time.Now()) {
+		t.Fatalf("challenge already expired: %v", expiry)
+	}
+	if !s.validChallenge(challenge) {
+		t.Fatal("fresh challenge is invalid")
+	}
+	tampered := []byte(challenge)
+	if tampered[0] == '0' {
+		tampered[0] = '1'
+	} else {
+		tampered[0] = '0'
+	}
+	if s.validChallenge(string(tampered)) || s.useChallenge(string(tampered)) {
+		t.Fatal("tampered challenge accepted")
+	}
+	if s.validChallenge("00") || s.validChallenge("not hex") {
+		t.Fatal("malformed challenge accepted")
+	}
+	if !s.useChallenge(challenge) {
+		t.Fatal("unable to use fresh challenge")
+	}
+	if s.validChallenge(challenge) || s.useChallenge(challenge) {
+		t.Fatal("challenge accepted twice")
+	}
+
+	other := newSessionStore(time.Minute, time.Minute)
+	if other.validChallenge(challenge) {
+		t.Fatal("challenge of another store accepted")
+	}
+
+	expired := newSessionStore(-time.Minute, time.Minute)
+	challenge, _, err = expired.newChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expired.validChallenge(challenge) || expired.useChallenge(challenge) {
+		t.Fatal("expired challenge accepted")
+	}
+}
@@ -0,0 +1,188 @@
+package lndutils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	// certOrganization is the organization of autogenerated certificates.
+	certOrganization = "ln-fileserver autogenerated cert"
+	// certValidity is the validity of autogenerated certificates, the same
+	// as lnd uses.
+	certValidity = 14 * 30 * 24 * time.Hour
+	// TLSMsg prefixes the fingerprint signed by the node key of the server
+	// to prove that the tls certificate belongs to the node.
+	TLSMsg = "lndprivatefileserver-tls"
+)
+
+// TLSFingerprintMsg returns the message the server signs to publish the
+// fingerprint of its tls certificate.
+func TLSFingerprintMsg(fingerprint string) string {
+	return fmt.Sprintf("%s:%s", TLSMsg, fingerprint)
+}
+
+// CertFingerprint returns the hex encoded sha256 hash of the DER encoded
+// certificate.
+func CertFingerprint(der []byte) string {
+	hash := sha256.Sum256(der)
+	return hex.EncodeToString(hash[:])
+}
+
+// GenCertPair generates a self-signed certificate and key like lnd does.
+// The certificate is valid for localhost, the hostname, all interface
+// addresses and the extra domains.
+func GenCertPair(certPath string, keyPath string, extraDomains []string) error {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	dnsNames := []string{host}
+	if host != "localhost" {
+		dnsNames = append(dnsNames, "localhost")
+	}
+	dnsNames = append(dnsNames, extraDomains...)
+	ipAddresses := []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
+			ipAddresses = append(ipAddresses, ipnet.IP)
+		}
+	}
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			Organization: []string{certOrganization},
+			CommonName:   host,
+		},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(certValidity),
+		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		DNSNames:              dnsNames,
+		IPAddresses:           ipAddresses,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+	if err != nil {
+		return fmt.Errorf("unable to create certificate: %v", err)
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		return err
+	}
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes})
+	if err := ioutil.WriteFile(certPath, certPem, 0644); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(keyPath, keyPem, 0600); err != nil {
+		os.Remove(certPath)
+		return err
+	}
+	return nil
+}
+
+// LoadServerCredentials loads the certificate and key of the server. If
+// neither exists a self-signed certificate is generated. It returns the
+// credentials and the fingerprint of the certificate.
+func LoadServerCredentials(certPath string, keyPath string, extraDomains []string) (credentials.TransportCredentials, string, error) {
+	if !fileExists(certPath) && !fileExists(keyPath) {
+		if err := GenCertPair(certPath, keyPath, extraDomains); err != nil {
+			return nil, "", err
+		}
+	}
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, "", err
+	}
+	creds := credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	})
+	return creds, CertFingerprint(cert.Certificate[0]), nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// PinnedCertificate only accepts a server certificate with a known
+// fingerprint. If no fingerprint is set the first certificate is accepted
+// and pinned, its fingerprint has to be verified before anything is sent
+// to the server.
+type PinnedCertificate struct {
+	sync.Mutex
+	fingerprint string
+}
+
+// NewPinnedCertificate pins the hex encoded sha256 fingerprint, an empty
+// fingerprint pins the first certificate.
+func NewPinnedCertificate(fingerprint string) *PinnedCertificate {
+	return &PinnedCertificate{fingerprint: strings.ToLower(fingerprint)}
+}
+
+// Fingerprint returns the pinned fingerprint.
+func (p *PinnedCertificate) Fingerprint() string {
+	p.Lock()
+	defer p.Unlock()
+	return p.fingerprint
+}
+
+// Credentials returns transport credentials that only accept the pinned
+// certificate. The certificate chain and hostname are not verified.
+func (p *PinnedCertificate) Credentials() credentials.TransportCredentials {
+	return credentials.NewTLS(&tls.Config{
+		InsecureSkipVerify:    true,
+		VerifyPeerCertificate: p.verify,
+		MinVersion:            tls.VersionTLS12,
+	})
+}
+
+func (p *PinnedCertificate) verify(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("server sent no certificate")
+	}
+	fingerprint := CertFingerprint(rawCerts[0])
+	p.Lock()
+	defer p.Unlock()
+	if p.fingerprint == "" {
+		p.fingerprint = fingerprint
+	}
+	if fingerprint != p.fingerprint {
+		return fmt.Errorf("certificate fingerprint %s does not match pinned fingerprint %s", fingerprint, p.fingerprint)
+	}
+	return nil
+}
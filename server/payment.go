@@ -0,0 +1,300 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/sputn1ck/ln-fileserver/api"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+const (
+	// minInvoiceMsat is the minimum amount of an invoice sent to clients.
+	minInvoiceMsat = 1000
+	// invoiceExpiry is the expiry in seconds of the invoices sent to clients.
+	invoiceExpiry = 60
+	// paymentGracePeriod is the time after the expiry of an invoice until
+	// the server stops waiting for a payment.
+	paymentGracePeriod = 15 * time.Second
+	// resolveTimeout is the timeout for settling or canceling a held payment.
+	resolveTimeout = 30 * time.Second
+	// maxPaymentTime is the longest time from sending an invoice until the
+	// paid service is delivered.
+	maxPaymentTime = invoiceExpiry*time.Second + paymentGracePeriod + resolveTimeout
+)
+
+// sendInvoiceFunc sends an invoice to the client.
+type sendInvoiceFunc func(invoice *api.InvoiceResponse) error
+
+// heldPayment is a payment that is only completed once the paid service was
+// delivered. A nil heldPayment has nothing to settle or cancel.
+type heldPayment struct {
+	settle func(ctx context.Context) error
+	cancel func(ctx context.Context) error
+}
+
+// Settle completes the payment.
+func (h *heldPayment) Settle() error {
+	if h == nil || h.settle == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	return h.settle(ctx)
+}
+
+// Cancel returns the payment to the user.
+func (h *heldPayment) Cancel() {
+	if h == nil || h.cancel == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	if err := h.cancel(ctx); err != nil {
+		fmt.Printf("\n \t [FS] unable to cancel payment: %v", err)
+	}
+}
+
+// requestPayment charges msatCost to the prepaid balance of the user. If
+// the balance is too low, an invoice is sent to the client instead and the
+// call blocks until it is paid. If msatCost is 0 a free invoice is sent.
+// The returned payment has to be settled once the service was delivered, or
+// canceled if it failed.
+func (f *FileServer) requestPayment(ctx context.Context, pubkey string, memo string, msatCost int64, send sendInvoiceFunc) (*heldPayment, error) {
+	if msatCost <= 0 {
+		return nil, send(&api.InvoiceResponse{Invoice: "free"})
+	}
+	refund, ok, err := f.chargeBalance(ctx, pubkey, msatCost, send)
+	if ok || err != nil {
+		return refund, err
+	}
+	if msatCost < minInvoiceMsat {
+		msatCost = minInvoiceMsat
+	}
+	_, held, err := f.payInvoice(ctx, pubkey, memo, msatCost, f.holdInvoices, send)
+	return held, err
+}
+
+// chargeBalance debits msatCost from the prepaid balance of the user and
+// tells the client. It returns false if the balance is too low. The
+// returned payment refunds the balance if it is canceled.
+func (f *FileServer) chargeBalance(ctx context.Context, pubkey string, msatCost int64, send sendInvoiceFunc) (*heldPayment, bool, error) {
+	ok, err := f.fs.DebitBalance(ctx, pubkey, msatCost)
+	if err != nil {
+		return nil, false, status.Error(codes.Internal, fmt.Sprintf("unable to debit balance: %v", err))
+	}
+	if !ok {
+		return nil, false, nil
+	}
+	refund := &heldPayment{cancel: func(ctx context.Context) error {
+		_, err := f.fs.CreditBalance(ctx, pubkey, msatCost)
+		return err
+	}}
+	err = send(&api.InvoiceResponse{Prepaid: true})
+	if err != nil {
+		refund.Cancel()
+		return nil, false, err
+	}
+	return refund, true, nil
+}
+
+// deliverFunc delivers a paid service.
+type deliverFunc func(ctx context.Context) error
+
+// requestDelivery charges msatCost like requestPayment and delivers the
+// service once it is paid. Invoices that are settled on payment can not be
+// returned, so they are watched for the lifetime of the server and the
+// service is delivered even if the client disconnects after paying. If the
+// delivery fails, the amount paid is credited to the prepaid balance.
+func (f *FileServer) requestDelivery(ctx context.Context, pubkey string, memo string, msatCost int64, send sendInvoiceFunc, deliver deliverFunc) error {
+	if msatCost > 0 && !f.holdInvoices {
+		refund, ok, err := f.chargeBalance(ctx, pubkey, msatCost, send)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if msatCost < minInvoiceMsat {
+				msatCost = minInvoiceMsat
+			}
+			return f.payInvoiceDetached(ctx, memo, msatCost, send, func(ctx context.Context, payment *lnrpc.Invoice) error {
+				err := deliver(ctx)
+				if err != nil {
+					f.creditFailedDelivery(ctx, pubkey, memo, payment.AmtPaidMsat, err)
+				}
+				return err
+			})
+		}
+		if err := deliver(ctx); err != nil {
+			refund.Cancel()
+			return err
+		}
+		return nil
+	}
+	payment, err := f.requestPayment(ctx, pubkey, memo, msatCost, send)
+	if err != nil {
+		return err
+	}
+	if err := deliver(ctx); err != nil {
+		payment.Cancel()
+		return err
+	}
+	err = payment.Settle()
+	if err != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("unable to settle payment: %v", err))
+	}
+	return nil
+}
+
+// creditFailedDelivery credits a settled payment to the prepaid balance of
+// the user after the paid service could not be delivered.
+func (f *FileServer) creditFailedDelivery(ctx context.Context, pubkey string, memo string, msat int64, cause error) {
+	balance, err := f.fs.CreditBalance(ctx, pubkey, msat)
+	if err != nil {
+		fmt.Printf("\n \t [FS] unable to credit %v msat paid by %s for failed %q (%v): %v", msat, pubkey, memo, cause, err)
+		return
+	}
+	fmt.Printf("\n \t [FS] Credited %v msat paid by %s for failed %q (%v); balance: %v", msat, pubkey, memo, cause, balance)
+}
+
+// payInvoiceDetached sends an invoice over msatCost that is settled on
+// payment and calls onSettled once it is paid. The invoice is watched for
+// the lifetime of the server, so onSettled runs even if ctx is canceled
+// after the client paid. ctx only bounds how long the caller waits for the
+// result of onSettled.
+func (f *FileServer) payInvoiceDetached(ctx context.Context, memo string, msatCost int64, send sendInvoiceFunc, onSettled func(ctx context.Context, payment *lnrpc.Invoice) error) error {
+	paymentChan := make(chan *lnrpc.Invoice, 1)
+	invoice, err := f.lnd.CreateListenInvoice(context.Background(), paymentChan, &lnrpc.Invoice{
+		Memo:      memo,
+		ValueMsat: msatCost,
+		Expiry:    invoiceExpiry,
+	})
+	if err != nil {
+		return status.Error(codes.Unavailable, fmt.Sprintf("unable to create invoice: %v", err))
+	}
+	result := make(chan error, 1)
+	go func() {
+		result <- awaitSettled(paymentChan, onSettled)
+	}()
+	// an invoice the client did not receive can not be paid and expires
+	err = send(&api.InvoiceResponse{Invoice: invoice})
+	if err != nil {
+		return err
+	}
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// awaitSettled waits until the invoice is settled, canceled or expired and
+// calls onSettled if it was paid.
+func awaitSettled(paymentChan chan *lnrpc.Invoice, onSettled func(ctx context.Context, payment *lnrpc.Invoice) error) error {
+	timeout := time.NewTimer(invoiceExpiry*time.Second + paymentGracePeriod)
+	defer timeout.Stop()
+	select {
+	case payment := <-paymentChan:
+		switch payment.State {
+		case lnrpc.Invoice_SETTLED:
+			fmt.Printf("\n \t [FS] Invoice paid %v", payment)
+			ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+			defer cancel()
+			return onSettled(ctx, payment)
+		case lnrpc.Invoice_CANCELED:
+			return canceledInvoiceErr(payment)
+		default:
+			return status.Error(codes.Internal, fmt.Sprintf("unexpected invoice state %v", payment.State))
+		}
+	case <-timeout.C:
+		return status.Error(codes.DeadlineExceeded, "invoice expired before it was paid")
+	}
+}
+
+// canceledInvoiceErr returns DeadlineExceeded for invoices that expired and
+// FailedPrecondition for invoices that were canceled.
+func canceledInvoiceErr(payment *lnrpc.Invoice) error {
+	if payment.CreationDate+payment.Expiry <= time.Now().Unix() {
+		return status.Error(codes.DeadlineExceeded, "invoice expired before it was paid")
+	}
+	return status.Error(codes.FailedPrecondition, "invoice was canceled")
+}
+
+// payInvoice sends an invoice over msatCost to the client and blocks until
+// it is settled, or accepted if hold is set. Accepted hold invoices are
+// returned as held payment. Canceled invoices return FailedPrecondition and
+// invoices that expire unpaid return DeadlineExceeded. Invoices that are
+// settled on payment are still watched if ctx is canceled, a later payment
+// is credited to the prepaid balance of the user.
+func (f *FileServer) payInvoice(ctx context.Context, pubkey string, memo string, msatCost int64, hold bool, send sendInvoiceFunc) (*lnrpc.Invoice, *heldPayment, error) {
+	var (
+		paymentChan = make(chan *lnrpc.Invoice, 1)
+		invoice     string
+		held        *heldPayment
+		err         error
+	)
+	req := &lnrpc.Invoice{
+		Memo:      memo,
+		ValueMsat: msatCost,
+		Expiry:    invoiceExpiry,
+	}
+	if hold {
+		holdBackend := f.lnd.(HoldPaymentBackend)
+		var hash []byte
+		invoice, hash, err = holdBackend.CreateListenHoldInvoice(ctx, paymentChan, req)
+		held = &heldPayment{
+			settle: func(ctx context.Context) error {
+				return holdBackend.SettleHoldInvoice(ctx, hash)
+			},
+			cancel: func(ctx context.Context) error {
+				return holdBackend.CancelHoldInvoice(ctx, hash)
+			},
+		}
+	} else {
+		// the invoice is watched beyond ctx, so a payment made while
+		// the client disconnects is not lost
+		invoice, err = f.lnd.CreateListenInvoice(context.Background(), paymentChan, req)
+	}
+	if err != nil {
+		return nil, nil, status.Error(codes.Unavailable, fmt.Sprintf("unable to create invoice: %v", err))
+	}
+	err = send(&api.InvoiceResponse{Invoice: invoice})
+	if err != nil {
+		held.Cancel()
+		return nil, nil, err
+	}
+
+	// Wait for invoice paid
+	timeout := time.NewTimer(invoiceExpiry*time.Second + paymentGracePeriod)
+	defer timeout.Stop()
+	select {
+	case payment := <-paymentChan:
+		switch payment.State {
+		case lnrpc.Invoice_SETTLED, lnrpc.Invoice_ACCEPTED:
+			fmt.Printf("\n \t [FS] Invoice paid %v", payment)
+			return payment, held, nil
+		case lnrpc.Invoice_CANCELED:
+			held.Cancel()
+			return nil, nil, canceledInvoiceErr(payment)
+		default:
+			held.Cancel()
+			return nil, nil, status.Error(codes.Internal, fmt.Sprintf("unexpected invoice state %v", payment.State))
+		}
+	case <-timeout.C:
+		held.Cancel()
+		return nil, nil, status.Error(codes.DeadlineExceeded, "invoice expired before it was paid")
+	case <-ctx.Done():
+		if hold {
+			held.Cancel()
+		} else {
+			cause := ctx.Err()
+			go awaitSettled(paymentChan, func(ctx context.Context, payment *lnrpc.Invoice) error {
+				f.creditFailedDelivery(ctx, pubkey, memo, payment.AmtPaidMsat, cause)
+				return nil
+			})
+		}
+		return nil, nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
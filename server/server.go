@@ -2,12 +2,15 @@ package server
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"github.com/lightningnetwork/lnd/lnrpc"
 	"github.com/sputn1ck/ln-fileserver/api"
 	"github.com/sputn1ck/ln-fileserver/filestore"
-	lnd2 "github.com/sputn1ck/ln-fileserver/lnd"
+	"github.com/sputn1ck/ln-fileserver/lndutils"
 	"github.com/sputn1ck/ln-fileserver/utils"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
@@ -15,20 +18,181 @@ import (
 	"time"
 )
 
+// PaymentBackend creates invoices and notifies once they are settled.
+type PaymentBackend interface {
+	// CreateListenInvoice adds the invoice and returns its payment request.
+	// The invoice is sent to paymentChan once it is settled or canceled.
+	CreateListenInvoice(ctx context.Context, paymentChan chan *lnrpc.Invoice, invoice *lnrpc.Invoice) (string, error)
+}
+
+// HoldPaymentBackend is a PaymentBackend that supports hold invoices, which
+// are only settled once the paid service was delivered.
+type HoldPaymentBackend interface {
+	PaymentBackend
+	// CreateListenHoldInvoice adds a hold invoice and returns its payment
+	// request and payment hash. The invoice is sent to paymentChan once it
+	// is accepted or canceled.
+	CreateListenHoldInvoice(ctx context.Context, paymentChan chan *lnrpc.Invoice, invoice *lnrpc.Invoice) (string, []byte, error)
+	// SettleHoldInvoice settles an accepted hold invoice.
+	SettleHoldInvoice(ctx context.Context, paymentHash []byte) error
+	// CancelHoldInvoice cancels a hold invoice.
+	CancelHoldInvoice(ctx context.Context, paymentHash []byte) error
+}
+
+// NodeSigner signs messages with the key of the lnd node.
+type NodeSigner interface {
+	SignMessage(ctx context.Context, in *lnrpc.SignMessageRequest, opts ...grpc.CallOption) (*lnrpc.SignMessageResponse, error)
+}
+
+// Version is the version of ln-fileserver returned by GetInfo.
+var Version = "0.1.0"
+
+// maxNonceBytes and minNonceBytes restrict the nonce signed by GetInfo.
+const (
+	minNonceBytes = 8
+	maxNonceBytes = 64
+)
+
 type FileServer struct {
-	fs  *filestore.Service
-	lnd *lnd2.Service
+	fs   *filestore.Service
+	lnd  PaymentBackend
+	auth *lndutils.GPRCUtils
+
+	fees            *api.FeeReport
+	holdInvoices    bool
+	verifyDownloads bool
+	feeBasis        api.FeeBasis
+	tlsIdentity     *api.TlsIdentity
+	signer          NodeSigner
+	nodeIdentity    *api.NodeIdentity
+}
+
+func NewFileServer(fs *filestore.Service, lnd PaymentBackend, auth *lndutils.GPRCUtils, fees *api.FeeReport) *FileServer {
+	return &FileServer{fs: fs, lnd: lnd, auth: auth, fees: fees}
+}
+
+// EnableHoldInvoices makes the server use hold invoices, which are settled
+// after a chunk was written or sent and canceled if that fails.
+func (f *FileServer) EnableHoldInvoices() error {
+	if _, ok := f.lnd.(HoldPaymentBackend); !ok {
+		return fmt.Errorf("payment backend does not support hold invoices")
+	}
+	f.holdInvoices = true
+	return nil
+}
+
+// EnableDownloadVerification makes the server check the checksum of a file
+// before it is downloaded as a whole, corrupted files fail with DataLoss.
+// Ranged and resumed downloads are not verified, since the whole file would
+// have to be read for every range.
+func (f *FileServer) EnableDownloadVerification() {
+	f.verifyDownloads = true
+}
+
+// SetFeeBasis sets whether fees are based on the size of uploaded files or
+// on the size of the stored blobs. Uploads are paid on their uploaded size,
+// as the stored size is only known once the upload is finished. With
+// PHYSICAL_BYTES the difference of the storage fee is credited to the
+// prepaid balance afterwards.
+func (f *FileServer) SetFeeBasis(basis api.FeeBasis) {
+	f.feeBasis = basis
+}
 
-	fees *api.FeeReport
+// SetTLSIdentity publishes the fingerprint of the tls certificate and its
+// signature by the node key in GetInfo.
+func (f *FileServer) SetTLSIdentity(fingerprint string, signature string) {
+	f.tlsIdentity = &api.TlsIdentity{Fingerprint: fingerprint, Signature: signature}
+}
+
+// SetNodeIdentity returns the pubkey and alias of the node in GetInfo and
+// signs the nonces of clients with the node key.
+func (f *FileServer) SetNodeIdentity(signer NodeSigner, pubkey string, alias string) {
+	f.signer = signer
+	f.nodeIdentity = &api.NodeIdentity{Pubkey: pubkey, Alias: alias, Version: Version}
+}
+
+// signNonce signs the nonce of a client together with the fingerprint of the
+// tls certificate.
+func (f *FileServer) signNonce(ctx context.Context, nonce string) (string, error) {
+	if raw, err := hex.DecodeString(nonce); err != nil || len(raw) < minNonceBytes || len(raw) > maxNonceBytes {
+		return "", status.Error(codes.InvalidArgument, fmt.Sprintf("nonce must be %v to %v hex encoded bytes", minNonceBytes, maxNonceBytes))
+	}
+	var fingerprint string
+	if f.tlsIdentity != nil {
+		fingerprint = f.tlsIdentity.Fingerprint
+	}
+	sig, err := f.signer.SignMessage(ctx, &lnrpc.SignMessageRequest{Msg: []byte(lndutils.IdentityMsg(nonce, fingerprint))})
+	if err != nil {
+		return "", status.Error(codes.Internal, fmt.Sprintf("unable to sign nonce: %v", err))
+	}
+	return sig.Signature, nil
 }
 
-func NewFileServer(fs *filestore.Service, lnd *lnd2.Service, fees *api.FeeReport) *FileServer {
-	return &FileServer{fs: fs, lnd: lnd, fees: fees}
+// billedBytes returns the number of bytes that are charged for n bytes of
+// the file.
+func (f *FileServer) billedBytes(slot *filestore.FileSlot, n int64) int64 {
+	if f.feeBasis != api.FeeBasis_PHYSICAL_BYTES || slot.Bytes == 0 || slot.PhysicalBytes == 0 {
+		return n
+	}
+	return n * slot.PhysicalBytes / slot.Bytes
 }
 
 func (f *FileServer) GetInfo(ctx context.Context, req *api.GetInfoRequest) (*api.GetInfoResponse, error) {
+	limits := f.fs.Limits()
+	available, err := f.fs.AvailableBytes()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	var nodeIdentity *api.NodeIdentity
+	if f.nodeIdentity != nil {
+		nodeIdentity = &api.NodeIdentity{
+			Pubkey:  f.nodeIdentity.Pubkey,
+			Alias:   f.nodeIdentity.Alias,
+			Version: f.nodeIdentity.Version,
+		}
+		if req.Nonce != "" {
+			nodeIdentity.Signature, err = f.signNonce(ctx, req.Nonce)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
 	return &api.GetInfoResponse{
 		FeeReport: f.fees,
+		Limits: &api.Limits{
+			MaxBytesPerUser: limits.MaxBytesPerUser,
+			MaxFilesPerUser: limits.MaxFilesPerUser,
+			MaxFileSize:     limits.MaxFileSize,
+			AvailableBytes:  available,
+		},
+		Storage: &api.Storage{
+			Compression: f.fs.Compression(),
+			FeeBasis:    f.feeBasis,
+		},
+		TlsIdentity:  f.tlsIdentity,
+		NodeIdentity: nodeIdentity,
+	}, nil
+}
+
+func (f *FileServer) GetChallenge(ctx context.Context, req *api.GetChallengeRequest) (*api.GetChallengeResponse, error) {
+	challenge, expiry, err := f.auth.NewChallenge()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &api.GetChallengeResponse{
+		Challenge: challenge,
+		Expiry:    expiry.UTC().Unix(),
+	}, nil
+}
+
+func (f *FileServer) Authenticate(ctx context.Context, req *api.AuthenticateRequest) (*api.AuthenticateResponse, error) {
+	token, expiry, err := f.auth.Authenticate(ctx, req.Pubkey, req.Challenge, req.Sig)
+	if err != nil {
+		return nil, err
+	}
+	return &api.AuthenticateResponse{
+		Token:  token,
+		Expiry: expiry.UTC().Unix(),
 	}, nil
 }
 
@@ -42,6 +206,9 @@ func (f *FileServer) ListFiles(ctx context.Context, req *api.ListFilesRequest) (
 	if len(pubkey) != 1 {
 		return nil, status.Error(codes.FailedPrecondition, fmt.Sprintf("unable to get pubkey from metadata"))
 	}
+	if err := filestore.ValidatePubkey(pubkey[0]); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 	fileSlots, err := f.fs.ListFiles(ctx, pubkey[0])
 	if err != nil {
 		return nil, status.Error(codes.Unknown, err.Error())
@@ -66,56 +233,85 @@ func (f *FileServer) UploadFile(srv api.PrivateFileStore_UploadFileServer) error
 	if len(pubkey) != 1 {
 		return status.Error(codes.FailedPrecondition, fmt.Sprintf("unable to get pubkey from metadata"))
 	}
+	if err := filestore.ValidatePubkey(pubkey[0]); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
 
 	// Get Initial Request
 	req, err := srv.Recv()
 	if err != nil {
 		return err
 	}
-	newFileSlot := req.GetSlot()
-	if newFileSlot == nil {
-		return fmt.Errorf("Expected NewFileSlot")
-	}
-	storeTime := newFileSlot.DeletionDate - startTime
-	if storeTime < 3600 {
-		return fmt.Errorf("minimum store time is 1 hour")
-	}
-	cost := f.fees.MsatBaseCost
-	paymentChan := make(chan *lnrpc.Invoice)
-
-	fmt.Printf("\n \t [FS] new Fileslot Request Cost:%v;Store Time: %v;Fileslot request %v", cost, storeTime,newFileSlot)
-	defer close(paymentChan)
-	if cost > 0 {
-		// Return CreationInvoice
-		invoice, err := f.lnd.CreateListenInvoice(srv.Context(), paymentChan, &lnrpc.Invoice{
-			Memo:      "Create Fileslot",
-			ValueMsat: f.fees.MsatBaseCost,
-			Expiry:    60,
-		})
-		err = srv.Send(&api.UploadFileResponse{Event: &api.UploadFileResponse_Invoice{Invoice: &api.InvoiceResponse{Invoice: invoice}}})
+	var fileSlot *filestore.FileSlot
+	switch req.Event.(type) {
+	case *api.UploadFileRequest_Slot:
+		fileSlot, err = f.newUpload(srv, pubkey[0], req.GetSlot())
 		if err != nil {
 			return err
 		}
-
-		// Wait for invoice paid
-		_ = <-paymentChan
-	} else {
-		err = srv.Send(&api.UploadFileResponse{Event: &api.UploadFileResponse_Invoice{Invoice: &api.InvoiceResponse{Invoice: "free"}}})
+	case *api.UploadFileRequest_Resume:
+		if err := filestore.ValidateFileId(req.GetResume().UploadId); err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		fileSlot, err = f.fs.GetPendingFile(srv.Context(), pubkey[0], req.GetResume().UploadId)
+		if err == filestore.FileNotFoundErr || err == filestore.NotFoundErr {
+			return status.Error(codes.NotFound, err.Error())
+		}
 		if err != nil {
 			return err
 		}
+	default:
+		return fmt.Errorf("Expected NewFileSlot or ResumeUpload")
+	}
+	// concurrent streams would interleave their chunks
+	release, err := f.fs.LockUpload(pubkey[0], fileSlot.Id)
+	if err == filestore.UploadInUseErr {
+		return status.Error(codes.Aborted, err.Error())
 	}
-	// Create FileSlot
-	fileSlot, err := f.fs.NewFile(srv.Context(), pubkey[0], newFileSlot.Filename, newFileSlot.Description, newFileSlot.DeletionDate)
 	if err != nil {
 		return err
 	}
-	// Get FileWriter
-	fileWriter, err := f.fs.GetFileWriter(srv.Context(), pubkey[0], fileSlot.Id)
+	defer release()
+	storeTime := fileSlot.DeletionDate - startTime
+	if storeTime <= 0 {
+		return status.Error(codes.FailedPrecondition, "upload expired")
+	}
+	// uploads with declared bytes are paid up front
+	prepaid := fileSlot.DeclaredBytes > 0
+	var storagePayment *heldPayment
+	if prepaid && f.holdInvoices {
+		// the storage is held until the file is saved, so uploads that fail
+		// or are interrupted are not charged for it
+		msatCost := utils.GetTotalUploadFee(fileSlot.DeclaredBytes, storeTime, f.fees)
+		storagePayment, err = f.requestPayment(srv.Context(), pubkey[0], "Upload File", msatCost, uploadInvoiceSender(srv))
+		if err != nil {
+			return err
+		}
+		defer func() {
+			storagePayment.Cancel()
+		}()
+	}
+	// Get FileWriter, only paid chunks are written so the size of the
+	// file is the offset to resume from
+	fileWriter, offset, err := f.fs.GetFileAppender(srv.Context(), pubkey[0], fileSlot.Id)
 	if err != nil {
 		return err
 	}
 	defer fileWriter.Close()
+	written := offset
+	quota, err := f.fs.NewQuota(srv.Context(), pubkey[0], offset, fileSlot.DeclaredBytes)
+	if err != nil {
+		return err
+	}
+	defer quota.Close()
+	fmt.Printf("\n \t [FS] Upload session %v; offset: %v", fileSlot.Id, offset)
+	err = srv.Send(&api.UploadFileResponse{Event: &api.UploadFileResponse_Session{Session: &api.UploadSession{
+		UploadId: fileSlot.Id,
+		Offset:   offset,
+	}}})
+	if err != nil {
+		return err
+	}
 Loop:
 	for {
 		req, err = srv.Recv()
@@ -132,43 +328,72 @@ Loop:
 			fmt.Printf("\n \t [FS] Finished Upload")
 			break Loop
 		case *api.UploadFileRequest_Chunk:
-			// Add Bytes
 			chunk := req.GetChunk()
-			_, err := fileWriter.Write(chunk.Content)
-			// Get Invoice
-			msatCost := utils.GetUploadChunkFee(len(chunk.Content), storeTime, f.fees)
-			fmt.Printf("\n \t [FS] New Chunk; size: %v; cost: %v;", len(chunk.Content), msatCost)
-			if msatCost > 0 {
-				if msatCost < 1000 {
-					msatCost = 1000
-				}
-				invoice, err := f.lnd.CreateListenInvoice(srv.Context(), paymentChan, &lnrpc.Invoice{
-					Memo:      "Uploading Chunk",
-					ValueMsat: msatCost,
-					Expiry:    60,
-				})
-				// Send Bytes Invoice
-				err = srv.Send(&api.UploadFileResponse{Event: &api.UploadFileResponse_Invoice{Invoice: &api.InvoiceResponse{Invoice: invoice}}})
-				if err != nil {
-					return err
+			var payment *heldPayment
+			err = quota.Reserve(srv.Context(), int64(len(chunk.Content)))
+			if filestore.IsQuotaErr(err) {
+				return status.Error(codes.ResourceExhausted, err.Error())
+			}
+			if err != nil {
+				return err
+			}
+			if prepaid {
+				if written+int64(len(chunk.Content)) > fileSlot.DeclaredBytes {
+					f.abortUpload(srv.Context(), pubkey[0], fileSlot.Id, fileWriter)
+					return status.Error(codes.InvalidArgument, filestore.SizeMismatchErr.Error())
 				}
-				// Wait for invoice paid
-				payment := <-paymentChan
-				fmt.Printf("\n \t [FS] Invoice paid %v", payment)
 			} else {
-				// Send Bytes Invoice
-				err = srv.Send(&api.UploadFileResponse{Event: &api.UploadFileResponse_Invoice{Invoice: &api.InvoiceResponse{Invoice: "free"}}})
+				// Get Invoice
+				msatCost := utils.GetUploadChunkFee(len(chunk.Content), storeTime, f.fees)
+				fmt.Printf("\n \t [FS] New Chunk; size: %v; cost: %v;", len(chunk.Content), msatCost)
+				// Send Bytes Invoice and wait for payment
+				payment, err = f.requestPayment(srv.Context(), pubkey[0], "Uploading Chunk", msatCost, uploadInvoiceSender(srv))
 				if err != nil {
+					// abort the upload if the invoice expired or was canceled
+					if code := status.Code(err); (code == codes.DeadlineExceeded || code == codes.FailedPrecondition) && srv.Context().Err() == nil {
+						f.abortUpload(srv.Context(), pubkey[0], fileSlot.Id, fileWriter)
+					}
 					return err
 				}
 			}
+			// Add Bytes, the written bytes are counted by the usage of
+			// the user from now on
+			n, err := fileWriter.Write(chunk.Content)
+			written += int64(n)
+			quota.Release()
+			if err == nil && f.holdInvoices {
+				err = fileWriter.Sync()
+			}
+			if err != nil {
+				payment.Cancel()
+				return status.Error(codes.Internal, fmt.Sprintf("unable to write chunk: %v", err))
+			}
+			err = payment.Settle()
+			if err != nil {
+				return status.Error(codes.Internal, fmt.Sprintf("unable to settle payment: %v", err))
+			}
 			break
 		}
 	}
-	fileSlot, err = f.fs.SaveFile(srv.Context(), pubkey[0], fileSlot, fileWriter)
+	savedSlot, err := f.fs.SaveFile(srv.Context(), pubkey[0], fileSlot, fileWriter)
+	if err == filestore.SizeMismatchErr || err == filestore.ChecksumMismatchErr {
+		f.abortUpload(srv.Context(), pubkey[0], fileSlot.Id, fileWriter)
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
 	if err != nil {
 		return err
 	}
+	fileSlot = savedSlot
+	err = storagePayment.Settle()
+	if err != nil {
+		// the file is not kept if its storage was not paid
+		if err := f.fs.DeleteFile(srv.Context(), pubkey[0], fileSlot.Id); err != nil {
+			fmt.Printf("\n \t [FS] unable to delete unpaid file %v: %v", fileSlot.Id, err)
+		}
+		return status.Error(codes.Internal, fmt.Sprintf("unable to settle payment: %v", err))
+	}
+	storagePayment = nil
+	f.refundCompressedStorage(srv.Context(), pubkey[0], fileSlot)
 	err = srv.Send(&api.UploadFileResponse{Event: &api.UploadFileResponse_FinishedFile{FinishedFile: f.YmlFileSlotToProto(fileSlot.Id, fileSlot)}})
 	if err != nil {
 		return err
@@ -178,6 +403,89 @@ Loop:
 
 }
 
+// newUpload charges the base cost and creates a new pending file slot. If
+// the size of the file is declared, the storage cost of the whole file is
+// charged as well, unless hold invoices are used. Then the storage is
+// charged by UploadFile and held until the file is saved.
+func (f *FileServer) newUpload(srv api.PrivateFileStore_UploadFileServer, pubkey string, newFileSlot *api.NewFileSlot) (*filestore.FileSlot, error) {
+	storeTime := newFileSlot.DeletionDate - time.Now().UTC().Unix()
+	if storeTime < 3600 {
+		return nil, fmt.Errorf("minimum store time is 1 hour")
+	}
+	if newFileSlot.Bytes < 0 {
+		return nil, status.Error(codes.InvalidArgument, "declared bytes must not be negative")
+	}
+	if newFileSlot.ShaChecksum != "" {
+		if sum, err := hex.DecodeString(newFileSlot.ShaChecksum); err != nil || len(sum) != sha256.Size {
+			return nil, status.Error(codes.InvalidArgument, "declared checksum must be a hex encoded sha256 hash")
+		}
+	}
+	// the file is reserved until the pending slot exists, so concurrent
+	// uploads can not exceed the limits
+	release, err := f.fs.ReserveNewFile(srv.Context(), pubkey, newFileSlot.Bytes)
+	if filestore.IsQuotaErr(err) {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	cost := f.fees.MsatBaseCost
+	memo := "Create Fileslot"
+	if newFileSlot.Bytes > 0 && !f.holdInvoices {
+		cost += utils.GetTotalUploadFee(newFileSlot.Bytes, storeTime, f.fees)
+		memo = "Upload File"
+	}
+
+	fmt.Printf("\n \t [FS] new Fileslot Request Cost:%v;Store Time: %v;Fileslot request %v", cost, storeTime, newFileSlot)
+	// Return CreationInvoice and wait for payment
+	payment, err := f.requestPayment(srv.Context(), pubkey, memo, cost, uploadInvoiceSender(srv))
+	if err != nil {
+		return nil, err
+	}
+	// Create FileSlot
+	fileSlot, err := f.fs.NewFile(srv.Context(), pubkey, newFileSlot.Filename, newFileSlot.Description, newFileSlot.DeletionDate, newFileSlot.Bytes, newFileSlot.ShaChecksum)
+	if err != nil {
+		payment.Cancel()
+		return nil, err
+	}
+	err = payment.Settle()
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("unable to settle payment: %v", err))
+	}
+	return fileSlot, nil
+}
+
+// refundCompressedStorage credits the storage fee of the bytes saved by
+// compression to the prepaid balance if fees are based on physical bytes.
+func (f *FileServer) refundCompressedStorage(ctx context.Context, pubkey string, slot *filestore.FileSlot) {
+	storeTime := slot.DeletionDate - slot.CreationDate
+	refund := utils.GetTotalUploadFee(slot.Bytes, storeTime, f.fees) - utils.GetTotalUploadFee(f.billedBytes(slot, slot.Bytes), storeTime, f.fees)
+	if refund <= 0 {
+		return
+	}
+	balance, err := f.fs.CreditBalance(ctx, pubkey, refund)
+	if err != nil {
+		fmt.Printf("\n \t [FS] unable to refund compressed storage of %v: %v", slot.Id, err)
+		return
+	}
+	fmt.Printf("\n \t [FS] Refunded %v msat for compressed storage of %v; balance: %v", refund, slot.Id, balance)
+}
+
+// abortUpload closes the file and deletes the pending upload.
+func (f *FileServer) abortUpload(ctx context.Context, pubkey string, fileid string, file io.Closer) {
+	file.Close()
+	if err := f.fs.DeletePendingFile(ctx, pubkey, fileid); err != nil {
+		fmt.Printf("\n \t [FS] unable to delete aborted upload %v: %v", fileid, err)
+	}
+}
+
+func uploadInvoiceSender(srv api.PrivateFileStore_UploadFileServer) sendInvoiceFunc {
+	return func(invoice *api.InvoiceResponse) error {
+		return srv.Send(&api.UploadFileResponse{Event: &api.UploadFileResponse_Invoice{Invoice: invoice}})
+	}
+}
+
 func (f *FileServer) DownloadFile(req *api.DownloadFileRequest, srv api.PrivateFileStore_DownloadFileServer) error {
 	ctx := srv.Context()
 	md, ok := metadata.FromIncomingContext(ctx)
@@ -189,65 +497,81 @@ func (f *FileServer) DownloadFile(req *api.DownloadFileRequest, srv api.PrivateF
 	if len(pubkey) != 1 {
 		return status.Error(codes.FailedPrecondition, fmt.Sprintf("unable to get pubkey from metadata"))
 	}
+	if err := filestore.ValidatePubkey(pubkey[0]); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
 
-	fmt.Printf("\n \t [FS] Requesting download %v", req.FileId)
+	fmt.Printf("\n \t [FS] Requesting download %v; offset: %v; length: %v", req.FileId, req.Offset, req.Length)
+	if err := filestore.ValidateFileId(req.FileId); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
 	// Get fileslot
 	fileSlot, err := f.fs.GetFile(ctx, pubkey[0], req.FileId)
+	if err == filestore.FileNotFoundErr || err == filestore.NotFoundErr {
+		return status.Error(codes.NotFound, err.Error())
+	}
 	if err != nil {
 		return err
 	}
+	if req.Offset < 0 || req.Length < 0 || req.Offset > fileSlot.Bytes {
+		return status.Error(codes.OutOfRange, fmt.Sprintf("invalid range offset %v length %v for file of %v bytes", req.Offset, req.Length, fileSlot.Bytes))
+	}
+	fullDownload := req.Offset == 0 && (req.Length == 0 || req.Length >= fileSlot.Bytes)
+	if f.verifyDownloads && fullDownload {
+		err = f.fs.VerifyFile(ctx, pubkey[0], fileSlot)
+		if err == filestore.CorruptedFileErr {
+			fmt.Printf("\n \t [FS] File %v of %v is corrupted", req.FileId, pubkey[0])
+			return status.Error(codes.DataLoss, err.Error())
+		}
+		if err != nil {
+			return err
+		}
+	}
 	err = srv.Send(&api.DownloadFileResponse{Event: &api.DownloadFileResponse_FileInfo{FileInfo: f.YmlFileSlotToProto(req.FileId, fileSlot)}})
 	if err != nil {
 		return err
 	}
 	// open filereader
-	file, err := f.fs.GetFileReader(ctx, pubkey[0], req.FileId)
+	reader, err := f.fs.GetFileRange(ctx, pubkey[0], req.FileId, req.Offset, req.Length)
 	if err != nil {
 		return err
 	}
+	defer reader.Close()
 	// create chunk buffer with 1mb
 	buf := make([]byte, 1024*1024)
-	paymentChan := make(chan *lnrpc.Invoice)
-	defer close(paymentChan)
 	reading := true
 	for reading {
-		n, err := file.Read(buf)
+		// blob stores may return data together with io.EOF
+		n, err := io.ReadFull(reader, buf)
 		if err == io.EOF {
 			reading = false
 			break
 		}
-		msatCost := utils.GetDownloadChunkFee(len(buf[:n]), f.fees)
+		if err == io.ErrUnexpectedEOF {
+			reading = false
+		} else if err != nil {
+			return err
+		}
+		msatCost := utils.GetDownloadChunkFee(int(f.billedBytes(fileSlot, int64(n))), f.fees)
 		fmt.Printf("Download chunk cost: %v", msatCost)
-		if msatCost > 0 {
-			if msatCost < 1000 {
-				msatCost = 1000
-			}
-			invoice, err := f.lnd.CreateListenInvoice(srv.Context(), paymentChan, &lnrpc.Invoice{
-				Memo:      "Downloading chunk",
-				ValueMsat: msatCost,
-				Expiry:    60,
-			})
-			// Send Bytes Invoice
-			err = srv.Send(&api.DownloadFileResponse{Event: &api.DownloadFileResponse_Invoice{Invoice: &api.InvoiceResponse{Invoice: invoice}}})
-			if err != nil {
-				return err
-			}
-			// Wait for invoice paid
-			payment := <-paymentChan
-			fmt.Printf("\n \t [FS] Invoice paid %v", payment)
-		} else {
-			// Send Bytes Invoice
-			err = srv.Send(&api.DownloadFileResponse{Event: &api.DownloadFileResponse_Invoice{Invoice: &api.InvoiceResponse{Invoice: "free"}}})
-			if err != nil {
-				return err
-			}
+		// Send Bytes Invoice and wait for payment
+		payment, err := f.requestPayment(ctx, pubkey[0], "Downloading chunk", msatCost, func(invoice *api.InvoiceResponse) error {
+			return srv.Send(&api.DownloadFileResponse{Event: &api.DownloadFileResponse_Invoice{Invoice: invoice}})
+		})
+		if err != nil {
+			return err
 		}
 		err = srv.Send(&api.DownloadFileResponse{Event: &api.DownloadFileResponse_Chunk{Chunk: &api.FileChunk{
 			Content: buf[:n],
 		}}})
 		if err != nil {
+			payment.Cancel()
 			return fmt.Errorf("\n [FS] > Error sending chunk req %v", err)
 		}
+		err = payment.Settle()
+		if err != nil {
+			return status.Error(codes.Internal, fmt.Sprintf("unable to settle payment: %v", err))
+		}
 	}
 
 	err = srv.Send(&api.DownloadFileResponse{Event: &api.DownloadFileResponse_Finished{Finished: &api.Empty{}}})
@@ -259,14 +583,164 @@ func (f *FileServer) DownloadFile(req *api.DownloadFileRequest, srv api.PrivateF
 
 }
 
+func (f *FileServer) DeleteFile(ctx context.Context, req *api.DeleteFileRequest) (*api.DeleteFileResponse, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("unable to read metadata"))
+	}
+
+	pubkey := md.Get("pubkey")
+	if len(pubkey) != 1 {
+		return nil, status.Error(codes.FailedPrecondition, fmt.Sprintf("unable to get pubkey from metadata"))
+	}
+	if err := filestore.ValidatePubkey(pubkey[0]); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := filestore.ValidateFileId(req.FileId); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	err := f.fs.DeleteFile(ctx, pubkey[0], req.FileId)
+	if err == filestore.FileNotFoundErr || err == filestore.NotFoundErr {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Unknown, err.Error())
+	}
+	fmt.Printf("\n \t [FS] File deleted %v", req.FileId)
+	return &api.DeleteFileResponse{}, nil
+}
+
+func (f *FileServer) ExtendFile(req *api.ExtendFileRequest, srv api.PrivateFileStore_ExtendFileServer) error {
+	ctx := srv.Context()
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return status.Error(codes.Internal, fmt.Sprintf("unable to read metadata"))
+	}
+
+	pubkey := md.Get("pubkey")
+	if len(pubkey) != 1 {
+		return status.Error(codes.FailedPrecondition, fmt.Sprintf("unable to get pubkey from metadata"))
+	}
+	if err := filestore.ValidatePubkey(pubkey[0]); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := filestore.ValidateFileId(req.FileId); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	fileSlot, err := f.fs.GetFile(ctx, pubkey[0], req.FileId)
+	if err == filestore.FileNotFoundErr || err == filestore.NotFoundErr {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+	// expired files that are not reaped yet are extended from now on
+	extendFrom := fileSlot.DeletionDate
+	if now := time.Now().UTC().Unix(); extendFrom < now {
+		extendFrom = now
+	}
+	extraTime := req.DeletionDate - extendFrom
+	if extraTime < 3600 {
+		return status.Error(codes.InvalidArgument, "minimum extension time is 1 hour")
+	}
+	msatCost := utils.GetTotalUploadFee(f.billedBytes(fileSlot, fileSlot.Bytes), extraTime, f.fees)
+	fmt.Printf("\n \t [FS] Extend Fileslot %v; extra time: %v; cost: %v;", req.FileId, extraTime, msatCost)
+	// keep the reaper from deleting the file while the extension is paid. A
+	// file reaped before it was protected fails to extend and the payment is
+	// credited.
+	f.fs.ProtectFile(pubkey[0], req.FileId, time.Now().Add(maxPaymentTime))
+	// Send Extension Invoice and extend the file once it is paid
+	var extended *filestore.FileSlot
+	err = f.requestDelivery(ctx, pubkey[0], "Extend Fileslot", msatCost, func(invoice *api.InvoiceResponse) error {
+		return srv.Send(&api.ExtendFileResponse{Event: &api.ExtendFileResponse_Invoice{Invoice: invoice}})
+	}, func(ctx context.Context) error {
+		var err error
+		extended, err = f.fs.SetDeletionDate(ctx, pubkey[0], req.FileId, req.DeletionDate)
+		return err
+	})
+	if err == filestore.FileNotFoundErr || err == filestore.NotFoundErr {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+	fileSlot = extended
+	err = srv.Send(&api.ExtendFileResponse{Event: &api.ExtendFileResponse_FileInfo{FileInfo: f.YmlFileSlotToProto(req.FileId, fileSlot)}})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\n \t [FS] File extended %v", fileSlot)
+	return nil
+}
+
+func (f *FileServer) TopUp(req *api.TopUpRequest, srv api.PrivateFileStore_TopUpServer) error {
+	ctx := srv.Context()
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return status.Error(codes.Internal, fmt.Sprintf("unable to read metadata"))
+	}
+
+	pubkey := md.Get("pubkey")
+	if len(pubkey) != 1 {
+		return status.Error(codes.FailedPrecondition, fmt.Sprintf("unable to get pubkey from metadata"))
+	}
+	if err := filestore.ValidatePubkey(pubkey[0]); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.AmtMsat < minInvoiceMsat {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("minimum top up is %v msat", minInvoiceMsat))
+	}
+	fmt.Printf("\n \t [FS] Top up %v; amount: %v;", pubkey[0], req.AmtMsat)
+	// Send TopUp Invoice and credit the balance once it is paid, even if the
+	// client is gone by then
+	var balance int64
+	err := f.payInvoiceDetached(ctx, "Top up balance", req.AmtMsat, func(invoice *api.InvoiceResponse) error {
+		return srv.Send(&api.TopUpResponse{Event: &api.TopUpResponse_Invoice{Invoice: invoice}})
+	}, func(ctx context.Context, payment *lnrpc.Invoice) error {
+		var err error
+		balance, err = f.fs.CreditBalance(ctx, pubkey[0], payment.AmtPaidMsat)
+		if err != nil {
+			fmt.Printf("\n \t [FS] unable to credit top up of %v msat to %s: %v", payment.AmtPaidMsat, pubkey[0], err)
+			return status.Error(codes.Internal, fmt.Sprintf("unable to credit balance: %v", err))
+		}
+		fmt.Printf("\n \t [FS] Credited top up of %v msat to %s; balance: %v", payment.AmtPaidMsat, pubkey[0], balance)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return srv.Send(&api.TopUpResponse{Event: &api.TopUpResponse_Balance{Balance: &api.GetBalanceResponse{BalanceMsat: balance}}})
+}
+
+func (f *FileServer) GetBalance(ctx context.Context, req *api.GetBalanceRequest) (*api.GetBalanceResponse, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("unable to read metadata"))
+	}
+
+	pubkey := md.Get("pubkey")
+	if len(pubkey) != 1 {
+		return nil, status.Error(codes.FailedPrecondition, fmt.Sprintf("unable to get pubkey from metadata"))
+	}
+	if err := filestore.ValidatePubkey(pubkey[0]); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	balance, err := f.fs.GetBalance(ctx, pubkey[0])
+	if err != nil {
+		return nil, status.Error(codes.Unknown, err.Error())
+	}
+	return &api.GetBalanceResponse{BalanceMsat: balance}, nil
+}
+
 func (f *FileServer) YmlFileSlotToProto(id string, slot *filestore.FileSlot) *api.FileSlot {
 	return &api.FileSlot{
-		FileId:       id,
-		Filename:     slot.FileName,
-		Description:  slot.Description,
-		ShaChecksum:  slot.Sha256Checksum,
-		Bytes:        slot.Bytes,
-		CreationDate: slot.CreationDate,
-		DeletionDate: slot.DeletionDate,
+		FileId:        id,
+		Filename:      slot.FileName,
+		Description:   slot.Description,
+		ShaChecksum:   slot.Sha256Checksum,
+		Bytes:         slot.Bytes,
+		CreationDate:  slot.CreationDate,
+		DeletionDate:  slot.DeletionDate,
+		PhysicalBytes: slot.PhysicalBytes,
 	}
 }
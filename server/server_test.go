@@ -0,0 +1,617 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sputn1ck/ln-fileserver/api"
+	"github.com/sputn1ck/ln-fileserver/filestore"
+	"github.com/sputn1ck/ln-fileserver/lnd"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	testPubkey    = "02aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	testChunkSize = 4096
+)
+
+// testServer runs a FileServer with a fake payment backend over an in-memory
+// connection.
+type testServer struct {
+	fs     *filestore.Service
+	dir    string
+	fake   *lnd.FakeService
+	server *FileServer
+	client api.PrivateFileStoreClient
+	// ctx carries the pubkey of the test user
+	ctx     context.Context
+	cleanup func()
+}
+
+func newTestServer(t *testing.T, hold bool) *testServer {
+	dir, err := ioutil.TempDir("", "fileserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, err := filestore.NewService(filestore.NewYmlUserConfigStore(dir), dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	fake := lnd.NewFakeService(false)
+	fileserver := NewFileServer(fs, fake, nil, &api.FeeReport{
+		MsatBaseCost:        1000,
+		MsatPerDownloadedKB: 1,
+		MsatPerHourPerKB:    1,
+	})
+	if hold {
+		if err := fileserver.EnableHoldInvoices(); err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+	}
+
+	lis := bufconn.Listen(1024 * 1024)
+	grpcSrv := grpc.NewServer()
+	api.RegisterPrivateFileStoreServer(grpcSrv, fileserver)
+	go grpcSrv.Serve(lis)
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		grpcSrv.Stop()
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return &testServer{
+		fs:     fs,
+		dir:    dir,
+		fake:   fake,
+		server: fileserver,
+		client: api.NewPrivateFileStoreClient(conn),
+		ctx:    metadata.AppendToOutgoingContext(context.Background(), "pubkey", testPubkey),
+		cleanup: func() {
+			conn.Close()
+			grpcSrv.Stop()
+			os.RemoveAll(dir)
+		},
+	}
+}
+
+// payFunc pays or rejects the invoice with the given payment request.
+type payFunc func(paymentRequest string) error
+
+// pay pays the invoice unless it is free or was paid from the balance.
+func pay(invoice *api.InvoiceResponse, payInvoice payFunc) error {
+	if invoice.Invoice == "free" || invoice.Prepaid {
+		return nil
+	}
+	return payInvoice(invoice.Invoice)
+}
+
+// upload uploads the content in chunks of testChunkSize and pays every
+// invoice with payInvoice. If declared is set, the size and checksum are
+// declared up front.
+func (s *testServer) upload(content []byte, declared bool, checksum string, payInvoice payFunc) (*api.FileSlot, error) {
+	stream, err := s.client.UploadFile(s.ctx)
+	if err != nil {
+		return nil, err
+	}
+	slot := &api.NewFileSlot{
+		Filename:     "test.txt",
+		DeletionDate: time.Now().Unix() + 2*3600 + 60,
+	}
+	if declared {
+		slot.Bytes = int64(len(content))
+		slot.ShaChecksum = checksum
+	}
+	if err := stream.Send(&api.UploadFileRequest{Event: &api.UploadFileRequest_Slot{Slot: slot}}); err != nil {
+		return nil, err
+	}
+	for {
+		res, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		if invoice := res.GetInvoice(); invoice != nil {
+			if err := pay(invoice, payInvoice); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if res.GetSession() == nil {
+			return nil, fmt.Errorf("upload session expected, got %v", res)
+		}
+		break
+	}
+	for offset := 0; offset < len(content); offset += testChunkSize {
+		end := offset + testChunkSize
+		if end > len(content) {
+			end = len(content)
+		}
+		err := stream.Send(&api.UploadFileRequest{Event: &api.UploadFileRequest_Chunk{Chunk: &api.FileChunk{Content: content[offset:end]}}})
+		if err != nil {
+			return nil, err
+		}
+		if declared {
+			continue
+		}
+		res, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		if err := pay(res.GetInvoice(), payInvoice); err != nil {
+			return nil, err
+		}
+	}
+	if err := stream.Send(&api.UploadFileRequest{Event: &api.UploadFileRequest_Finished{Finished: &api.Empty{}}}); err != nil {
+		return nil, err
+	}
+	res, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	return res.GetFinishedFile(), nil
+}
+
+// download downloads length bytes of the file from offset and pays every
+// invoice.
+func (s *testServer) download(fileid string, offset int64, length int64) ([]byte, error) {
+	stream, err := s.client.DownloadFile(s.ctx, &api.DownloadFileRequest{FileId: fileid, Offset: offset, Length: length})
+	if err != nil {
+		return nil, err
+	}
+	var content []byte
+	for {
+		res, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		switch event := res.Event.(type) {
+		case *api.DownloadFileResponse_Invoice:
+			if err := pay(event.Invoice, s.fake.Settle); err != nil {
+				return nil, err
+			}
+		case *api.DownloadFileResponse_Chunk:
+			content = append(content, event.Chunk.Content...)
+		case *api.DownloadFileResponse_Finished:
+			return content, nil
+		}
+	}
+}
+
+func testContent(n int) ([]byte, string) {
+	content := make([]byte, n)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+	sum := sha256.Sum256(content)
+	return content, hex.EncodeToString(sum[:])
+}
+
+func TestUploadDownload(t *testing.T) {
+	for _, declared := range []bool{false, true} {
+		t.Run(fmt.Sprintf("declared=%v", declared), func(t *testing.T) {
+			s := newTestServer(t, false)
+			defer s.cleanup()
+			content, checksum := testContent(3*testChunkSize + 100)
+
+			slot, err := s.upload(content, declared, checksum, s.fake.Settle)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if slot.Bytes != int64(len(content)) || slot.ShaChecksum != checksum {
+				t.Fatalf("unexpected file %v", slot)
+			}
+			// base cost plus one invoice per chunk or one for the whole
+			// file, invoices are at least minInvoiceMsat and the last
+			// chunk is smaller than a kilobyte and free
+			expected := int64(1000 + 3*minInvoiceMsat)
+			if declared {
+				expected = 1000 + 24
+			}
+			if settled := s.fake.SettledMsat(); settled != expected {
+				t.Fatalf("expected %v msat to be paid, got %v", expected, settled)
+			}
+
+			downloaded, err := s.download(slot.FileId, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(downloaded, content) {
+				t.Fatalf("downloaded %v bytes that do not match the upload", len(downloaded))
+			}
+			downloaded, err = s.download(slot.FileId, 1000, 5000)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(downloaded, content[1000:6000]) {
+				t.Fatalf("downloaded range of %v bytes does not match the upload", len(downloaded))
+			}
+			downloaded, err = s.download(slot.FileId, int64(len(content))-10, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(downloaded, content[len(content)-10:]) {
+				t.Fatalf("downloaded tail of %v bytes does not match the upload", len(downloaded))
+			}
+			_, err = s.download(slot.FileId, int64(len(content))+1, 0)
+			if status.Code(err) != codes.OutOfRange {
+				t.Fatalf("expected OutOfRange, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyDownloads(t *testing.T) {
+	s := newTestServer(t, false)
+	defer s.cleanup()
+	s.server.EnableDownloadVerification()
+	content, checksum := testContent(2 * testChunkSize)
+	slot, err := s.upload(content, false, checksum, s.fake.Settle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupted := append([]byte(nil), content...)
+	corrupted[0] ^= 1
+	if err := ioutil.WriteFile(filepath.Join(s.dir, testPubkey, slot.FileId), corrupted, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, length := range []int64{0, int64(len(content))} {
+		if _, err := s.download(slot.FileId, 0, length); status.Code(err) != codes.DataLoss {
+			t.Fatalf("full download of length %v: expected DataLoss, got %v", length, err)
+		}
+	}
+	// ranges are not verified
+	downloaded, err := s.download(slot.FileId, 1, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(downloaded, content[1:101]) {
+		t.Fatalf("downloaded range of %v bytes does not match the upload", len(downloaded))
+	}
+}
+
+func TestUploadCanceledInvoice(t *testing.T) {
+	s := newTestServer(t, false)
+	defer s.cleanup()
+	content, checksum := testContent(3 * testChunkSize)
+
+	// a canceled invoice for the file slot creates no upload
+	_, err := s.upload(content, false, checksum, s.fake.Cancel)
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition, got %v", err)
+	}
+
+	// a canceled invoice for a chunk aborts the upload
+	invoices := 0
+	_, err = s.upload(content, false, checksum, func(paymentRequest string) error {
+		invoices++
+		if invoices == 3 {
+			return s.fake.Cancel(paymentRequest)
+		}
+		return s.fake.Settle(paymentRequest)
+	})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition, got %v", err)
+	}
+	files, _, err := s.fs.Usage(s.ctx, testPubkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files != 0 {
+		t.Fatalf("expected the aborted upload to be removed, %v files left", files)
+	}
+	if open := s.fake.OpenInvoices(); len(open) != 0 {
+		t.Fatalf("expected no open invoices, got %v", open)
+	}
+}
+
+func TestPaymentAfterDisconnect(t *testing.T) {
+	s := newTestServer(t, false)
+	defer s.cleanup()
+	ctx, cancel := context.WithCancel(s.ctx)
+	invoices := make(chan string, 1)
+	result := make(chan error, 1)
+	go func() {
+		_, err := s.server.requestPayment(ctx, testPubkey, "Uploading Chunk", 2000, func(invoice *api.InvoiceResponse) error {
+			invoices <- invoice.Invoice
+			return nil
+		})
+		result <- err
+	}()
+	invoice := <-invoices
+
+	// the client disconnects before the payment arrives
+	cancel()
+	if err := <-result; status.Code(err) != codes.Canceled {
+		t.Fatalf("expected Canceled, got %v", err)
+	}
+	if err := s.fake.Settle(invoice); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		balance, err := s.fs.GetBalance(s.ctx, testPubkey)
+		if err != nil && err != filestore.NotFoundErr {
+			t.Fatal(err)
+		}
+		if balance == 2000 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the payment to be credited, balance is %v", balance)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHoldInvoices(t *testing.T) {
+	s := newTestServer(t, true)
+	defer s.cleanup()
+	content, checksum := testContent(3 * testChunkSize)
+
+	// accepted invoices are settled once the chunks are written
+	slot, err := s.upload(content, false, checksum, s.fake.Settle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settled := s.fake.SettledMsat(); settled != 1000+3*minInvoiceMsat {
+		t.Fatalf("expected %v msat to be settled, got %v", 1000+3*minInvoiceMsat, settled)
+	}
+	downloaded, err := s.download(slot.FileId, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(downloaded, content) {
+		t.Fatal("downloaded file does not match the upload")
+	}
+
+	// the held storage of a declared upload is canceled if the checksum
+	// does not match, only the slot is paid
+	settledBefore := s.fake.SettledMsat()
+	_, wrongChecksum := testContent(10)
+	_, err = s.upload(content, true, wrongChecksum, s.fake.Settle)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+	if settled := s.fake.SettledMsat() - settledBefore; settled != 1000 {
+		t.Fatalf("expected only the base cost of 1000 msat to be settled, got %v", settled)
+	}
+
+	// a matching declared upload settles the storage after it is saved
+	settledBefore = s.fake.SettledMsat()
+	if _, err := s.upload(content, true, checksum, s.fake.Settle); err != nil {
+		t.Fatal(err)
+	}
+	if settled := s.fake.SettledMsat() - settledBefore; settled != 1000+minInvoiceMsat {
+		t.Fatalf("expected %v msat to be settled, got %v", 1000+minInvoiceMsat, settled)
+	}
+}
+
+func TestInvalidIds(t *testing.T) {
+	s := newTestServer(t, false)
+	defer s.cleanup()
+	content, checksum := testContent(testChunkSize)
+	slot, err := s.upload(content, false, checksum, s.fake.Settle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type call func(ctx context.Context, fileid string) error
+	// recv returns the first error of a server stream
+	recv := func(stream interface{ RecvMsg(interface{}) error }, err error, msg interface{}) error {
+		if err != nil {
+			return err
+		}
+		return stream.RecvMsg(msg)
+	}
+	fileCalls := map[string]call{
+		"DeleteFile": func(ctx context.Context, fileid string) error {
+			_, err := s.client.DeleteFile(ctx, &api.DeleteFileRequest{FileId: fileid})
+			return err
+		},
+		"DownloadFile": func(ctx context.Context, fileid string) error {
+			stream, err := s.client.DownloadFile(ctx, &api.DownloadFileRequest{FileId: fileid})
+			return recv(stream, err, &api.DownloadFileResponse{})
+		},
+		"ExtendFile": func(ctx context.Context, fileid string) error {
+			stream, err := s.client.ExtendFile(ctx, &api.ExtendFileRequest{FileId: fileid, DeletionDate: 4102444800})
+			return recv(stream, err, &api.ExtendFileResponse{})
+		},
+		"ResumeUpload": func(ctx context.Context, fileid string) error {
+			stream, err := s.client.UploadFile(ctx)
+			if err != nil {
+				return err
+			}
+			err = stream.Send(&api.UploadFileRequest{Event: &api.UploadFileRequest_Resume{Resume: &api.ResumeUpload{UploadId: fileid}}})
+			if err != nil {
+				return err
+			}
+			_, err = stream.Recv()
+			return err
+		},
+	}
+	userCalls := map[string]call{
+		"ListFiles": func(ctx context.Context, fileid string) error {
+			_, err := s.client.ListFiles(ctx, &api.ListFilesRequest{})
+			return err
+		},
+		"GetBalance": func(ctx context.Context, fileid string) error {
+			_, err := s.client.GetBalance(ctx, &api.GetBalanceRequest{})
+			return err
+		},
+		"TopUp": func(ctx context.Context, fileid string) error {
+			stream, err := s.client.TopUp(ctx, &api.TopUpRequest{AmtMsat: 1000})
+			return recv(stream, err, &api.TopUpResponse{})
+		},
+		"UploadFile": func(ctx context.Context, fileid string) error {
+			stream, err := s.client.UploadFile(ctx)
+			if err != nil {
+				return err
+			}
+			err = stream.Send(&api.UploadFileRequest{Event: &api.UploadFileRequest_Slot{Slot: &api.NewFileSlot{
+				Filename:     "test.txt",
+				DeletionDate: time.Now().Unix() + 2*3600,
+			}}})
+			if err != nil {
+				return err
+			}
+			_, err = stream.Recv()
+			return err
+		},
+	}
+	for name, fileCall := range fileCalls {
+		userCalls[name] = fileCall
+	}
+
+	// metadata can not carry NUL bytes, they are covered by the filestore
+	pubkeys := map[string]string{
+		"short":       "02aa",
+		"uppercase":   "02" + strings.Repeat("A", 64),
+		"parent":      "../" + strings.Repeat("a", 63),
+		"parents":     strings.Repeat("../", 22),
+		"absolute":    "/tmp/" + strings.Repeat("a", 61),
+		"url encoded": "%2e%2e%2f" + strings.Repeat("a", 57),
+	}
+	fileids := map[string]string{
+		"parent":      "../../escape",
+		"absolute":    "/etc/passwd",
+		"url encoded": "%2e%2e%2fescape",
+		"uppercase":   strings.ToUpper(slot.FileId),
+		"braces":      "{" + slot.FileId + "}",
+		"no dashes":   strings.Replace(slot.FileId, "-", "", -1),
+		"suffix":      slot.FileId + "/../escape",
+	}
+	for name, userCall := range userCalls {
+		for payload, pubkey := range pubkeys {
+			ctx := metadata.AppendToOutgoingContext(context.Background(), "pubkey", pubkey)
+			if err := userCall(ctx, slot.FileId); status.Code(err) != codes.InvalidArgument {
+				t.Errorf("%v with %v pubkey: expected InvalidArgument, got %v", name, payload, err)
+			}
+		}
+	}
+	for name, fileCall := range fileCalls {
+		for payload, fileid := range fileids {
+			if err := fileCall(s.ctx, fileid); status.Code(err) != codes.InvalidArgument {
+				t.Errorf("%v with %v file id: expected InvalidArgument, got %v", name, payload, err)
+			}
+		}
+	}
+	if _, err := s.fs.GetFile(s.ctx, testPubkey, slot.FileId); err != nil {
+		t.Fatalf("file was changed by invalid ids: %v", err)
+	}
+}
+
+func TestExtendFileRejected(t *testing.T) {
+	s := newTestServer(t, false)
+	defer s.cleanup()
+	content, checksum := testContent(testChunkSize)
+	slot, err := s.upload(content, false, checksum, s.fake.Settle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	extend := func(ctx context.Context, deletionDate int64) error {
+		stream, err := s.client.ExtendFile(ctx, &api.ExtendFileRequest{FileId: slot.FileId, DeletionDate: deletionDate})
+		if err != nil {
+			return err
+		}
+		_, err = stream.Recv()
+		return err
+	}
+	other := metadata.AppendToOutgoingContext(context.Background(), "pubkey", "03"+strings.Repeat("b", 64))
+	if err := extend(other, slot.DeletionDate+3600); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound for the file of another user, got %v", err)
+	}
+	if err := extend(s.ctx, slot.DeletionDate+60); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for a short extension, got %v", err)
+	}
+
+	// rejected extensions do not keep the file from the reaper
+	removed, err := s.fs.DeleteExpired(s.ctx, testPubkey, slot.DeletionDate+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 {
+		t.Fatalf("expected the expired file to be removed, got %v", removed)
+	}
+}
+
+func TestConcurrentResume(t *testing.T) {
+	s := newTestServer(t, false)
+	defer s.cleanup()
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	stream, err := s.client.UploadFile(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stream.Send(&api.UploadFileRequest{Event: &api.UploadFileRequest_Slot{Slot: &api.NewFileSlot{
+		Filename:     "test.txt",
+		DeletionDate: time.Now().Unix() + 2*3600,
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var session *api.UploadSession
+	for session == nil {
+		res, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if invoice := res.GetInvoice(); invoice != nil {
+			if err := pay(invoice, s.fake.Settle); err != nil {
+				t.Fatal(err)
+			}
+		}
+		session = res.GetSession()
+	}
+
+	resume := func() error {
+		stream, err := s.client.UploadFile(s.ctx)
+		if err != nil {
+			return err
+		}
+		defer stream.CloseSend()
+		err = stream.Send(&api.UploadFileRequest{Event: &api.UploadFileRequest_Resume{Resume: &api.ResumeUpload{UploadId: session.UploadId}}})
+		if err != nil {
+			return err
+		}
+		_, err = stream.Recv()
+		return err
+	}
+	if err := resume(); status.Code(err) != codes.Aborted {
+		t.Fatalf("expected Aborted while the upload is written, got %v", err)
+	}
+
+	// the upload is released once the first stream ends
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err := resume()
+		if err == nil {
+			break
+		}
+		if status.Code(err) != codes.Aborted || time.Now().After(deadline) {
+			t.Fatalf("expected the upload to be resumed, got %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}